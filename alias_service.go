@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AliasService manages the alternative names of cryptocurrencies, such as
+// "BTC" or "XBT" for Bitcoin. Names and aliases are compared case-insensitively.
+type AliasService struct {
+	db    Database
+	audit *AuditService
+}
+
+func NewAliasService(db *sql.DB) *AliasService {
+	return &AliasService{
+		db: db,
+	}
+}
+
+// EnableAuditLog records alias changes in the audit log.
+func (s *AliasService) EnableAuditLog(audit *AuditService) {
+	s.audit = audit
+}
+
+func (s *AliasService) GetAliases(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	aliases, err := s.getAliases(cryptoID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting aliases", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(aliases)
+}
+
+func (s *AliasService) AddAlias(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Alias string `json:"alias"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	alias := strings.TrimSpace(request.Alias)
+	if alias == "" {
+		http.Error(w, "Alias cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := strconv.Atoi(alias); err == nil {
+		http.Error(w, "Alias cannot be a number", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the cryptocurrency exists in the database
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", cryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error adding alias", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+
+	// An alias must not be taken by any name or alias
+	err = s.db.QueryRow("SELECT (SELECT COUNT(*) FROM crypto_vote WHERE LOWER(name) = LOWER(?)) + (SELECT COUNT(*) FROM crypto_aliases WHERE LOWER(alias) = LOWER(?))",
+		alias, alias).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error adding alias", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Name or alias already in use", http.StatusConflict)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error adding alias", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO crypto_aliases (crypto_id, alias) VALUES (?, ?)", cryptoID, alias)
+	if isDuplicateKeyError(err) {
+		// A concurrent request added the same alias first
+		http.Error(w, "Name or alias already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error adding alias", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionAliasAdd, cryptoID, nil, alias)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error adding alias", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error adding alias", http.StatusInternalServerError)
+		return
+	}
+
+	aliases, err := s.getAliases(cryptoID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting aliases", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(aliases)
+}
+
+func (s *AliasService) DeleteAlias(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error deleting alias", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM crypto_aliases WHERE crypto_id = ? AND LOWER(alias) = LOWER(?)", cryptoID, params["alias"])
+	if err != nil {
+		log.Println("Error deleting from database:", err)
+		http.Error(w, "Error deleting alias", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error deleting alias", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Alias does not exist", http.StatusNotFound)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionAliasRemove, cryptoID, params["alias"], nil)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error deleting alias", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error deleting alias", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCryptoCurrencyByName looks a cryptocurrency up by its name or any of its
+// aliases.
+func (s *AliasService) GetCryptoCurrencyByName(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	name := strings.TrimSpace(params["name"])
+
+	var crypto CryptoCurrency
+
+	err := s.db.QueryRow(`SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote
+		WHERE deleted_at IS NULL AND (LOWER(name) = LOWER(?) OR id IN (SELECT crypto_id FROM crypto_aliases WHERE LOWER(alias) = LOWER(?)))
+		ORDER BY id LIMIT 1`, name, name).
+		Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	crypto.Aliases, err = s.getAliases(crypto.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(crypto)
+}
+
+func (s *AliasService) getAliases(cryptoID int) ([]string, error) {
+	aliases := []string{}
+
+	rows, err := s.db.Query("SELECT alias FROM crypto_aliases WHERE crypto_id = ? ORDER BY alias", cryptoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, rows.Err()
+}
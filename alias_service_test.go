@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCryptoCurrencyByName(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	aliasService := NewAliasService(db)
+
+	// Set the expectations for the lookup by name or alias
+	rowsCrypto := sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).
+		AddRow(1, "Bitcoin", 100, 20, 120)
+	mock.ExpectQuery("SELECT id, name, .* FROM crypto_vote WHERE deleted_at IS NULL AND \\(LOWER\\(name\\) = LOWER\\(\\?\\) OR id IN").
+		WithArgs("xbt", "xbt").
+		WillReturnRows(rowsCrypto)
+
+	// Set the expectations for the aliases of the cryptocurrency
+	rowsAliases := sqlmock.NewRows([]string{"alias"}).AddRow("BTC").AddRow("XBT")
+	mock.ExpectQuery("SELECT alias FROM crypto_aliases WHERE crypto_id = ?").
+		WithArgs(1).
+		WillReturnRows(rowsAliases)
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/cryptovote/by-name/xbt", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/by-name/{name}", aliasService.GetCryptoCurrencyByName).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var crypto CryptoCurrency
+	err = json.Unmarshal(rr.Body.Bytes(), &crypto)
+	assert.NoError(t, err)
+
+	expectedCrypto := CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 100, DownVote: 20, TotalVotes: 120, Aliases: []string{"BTC", "XBT"}}
+	assert.Equal(t, expectedCrypto, crypto)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddAlias(t *testing.T) {
+	t.Run("AliasAlreadyInUse", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		aliasService := NewAliasService(db)
+
+		// Set the expectations for the existence check and the name conflict
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT \\(SELECT COUNT\\(\\*\\) FROM crypto_vote").
+			WithArgs("BTC", "BTC").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/admin/cryptovote/2/aliases", strings.NewReader(`{"alias": " BTC "}`))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/aliases", aliasService.AddAlias).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("AliasAddedConcurrently", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		aliasService := NewAliasService(db)
+
+		// The alias is free when checked but taken by the time it is inserted
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT \\(SELECT COUNT\\(\\*\\) FROM crypto_vote").
+			WithArgs("BTC", "BTC").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO crypto_aliases \\(crypto_id, alias\\) VALUES \\(\\?, \\?\\)").
+			WithArgs(1, "BTC").
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'BTC' for key 'alias'"})
+		mock.ExpectRollback()
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/admin/cryptovote/1/aliases", strings.NewReader(`{"alias": "BTC"}`))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/aliases", aliasService.AddAlias).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NewAlias", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		aliasService := NewAliasService(db)
+
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT \\(SELECT COUNT\\(\\*\\) FROM crypto_vote").
+			WithArgs("BTC", "BTC").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO crypto_aliases \\(crypto_id, alias\\) VALUES \\(\\?, \\?\\)").
+			WithArgs(1, "BTC").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT alias FROM crypto_aliases WHERE crypto_id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"alias"}).AddRow("BTC"))
+
+		req, err := http.NewRequest("POST", "/v1/admin/cryptovote/1/aliases", strings.NewReader(`{"alias": "BTC"}`))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/aliases", aliasService.AddAlias).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.JSONEq(t, `["BTC"]`, rr.Body.String())
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
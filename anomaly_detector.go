@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AnomalyDetectorConfig holds the parameters of the vote spike detector.
+type AnomalyDetectorConfig struct {
+	// Weight of the latest minute in the moving average and variance of the
+	// votes per minute. Higher values forget the past faster.
+	Alpha float64
+
+	// A minute is anomalous once its votes are ZScoreThreshold standard
+	// deviations above the moving average, with at least MinVotes votes.
+	ZScoreThreshold float64
+	MinVotes        int
+}
+
+func DefaultAnomalyDetectorConfig() AnomalyDetectorConfig {
+	return AnomalyDetectorConfig{
+		Alpha:           0.1,
+		ZScoreThreshold: 4,
+		MinVotes:        20,
+	}
+}
+
+// Quiet minutes are folded into the moving average one by one, up to this
+// many. By then the average has decayed to nothing anyway.
+const maxAnomalyQuietMinutes = 1000
+
+type voteActivity struct {
+	minute   int64
+	votes    int
+	mean     float64
+	variance float64
+	raised   bool
+}
+
+// AnomalyDetector keeps an exponentially weighted moving average and
+// variance of the votes per minute of every cryptocurrency, and flags the
+// minutes whose votes stand out from them. Only the current minute of every
+// cryptocurrency is kept, the detector never looks back at past votes. It is
+// seeded from the vote history at startup, see AnomalyService.Load.
+type AnomalyDetector struct {
+	config AnomalyDetectorConfig
+
+	mu       sync.Mutex
+	activity map[int]*voteActivity
+}
+
+func NewAnomalyDetector(config AnomalyDetectorConfig) *AnomalyDetector {
+	return &AnomalyDetector{
+		config:   config,
+		activity: make(map[int]*voteActivity),
+	}
+}
+
+// Observe counts a vote cast at the time and returns the anomaly when it
+// makes the current minute stand out. Every minute raises at most one
+// anomaly per cryptocurrency. Votes cast before the current minute, such as
+// votes approved by a moderator, are not counted.
+func (d *AnomalyDetector) Observe(cryptoID int, at time.Time) *Anomaly {
+	minute := at.Unix() / 60
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	activity := d.advance(cryptoID, minute)
+	if activity == nil {
+		return nil
+	}
+
+	activity.votes++
+
+	if activity.raised || activity.votes < d.config.MinVotes {
+		return nil
+	}
+
+	// A standard deviation below one vote would turn any activity on a quiet
+	// cryptocurrency into an anomaly
+	deviation := math.Max(math.Sqrt(activity.variance), 1)
+	zScore := (float64(activity.votes) - activity.mean) / deviation
+	if zScore < d.config.ZScoreThreshold {
+		return nil
+	}
+
+	activity.raised = true
+	return &Anomaly{
+		CryptoID:    cryptoID,
+		WindowStart: time.Unix(minute*60, 0).UTC(),
+		Votes:       activity.votes,
+		Expected:    activity.mean,
+		ZScore:      zScore,
+		DetectedAt:  at.UTC(),
+	}
+}
+
+// Seed counts the votes cast in a past minute without raising anomalies, to
+// restore the moving average and variance from the vote history. Minutes are
+// seeded in order, before the votes of the current minute are observed.
+func (d *AnomalyDetector) Seed(cryptoID int, at time.Time, votes int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if activity := d.advance(cryptoID, at.Unix()/60); activity != nil {
+		activity.votes += votes
+	}
+}
+
+// advance moves the activity of the cryptocurrency to the minute and returns
+// it, or nil when the minute is already over.
+func (d *AnomalyDetector) advance(cryptoID int, minute int64) *voteActivity {
+	activity, ok := d.activity[cryptoID]
+	if !ok {
+		activity = &voteActivity{minute: minute}
+		d.activity[cryptoID] = activity
+	}
+
+	if minute < activity.minute {
+		return nil
+	}
+
+	if minute > activity.minute {
+		// Fold the finished minute and the quiet minutes since into the
+		// moving average and variance
+		d.update(activity, float64(activity.votes))
+		if quiet := minute - activity.minute - 1; quiet > maxAnomalyQuietMinutes {
+			activity.mean, activity.variance = 0, 0
+		} else {
+			for ; quiet > 0; quiet-- {
+				d.update(activity, 0)
+			}
+		}
+
+		activity.minute = minute
+		activity.votes = 0
+		activity.raised = false
+	}
+
+	return activity
+}
+
+func (d *AnomalyDetector) update(activity *voteActivity, votes float64) {
+	diff := votes - activity.mean
+	increment := d.config.Alpha * diff
+	activity.mean += increment
+	activity.variance = (1 - d.config.Alpha) * (activity.variance + diff*increment)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyDetector(t *testing.T) {
+	start := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Spike", func(t *testing.T) {
+		detector := NewAnomalyDetector(DefaultAnomalyDetectorConfig())
+
+		// Half an hour of steady activity, five votes a minute
+		for minute := 0; minute < 30; minute++ {
+			for vote := 0; vote < 5; vote++ {
+				assert.Nil(t, detector.Observe(1, start.Add(time.Duration(minute)*time.Minute)))
+			}
+		}
+
+		// A burst of votes in the next minute raises a single anomaly
+		burst := start.Add(30 * time.Minute)
+		var anomalies []*Anomaly
+		for vote := 0; vote < 60; vote++ {
+			if anomaly := detector.Observe(1, burst.Add(time.Duration(vote)*time.Second)); anomaly != nil {
+				anomalies = append(anomalies, anomaly)
+			}
+		}
+
+		assert.Len(t, anomalies, 1)
+		assert.Equal(t, 1, anomalies[0].CryptoID)
+		assert.Equal(t, burst, anomalies[0].WindowStart)
+		assert.Equal(t, 20, anomalies[0].Votes)
+		assert.InDelta(t, 5, anomalies[0].Expected, 0.5)
+		assert.GreaterOrEqual(t, anomalies[0].ZScore, 4.0)
+	})
+
+	t.Run("SteadyHighActivity", func(t *testing.T) {
+		detector := NewAnomalyDetector(DefaultAnomalyDetectorConfig())
+
+		// A popular cryptocurrency with varying activity never stands out
+		for minute := 0; minute < 120; minute++ {
+			votes := 100 + (minute%3)*10
+			for vote := 0; vote < votes; vote++ {
+				anomaly := detector.Observe(1, start.Add(time.Duration(minute)*time.Minute))
+				if minute > 30 {
+					assert.Nil(t, anomaly)
+				}
+			}
+		}
+	})
+
+	t.Run("FewVotes", func(t *testing.T) {
+		detector := NewAnomalyDetector(DefaultAnomalyDetectorConfig())
+
+		// A handful of votes on a quiet cryptocurrency is not a spike
+		for vote := 0; vote < 19; vote++ {
+			assert.Nil(t, detector.Observe(2, start))
+		}
+	})
+
+	t.Run("SeededFromHistory", func(t *testing.T) {
+		detector := NewAnomalyDetector(DefaultAnomalyDetectorConfig())
+
+		// Half an hour of busy history, fifty votes a minute
+		for minute := 0; minute < 30; minute++ {
+			detector.Seed(4, start.Add(time.Duration(minute)*time.Minute), 50)
+		}
+
+		// The usual activity after a restart is not a spike
+		for vote := 0; vote < 50; vote++ {
+			assert.Nil(t, detector.Observe(4, start.Add(30*time.Minute)))
+		}
+	})
+
+	t.Run("PastVotes", func(t *testing.T) {
+		detector := NewAnomalyDetector(DefaultAnomalyDetectorConfig())
+
+		assert.Nil(t, detector.Observe(3, start))
+
+		// Votes approved by a moderator an hour later are not counted
+		for vote := 0; vote < 100; vote++ {
+			assert.Nil(t, detector.Observe(3, start.Add(-time.Hour)))
+		}
+	})
+}
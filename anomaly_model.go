@@ -0,0 +1,16 @@
+package main
+
+import "time"
+
+// Anomaly is a burst of votes on one cryptocurrency. Votes were counted in
+// the minute starting at WindowStart while Expected votes per minute were
+// expected, ZScore standard deviations above the usual activity.
+type Anomaly struct {
+	ID          int       `json:"id"`
+	CryptoID    int       `json:"crypto_id"`
+	WindowStart time.Time `json:"window_start"`
+	Votes       int       `json:"votes"`
+	Expected    float64   `json:"expected"`
+	ZScore      float64   `json:"z_score"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
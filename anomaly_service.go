@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAnomalyPageSize = 50
+	maxAnomalyPageSize     = 500
+)
+
+// The detector is seeded with this much vote history at startup. Older
+// minutes weigh next to nothing in the moving average.
+const anomalyHistoryWindow = 2 * time.Hour
+
+// AnomalyService runs every counted vote through the anomaly detector,
+// stores the anomalies it raises and passes them on to the notifiers.
+type AnomalyService struct {
+	db        Database
+	detector  *AnomalyDetector
+	notifiers []Notifier
+}
+
+func NewAnomalyService(db *sql.DB, detector *AnomalyDetector) *AnomalyService {
+	return &AnomalyService{
+		db:       db,
+		detector: detector,
+	}
+}
+
+// AddNotifier alerts the notifier of every anomaly raised from now on.
+func (s *AnomalyService) AddNotifier(notifier Notifier) {
+	s.notifiers = append(s.notifiers, notifier)
+}
+
+// Load seeds the detector with the votes per minute of the history window
+// ending at now, so a restart doesn't take every cryptocurrency for a quiet
+// one. It is meant to be called once at startup, before votes are observed.
+func (s *AnomalyService) Load(now time.Time) error {
+	rows, err := s.db.Query("SELECT crypto_id, bucket_start, up_vote + down_vote FROM vote_buckets WHERE bucket_start >= ? ORDER BY crypto_id, bucket_start",
+		now.UTC().Add(-anomalyHistoryWindow).Truncate(time.Minute))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cryptoID, votes int
+		var bucketStart time.Time
+		if err := rows.Scan(&cryptoID, &bucketStart, &votes); err != nil {
+			return err
+		}
+		s.detector.Seed(cryptoID, bucketStart, votes)
+	}
+
+	return rows.Err()
+}
+
+// ObserveVote feeds the vote to the detector and raises the anomaly it may
+// detect.
+func (s *AnomalyService) ObserveVote(cryptoID int, direction string, at time.Time) {
+	anomaly := s.detector.Observe(cryptoID, at)
+	if anomaly == nil {
+		return
+	}
+
+	if err := s.raise(anomaly); err != nil {
+		log.Println("Error raising vote anomaly:", err)
+	}
+}
+
+// raise stores the anomaly and notifies the notifiers in the background, so
+// a slow notifier never holds up a vote.
+func (s *AnomalyService) raise(anomaly *Anomaly) error {
+	result, err := s.db.Exec("INSERT INTO anomalies (crypto_id, window_start, votes, expected, z_score, detected_at) VALUES (?, ?, ?, ?, ?, ?)",
+		anomaly.CryptoID, anomaly.WindowStart, anomaly.Votes, anomaly.Expected, anomaly.ZScore, anomaly.DetectedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	anomaly.ID = int(id)
+
+	notifiers := s.notifiers
+	go func(anomaly Anomaly) {
+		for _, notifier := range notifiers {
+			if err := notifier.Notify(anomaly); err != nil {
+				log.Println("Error notifying vote anomaly:", err)
+			}
+		}
+	}(*anomaly)
+
+	return nil
+}
+
+// GetAnomalies lists the detected anomalies, most recent first, optionally
+// only those of the cryptocurrency given by the crypto_id parameter.
+func (s *AnomalyService) GetAnomalies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	sqlQuery := "SELECT id, crypto_id, window_start, votes, expected, z_score, detected_at FROM anomalies"
+	var args []interface{}
+
+	if value := query.Get("crypto_id"); value != "" {
+		cryptoID, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid crypto_id parameter", http.StatusBadRequest)
+			return
+		}
+		sqlQuery += " WHERE crypto_id = ?"
+		args = append(args, cryptoID)
+	}
+
+	limit := defaultAnomalyPageSize
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAnomalyPageSize {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sqlQuery += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting anomalies", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	anomalies := []Anomaly{}
+	for rows.Next() {
+		var anomaly Anomaly
+		if err := rows.Scan(&anomaly.ID, &anomaly.CryptoID, &anomaly.WindowStart, &anomaly.Votes, &anomaly.Expected, &anomaly.ZScore, &anomaly.DetectedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting anomalies", http.StatusInternalServerError)
+			return
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting anomalies", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(anomalies)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type notifierFunc func(anomaly Anomaly) error
+
+func (f notifierFunc) Notify(anomaly Anomaly) error {
+	return f(anomaly)
+}
+
+func TestRaiseAnomaly(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	anomalyService := NewAnomalyService(db, NewAnomalyDetector(AnomalyDetectorConfig{Alpha: 0.1, ZScoreThreshold: 3, MinVotes: 3}))
+
+	notified := make(chan Anomaly, 1)
+	anomalyService.AddNotifier(notifierFunc(func(anomaly Anomaly) error {
+		notified <- anomaly
+		return nil
+	}))
+
+	// The third vote in a minute of a new cryptocurrency is a spike
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec("INSERT INTO anomalies").
+		WithArgs(1, now, 3, 0.0, 3.0, now).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+
+	for vote := 0; vote < 3; vote++ {
+		anomalyService.ObserveVote(1, "up", now)
+	}
+
+	select {
+	case anomaly := <-notified:
+		assert.Equal(t, 7, anomaly.ID)
+		assert.Equal(t, 3, anomaly.Votes)
+	case <-time.After(time.Second):
+		t.Fatal("anomaly was not notified")
+	}
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadAnomalyDetector(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	anomalyService := NewAnomalyService(db, NewAnomalyDetector(AnomalyDetectorConfig{Alpha: 0.1, ZScoreThreshold: 3, MinVotes: 3}))
+
+	// The last two hours of vote history are loaded
+	now := time.Date(2026, 3, 8, 12, 0, 30, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"crypto_id", "bucket_start", "votes"})
+	for minute := 0; minute < 60; minute++ {
+		rows.AddRow(1, now.Truncate(time.Minute).Add(time.Duration(minute-60)*time.Minute), 10)
+	}
+	mock.ExpectQuery("SELECT crypto_id, bucket_start, up_vote \\+ down_vote FROM vote_buckets WHERE bucket_start >= \\? ORDER BY crypto_id, bucket_start").
+		WithArgs(now.Add(-2 * time.Hour).Truncate(time.Minute)).
+		WillReturnRows(rows)
+
+	err = anomalyService.Load(now)
+	assert.NoError(t, err)
+
+	// Ten votes a minute is the usual activity, nothing is raised
+	for vote := 0; vote < 10; vote++ {
+		assert.Nil(t, anomalyService.detector.Observe(1, now))
+	}
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Anomaly
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer receiver.Close()
+
+	anomaly := Anomaly{ID: 3, CryptoID: 1, Votes: 40, Expected: 5, ZScore: 9.5}
+	assert.NoError(t, NewWebhookNotifier(receiver.URL).Notify(anomaly))
+	assert.Equal(t, anomaly, received)
+
+	// Receivers failing the delivery are reported
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	assert.Error(t, NewWebhookNotifier(failing.URL).Notify(anomaly))
+}
+
+func TestGetAnomalies(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	anomalyService := NewAnomalyService(db, NewAnomalyDetector(DefaultAnomalyDetectorConfig()))
+	windowStart := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	// Set the expectations for listing the anomalies of one cryptocurrency
+	mock.ExpectQuery("FROM anomalies WHERE crypto_id = \\? ORDER BY id DESC LIMIT \\?").
+		WithArgs(1, 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "crypto_id", "window_start", "votes", "expected", "z_score", "detected_at"}).
+			AddRow(7, 1, windowStart, 45, 5.2, 8.1, windowStart.Add(20*time.Second)))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/anomalies?crypto_id=1", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/anomalies", anomalyService.GetAnomalies).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"id":7,"crypto_id":1,"window_start":"2026-03-08T12:00:00Z","votes":45`)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
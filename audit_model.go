@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionCreate      = "crypto.create"
+	AuditActionDelete      = "crypto.delete"
+	AuditActionRestore     = "crypto.restore"
+	AuditActionMerge       = "crypto.merge"
+	AuditActionAliasAdd    = "crypto.alias.add"
+	AuditActionAliasRemove = "crypto.alias.remove"
+	AuditActionTagAdd      = "crypto.tag.add"
+	AuditActionTagRemove   = "crypto.tag.remove"
+	AuditActionVoteAccept  = "vote.approve"
+	AuditActionVoteReject  = "vote.reject"
+
+	AuditActionPollCreate          = "poll.create"
+	AuditActionPollCandidateAdd    = "poll.candidate.add"
+	AuditActionPollCandidateRemove = "poll.candidate.remove"
+	AuditActionPollSnapshotImport  = "poll.snapshot.import"
+	AuditActionWalletVerify        = "voter.wallet.verify"
+
+	AuditActionWebhookCreate = "webhook.create"
+	AuditActionWebhookDelete = "webhook.delete"
+	AuditActionWebhookRetry  = "webhook.delivery.retry"
+)
+
+type AuditEntry struct {
+	ID        int             `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	TargetID  int             `json:"target_id"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	RequestID string          `json:"request_id"`
+	ClientIP  string          `json:"client_ip"`
+	CreatedAt time.Time       `json:"created_at"`
+}
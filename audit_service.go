@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxAuditPageSize = 1000
+
+// AuditService keeps an append-only trail of mutating operations. Entries are
+// only ever inserted; there is no endpoint to change or remove them.
+type AuditService struct {
+	db Database
+}
+
+func NewAuditService(db *sql.DB) *AuditService {
+	return &AuditService{
+		db: db,
+	}
+}
+
+// Record appends an entry for the action performed by the request, in the
+// transaction of the action so that both are committed or neither is. The
+// before and after values are stored as JSON, nil meaning the target did not
+// exist. A failed write must fail the action. A nil AuditService records
+// nothing.
+func (s *AuditService) Record(tx executor, r *http.Request, action string, targetID int, before, after interface{}) error {
+	if s == nil {
+		return nil
+	}
+
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO audit_log (actor, action, target_id, before_value, after_value, request_id, client_ip, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		actor(r), action, targetID, string(beforeJSON), string(afterJSON), requestID(r), clientIP(r), time.Now().UTC())
+	return err
+}
+
+// GetAuditLog lists audit entries, optionally filtered by the from and to
+// RFC 3339 times, the action and the target ID.
+func (s *AuditService) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var conditions []string
+	var args []interface{}
+
+	query := r.URL.Query()
+
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from time", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, from.UTC())
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid to time", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, to.UTC())
+	}
+
+	if value := query.Get("action"); value != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, value)
+	}
+
+	if value := query.Get("target_id"); value != "" {
+		targetID, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid target ID", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, targetID)
+	}
+
+	limit := maxAuditPageSize
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditPageSize {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sqlQuery := "SELECT id, actor, action, target_id, before_value, after_value, request_id, client_ip, created_at FROM audit_log"
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sqlQuery += " ORDER BY id LIMIT ?"
+	args = append(args, limit)
+
+	entries := []AuditEntry{}
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting audit log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after string
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.TargetID, &before, &after,
+			&entry.RequestID, &entry.ClientIP, &entry.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting audit log", http.StatusInternalServerError)
+			return
+		}
+		entry.Before = json.RawMessage(before)
+		entry.After = json.RawMessage(after)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting audit log", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteCryptoCurrencyWithAuditLog(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+
+	// Delete the cryptocurrency as the admin or through the public route, the
+	// audit entry is written in the transaction of the delete
+	deleteCryptoCurrency := func(t *testing.T, actor string, auditErr error) *httptest.ResponseRecorder {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		cryptoService := NewCryptoCurrencyService(db)
+		cryptoService.EnableAuditLog(NewAuditService(db))
+		cryptoID := 1
+
+		// Set the expectations for the count query and the snapshot of the deleted values
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+			WithArgs(cryptoID).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE id=?").
+			WithArgs(cryptoID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).AddRow(1, "Bitcoin", 100, 20, 120))
+
+		// Set the expectations for the delete and the audit entry
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET deleted_at = UTC_TIMESTAMP\\(\\) WHERE id = ?").
+			WithArgs(cryptoID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		audit := mock.ExpectExec("INSERT INTO audit_log").
+			WithArgs(actor, AuditActionDelete, cryptoID,
+				`{"id":1,"name":"Bitcoin","up_vote":100,"down_vote":20,"total_votes":120}`, "null",
+				"req-1", "192.0.2.1", sqlmock.AnyArg())
+		if auditErr != nil {
+			audit.WillReturnError(auditErr)
+			mock.ExpectRollback()
+		} else {
+			audit.WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+		}
+
+		// Create a new request and recorder for testing the handler, the voter
+		// header doesn't change the actor
+		req, err := http.NewRequest("DELETE", "/v1/cryptovote/1", nil)
+		assert.NoError(t, err)
+		req.RemoteAddr = "192.0.2.1:5555"
+		req.Header.Set("X-Request-ID", "req-1")
+		req.Header.Set("X-Voter-ID", "someone-else")
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.Use(requestIDMiddleware)
+		if actor == "admin" {
+			req.Header.Set("Authorization", "Bearer secret")
+			r.Handle("/v1/cryptovote/{id:[0-9]+}", requireAdminMiddleware(http.HandlerFunc(cryptoService.DeleteCryptoCurrency))).Methods("DELETE")
+		} else {
+			r.HandleFunc("/v1/cryptovote/{id:[0-9]+}", cryptoService.DeleteCryptoCurrency).Methods("DELETE")
+		}
+		r.ServeHTTP(rr, req)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+		return rr
+	}
+
+	t.Run("Recorded", func(t *testing.T) {
+		rr := deleteCryptoCurrency(t, "admin", nil)
+
+		// Check the response status code and the echoed request ID
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "req-1", rr.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("RecordedAsAnonymous", func(t *testing.T) {
+		// The public route is recorded as anonymous with the client IP
+		rr := deleteCryptoCurrency(t, "anonymous", nil)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("FailedAuditWriteFailsTheDelete", func(t *testing.T) {
+		rr := deleteCryptoCurrency(t, "admin", errors.New("database error"))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestGetAuditLog(t *testing.T) {
+	t.Run("FilterByTimeRange", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		auditService := NewAuditService(db)
+		from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+		rows := sqlmock.NewRows([]string{"id", "actor", "action", "target_id", "before_value", "after_value", "request_id", "client_ip", "created_at"}).
+			AddRow(1, "admin", AuditActionCreate, 5, "null", `{"id":5,"name":"Dogecoin"}`, "req-1", "192.0.2.1", from.Add(time.Hour))
+		mock.ExpectQuery("SELECT .* FROM audit_log WHERE created_at >= \\? AND created_at < \\? AND action = \\? ORDER BY id LIMIT \\?").
+			WithArgs(from, to, AuditActionCreate, maxAuditPageSize).
+			WillReturnRows(rows)
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("GET", "/v1/admin/audit?from=2026-01-01T00:00:00Z&to=2026-01-02T00:00:00Z&action=crypto.create", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/audit", auditService.GetAuditLog).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var entries []AuditEntry
+		err = json.Unmarshal(rr.Body.Bytes(), &entries)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "admin", entries[0].Actor)
+		assert.JSONEq(t, `{"id":5,"name":"Dogecoin"}`, string(entries[0].After))
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("InvalidTime", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		auditService := NewAuditService(db)
+
+		req, err := http.NewRequest("GET", "/v1/admin/audit?from=yesterday", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		auditService.GetAuditLog(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import "time"
+
+// Ballot is a ranked-choice ballot: the cryptocurrencies of a poll ordered
+// from the most to the least preferred. Candidates left out are not ranked.
+type Ballot struct {
+	ID        int       `json:"id"`
+	PollID    int       `json:"poll_id"`
+	VoterID   string    `json:"voter_id"`
+	Ranking   []int     `json:"ranking"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InstantRunoffRound holds the first-preference counts of the candidates
+// still in the race. Exhausted counts the ballots ranking none of them.
+type InstantRunoffRound struct {
+	Round      int         `json:"round"`
+	Counts     map[int]int `json:"counts"`
+	Exhausted  int         `json:"exhausted"`
+	Eliminated int         `json:"eliminated,omitempty"`
+}
+
+type InstantRunoffResult struct {
+	PollID  int                  `json:"poll_id"`
+	Ballots int                  `json:"ballots"`
+	Winner  *int                 `json:"winner"`
+	Rounds  []InstantRunoffRound `json:"rounds"`
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SubmitBallot stores a ranked-choice ballot for the poll. Voters sign the
+// request with their registered key, see RequireVoter, and cast a single
+// ballot per poll.
+func (s *PollService) SubmitBallot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	// Ballots are only accepted between the opening and closing times
+	if !checkVotingWindow(w, poll) {
+		return
+	}
+
+	voter, ok := authenticatedVoter(r)
+	if !ok {
+		http.Error(w, "Voter authentication is required to cast a ballot", http.StatusUnauthorized)
+		return
+	}
+	ballot := Ballot{PollID: poll.ID, VoterID: voter}
+
+	var request struct {
+		Ranking []int `json:"ranking"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	ballot.Ranking = request.Ranking
+
+	if len(ballot.Ranking) == 0 {
+		http.Error(w, "Ranking cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	candidates, err := s.getCandidateIDs(poll.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting ballot", http.StatusInternalServerError)
+		return
+	}
+
+	isCandidate := make(map[int]bool, len(candidates))
+	for _, candidate := range candidates {
+		isCandidate[candidate] = true
+	}
+
+	ranked := make(map[int]bool, len(ballot.Ranking))
+	for _, cryptoID := range ballot.Ranking {
+		if !isCandidate[cryptoID] {
+			http.Error(w, "Ranking contains a cryptocurrency that is not a candidate of this poll", http.StatusBadRequest)
+			return
+		}
+		if ranked[cryptoID] {
+			http.Error(w, "Ranking cannot contain a cryptocurrency twice", http.StatusBadRequest)
+			return
+		}
+		ranked[cryptoID] = true
+	}
+
+	// Check if the voter already cast a ballot in this poll
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM poll_ballots WHERE poll_id = ? AND voter_id = ?", poll.ID, ballot.VoterID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting ballot", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Voter already cast a ballot in this poll", http.StatusConflict)
+		return
+	}
+
+	ranking, err := json.Marshal(ballot.Ranking)
+	if err != nil {
+		log.Println("Error encoding ranking:", err)
+		http.Error(w, "Error casting ballot", http.StatusInternalServerError)
+		return
+	}
+
+	ballot.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	result, err := s.db.Exec("INSERT INTO poll_ballots (poll_id, voter_id, ranking, created_at) VALUES (?, ?, ?, ?)",
+		ballot.PollID, ballot.VoterID, string(ranking), ballot.CreatedAt)
+	if isDuplicateKeyError(err) {
+		// A concurrent request cast the voter's ballot first
+		http.Error(w, "Voter already cast a ballot in this poll", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error casting ballot", http.StatusInternalServerError)
+		return
+	}
+
+	lastInsertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error getting last insert ID:", err)
+		http.Error(w, "Error casting ballot", http.StatusInternalServerError)
+		return
+	}
+
+	ballot.ID = int(lastInsertID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ballot)
+}
+
+// GetInstantRunoffTally runs the instant-runoff elimination over the ballots
+// of the poll and returns the result of every round.
+func (s *PollService) GetInstantRunoffTally(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	candidates, err := s.getCandidateIDs(poll.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error tallying ballots", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := s.db.Query("SELECT ranking FROM poll_ballots WHERE poll_id = ? ORDER BY id", poll.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error tallying ballots", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var ballots [][]int
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error tallying ballots", http.StatusInternalServerError)
+			return
+		}
+
+		var ranking []int
+		if err := json.Unmarshal([]byte(encoded), &ranking); err != nil {
+			log.Println("Error decoding ranking:", err)
+			http.Error(w, "Error tallying ballots", http.StatusInternalServerError)
+			return
+		}
+		ballots = append(ballots, ranking)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error tallying ballots", http.StatusInternalServerError)
+		return
+	}
+
+	result := InstantRunoffResult{PollID: poll.ID, Ballots: len(ballots)}
+	result.Rounds, result.Winner = runInstantRunoff(candidates, ballots)
+	if result.Rounds == nil {
+		result.Rounds = []InstantRunoffRound{}
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *PollService) getCandidateIDs(pollID int) ([]int, error) {
+	var candidates []int
+
+	rows, err := s.db.Query(`SELECT pc.crypto_id FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL ORDER BY pc.crypto_id`, pollID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cryptoID int
+		if err := rows.Scan(&cryptoID); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, cryptoID)
+	}
+
+	return candidates, rows.Err()
+}
+
+// rewriteBallots locks the ballots ranking the cryptocurrency and stores the
+// rankings returned by rewrite, in the caller's transaction.
+func rewriteBallots(tx interface {
+	queryer
+	executor
+}, cryptoID int, rewrite func(ranking []int) []int) error {
+	rows, err := tx.Query("SELECT id, ranking FROM poll_ballots WHERE JSON_CONTAINS(ranking, ?) FOR UPDATE", strconv.Itoa(cryptoID))
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	var rankings [][]int
+	for rows.Next() {
+		var id int
+		var encoded string
+		if err := rows.Scan(&id, &encoded); err != nil {
+			rows.Close()
+			return err
+		}
+
+		var ranking []int
+		if err := json.Unmarshal([]byte(encoded), &ranking); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+		rankings = append(rankings, rewrite(ranking))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, ranking := range rankings {
+		encoded, err := json.Marshal(ranking)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE poll_ballots SET ranking = ? WHERE id = ?", string(encoded), ids[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeFromRanking returns the ranking without the cryptocurrency, the
+// choices ranked below it move up one place.
+func removeFromRanking(ranking []int, cryptoID int) []int {
+	removed := make([]int, 0, len(ranking))
+	for _, ranked := range ranking {
+		if ranked != cryptoID {
+			removed = append(removed, ranked)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmitBallot(t *testing.T) {
+	t.Run("ValidBallot", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		// Set the expectations for the poll, its candidates, the duplicate check and the insert
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, nil, 0, nil, nil, time.Now()))
+		mock.ExpectQuery("SELECT pc.crypto_id FROM poll_candidates pc").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"crypto_id"}).AddRow(3).AddRow(5).AddRow(8))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_ballots WHERE poll_id = \\? AND voter_id = \\?").
+			WithArgs(1, "7").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec("INSERT INTO poll_ballots \\(poll_id, voter_id, ranking, created_at\\)").
+			WithArgs(1, "7", "[5,3]", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(9, 1))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/polls/1/ballots", strings.NewReader(`{"ranking": [5, 3]}`))
+		assert.NoError(t, err)
+		req = withVoter(req, "7")
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/ballots", pollService.SubmitBallot).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"ranking":[5,3]`)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DuplicateRanking", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, nil, 0, nil, nil, time.Now()))
+		mock.ExpectQuery("SELECT pc.crypto_id FROM poll_candidates pc").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"crypto_id"}).AddRow(3).AddRow(5))
+
+		req, err := http.NewRequest("POST", "/v1/polls/1/ballots", strings.NewReader(`{"ranking": [5, 3, 5]}`))
+		assert.NoError(t, err)
+		req = withVoter(req, "7")
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/ballots", pollService.SubmitBallot).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetInstantRunoffTally(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+
+	mock.ExpectQuery("FROM polls WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, nil, 0, nil, nil, time.Now()))
+	mock.ExpectQuery("SELECT pc.crypto_id FROM poll_candidates pc").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id"}).AddRow(3).AddRow(5).AddRow(8))
+	mock.ExpectQuery("SELECT ranking FROM poll_ballots WHERE poll_id = \\? ORDER BY id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"ranking"}).
+			AddRow("[3]").
+			AddRow("[5]").
+			AddRow("[8, 5]"))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/polls/1/tally/instant-runoff", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/polls/{pollId:[0-9]+}/tally/instant-runoff", pollService.GetInstantRunoffTally).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"poll_id": 1,
+		"ballots": 3,
+		"winner": 5,
+		"rounds": [
+			{"round": 1, "counts": {"3": 1, "5": 1, "8": 1}, "exhausted": 0, "eliminated": 8},
+			{"round": 2, "counts": {"3": 1, "5": 2}, "exhausted": 0}
+		]
+	}`, rr.Body.String())
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
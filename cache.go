@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Keys of the cached catalog and leaderboard reads. They hold vote counts, so
+// they are invalidated whenever a cryptocurrency or its votes change.
+const (
+	cacheKeyCatalog     = "cryptovote:catalog"
+	cacheKeyLeaderboard = "cryptovote:leaderboard"
+)
+
+var catalogCacheKeys = []string{cacheKeyCatalog, cacheKeyLeaderboard}
+
+// Cache stores encoded values by key until they expire. LRUCache keeps them in
+// process, a Redis client can implement it to share them between instances.
+type Cache interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRUCache is an in-process Cache holding up to capacity values, evicting the
+// least recently used one when full.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (c *LRUCache) Delete(keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.entries[key]; ok {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
+
+// errLoadPanicked is returned to the callers waiting for a load that
+// panicked. The panic itself propagates to the caller that ran the load.
+var errLoadPanicked = errors.New("cache load panicked")
+
+// flight is a load in progress, shared by every caller of its key.
+type flight struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// flightGroup runs one load per key at a time. Callers asking for a key that
+// is being loaded wait for that load instead of starting their own.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+func (g *flightGroup) Do(key string, load func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		<-f.done
+		return f.value, f.err
+	}
+
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	// Release the waiters and the key even if the load panics
+	loaded := false
+	defer func() {
+		if !loaded {
+			f.err = errLoadPanicked
+		}
+		close(f.done)
+
+		g.mu.Lock()
+		if g.flights[key] == f {
+			delete(g.flights, key)
+		}
+		g.mu.Unlock()
+	}()
+
+	f.value, f.err = load()
+	loaded = true
+
+	return f.value, f.err
+}
+
+// CacheStats counts the reads served from the cache and the loads it saved.
+// Misses are the reads not found in the cache, loads the reads of the
+// database they caused, fewer when concurrent misses share a load.
+type CacheStats struct {
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	Loads    uint64  `json:"loads"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// ReadThroughCache serves reads from the cache and loads the missing ones,
+// once per key however many requests miss it at the same time. A nil
+// ReadThroughCache loads every read.
+type ReadThroughCache struct {
+	cache Cache
+	ttl   time.Duration
+	group flightGroup
+
+	// Incremented by every invalidation, so a load that raced one is not
+	// stored. The mutex makes storing a load and invalidating its key
+	// exclusive, so a load cannot be stored once it was invalidated.
+	mu         sync.Mutex
+	generation uint64
+	// Time of the last invalidation caused by a vote
+	voteInvalidatedAt time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	loads  atomic.Uint64
+}
+
+func NewReadThroughCache(cache Cache, ttl time.Duration) *ReadThroughCache {
+	return &ReadThroughCache{
+		cache: cache,
+		ttl:   ttl,
+	}
+}
+
+// Get returns the cached value of the key, or loads and caches it. Errors of
+// the cache are logged and the value is loaded instead.
+func (c *ReadThroughCache) Get(key string, load func() ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return load()
+	}
+
+	value, ok, err := c.cache.Get(key)
+	if err != nil {
+		log.Println("Error reading cache:", err)
+	}
+	if ok {
+		c.hits.Add(1)
+		return value, nil
+	}
+	c.misses.Add(1)
+
+	return c.group.Do(key, func() ([]byte, error) {
+		c.loads.Add(1)
+		c.mu.Lock()
+		generation := c.generation
+		c.mu.Unlock()
+
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.generation == generation {
+			if err := c.cache.Set(key, value, c.ttl); err != nil {
+				log.Println("Error writing cache:", err)
+			}
+		}
+		return value, nil
+	})
+}
+
+// Invalidate removes the keys from the cache. Loads in progress are still
+// shared by the reads waiting for them but are not cached, and the next reads
+// load the keys again.
+func (c *ReadThroughCache) Invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidate(keys)
+}
+
+// invalidate removes the keys with the mutex held.
+func (c *ReadThroughCache) invalidate(keys []string) {
+	c.generation++
+	if err := c.cache.Delete(keys...); err != nil {
+		log.Println("Error invalidating cache:", err)
+	}
+}
+
+// ObserveVote invalidates the catalog reads, which hold the vote counts, at
+// most once per TTL. The reads cached since the last invalidation expire
+// within a TTL of the votes they miss.
+func (c *ReadThroughCache) ObserveVote(cryptoID int, direction string, at time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.voteInvalidatedAt) < c.ttl {
+		return
+	}
+	c.voteInvalidatedAt = now
+	c.invalidate(catalogCacheKeys)
+}
+
+// ObserveVotes invalidates the catalog reads once for the votes of a flush.
+func (c *ReadThroughCache) ObserveVotes(votes []VoteCast) {
+	c.Invalidate(catalogCacheKeys...)
+}
+
+func (c *ReadThroughCache) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Loads:  c.loads.Load(),
+	}
+	if reads := stats.Hits + stats.Misses; reads > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(reads)
+	}
+	return stats
+}
+
+// GetStats returns the hit and miss counts of the cache.
+func (c *ReadThroughCache) GetStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.Stats())
+}
+
+// encodeJSON encodes the value the way json.Encoder writes responses, to
+// cache response bodies.
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+
+	assert.NoError(t, cache.Set("a", []byte("1"), time.Minute))
+	assert.NoError(t, cache.Set("b", []byte("2"), time.Minute))
+
+	// Reading a makes b the least recently used, evicted by c
+	value, ok, err := cache.Get("a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	assert.NoError(t, cache.Set("c", []byte("3"), time.Minute))
+	_, ok, _ = cache.Get("b")
+	assert.False(t, ok)
+	_, ok, _ = cache.Get("c")
+	assert.True(t, ok)
+
+	assert.NoError(t, cache.Delete("a", "missing"))
+	_, ok, _ = cache.Get("a")
+	assert.False(t, ok)
+
+	// Expired values are misses
+	assert.NoError(t, cache.Set("d", []byte("4"), -time.Second))
+	_, ok, _ = cache.Get("d")
+	assert.False(t, ok)
+}
+
+func TestReadThroughCache(t *testing.T) {
+	t.Run("HitsAndMisses", func(t *testing.T) {
+		cache := NewReadThroughCache(NewLRUCache(10), time.Minute)
+
+		loads := 0
+		load := func() ([]byte, error) {
+			loads++
+			return []byte("value"), nil
+		}
+
+		for i := 0; i < 3; i++ {
+			value, err := cache.Get("key", load)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("value"), value)
+		}
+
+		// Invalidated keys are loaded again
+		cache.Invalidate("key")
+		_, err := cache.Get("key", load)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 2, loads)
+		assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Loads: 2, HitRatio: 0.5}, cache.Stats())
+	})
+
+	t.Run("ConcurrentMissesShareALoad", func(t *testing.T) {
+		cache := NewReadThroughCache(NewLRUCache(10), time.Minute)
+
+		// The load blocks until every reader missed the key
+		release := make(chan struct{})
+		load := func() ([]byte, error) {
+			<-release
+			return []byte("value"), nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, err := cache.Get("key", load)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte("value"), value)
+			}()
+		}
+
+		// Give the last readers time to join the load after missing the key
+		assert.Eventually(t, func() bool { return cache.Stats().Misses == 10 }, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, uint64(1), cache.Stats().Loads)
+	})
+
+	t.Run("InvalidatedDuringLoad", func(t *testing.T) {
+		cache := NewReadThroughCache(NewLRUCache(10), time.Minute)
+
+		// A vote lands while the old value is being loaded, it is not cached
+		_, err := cache.Get("key", func() ([]byte, error) {
+			cache.ObserveVote(1, "up", time.Now())
+			return []byte("stale"), nil
+		})
+		assert.NoError(t, err)
+
+		value, err := cache.Get("key", func() ([]byte, error) {
+			return []byte("fresh"), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("fresh"), value)
+	})
+
+	t.Run("InvalidationKeepsTheLoad", func(t *testing.T) {
+		cache := NewReadThroughCache(NewLRUCache(10), time.Minute)
+
+		// The key is invalidated while a load is in progress
+		started := make(chan struct{})
+		release := make(chan struct{})
+		loaded := make(chan []byte)
+		go func() {
+			value, err := cache.Get("key", func() ([]byte, error) {
+				close(started)
+				<-release
+				return []byte("stale"), nil
+			})
+			assert.NoError(t, err)
+			loaded <- value
+		}()
+		<-started
+		cache.Invalidate("key")
+
+		// The next reader still shares the load instead of starting its own
+		waited := make(chan []byte)
+		go func() {
+			value, err := cache.Get("key", func() ([]byte, error) {
+				return []byte("unused"), nil
+			})
+			assert.NoError(t, err)
+			waited <- value
+		}()
+
+		assert.Eventually(t, func() bool { return cache.Stats().Misses == 2 }, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		assert.Equal(t, []byte("stale"), <-loaded)
+		assert.Equal(t, []byte("stale"), <-waited)
+		assert.Equal(t, uint64(1), cache.Stats().Loads)
+
+		// The invalidated load was not cached
+		value, err := cache.Get("key", func() ([]byte, error) {
+			return []byte("fresh"), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("fresh"), value)
+	})
+
+	t.Run("VotesInvalidateOncePerTTL", func(t *testing.T) {
+		cache := NewReadThroughCache(NewLRUCache(10), time.Minute)
+
+		loads := 0
+		load := func() ([]byte, error) {
+			loads++
+			return []byte("value"), nil
+		}
+
+		_, err := cache.Get(cacheKeyCatalog, load)
+		assert.NoError(t, err)
+
+		// The first vote invalidates the catalog, the next ones within the
+		// TTL leave the reloaded value cached until it expires
+		cache.ObserveVote(1, "up", time.Now())
+		_, err = cache.Get(cacheKeyCatalog, load)
+		assert.NoError(t, err)
+
+		cache.ObserveVote(1, "up", time.Now())
+		_, err = cache.Get(cacheKeyCatalog, load)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, loads)
+
+		// Other changes still invalidate it right away
+		cache.Invalidate(catalogCacheKeys...)
+		_, err = cache.Get(cacheKeyCatalog, load)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, loads)
+	})
+
+	t.Run("PanickingLoad", func(t *testing.T) {
+		cache := NewReadThroughCache(NewLRUCache(10), time.Minute)
+
+		// A reader joins the load before it panics
+		started := make(chan struct{})
+		release := make(chan struct{})
+		go func() {
+			defer func() { recover() }()
+			cache.Get("key", func() ([]byte, error) {
+				close(started)
+				<-release
+				panic("load failed")
+			})
+		}()
+		<-started
+
+		waited := make(chan error)
+		go func() {
+			_, err := cache.Get("key", func() ([]byte, error) {
+				return []byte("unused"), nil
+			})
+			waited <- err
+		}()
+
+		assert.Eventually(t, func() bool { return cache.Stats().Misses == 2 }, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		assert.Equal(t, errLoadPanicked, <-waited)
+
+		// The key is loaded again by the next reader
+		value, err := cache.Get("key", func() ([]byte, error) {
+			return []byte("value"), nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("value"), value)
+	})
+}
+
+func TestGetAllCryptoCurrenciesCached(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cache := NewReadThroughCache(NewLRUCache(10), time.Minute)
+	cryptoService := NewCryptoCurrencyService(db)
+	cryptoService.EnableCache(cache)
+
+	// The catalog is read once until a vote invalidates it
+	mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE deleted_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).AddRow(1, "Bitcoin", 10, 2, 12))
+	mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE deleted_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).AddRow(1, "Bitcoin", 11, 2, 13))
+
+	// Set up the router
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote", cryptoService.GetAllCryptoCurrencies).Methods("GET")
+
+	get := func() string {
+		req, err := http.NewRequest("GET", "/v1/cryptovote", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+
+	assert.JSONEq(t, `[{"id": 1, "name": "Bitcoin", "up_vote": 10, "down_vote": 2, "total_votes": 12}]`, get())
+	assert.JSONEq(t, `[{"id": 1, "name": "Bitcoin", "up_vote": 10, "down_vote": 2, "total_votes": 12}]`, get())
+
+	cache.ObserveVote(1, "up", time.Now())
+	assert.JSONEq(t, `[{"id": 1, "name": "Bitcoin", "up_vote": 11, "down_vote": 2, "total_votes": 13}]`, get())
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"container/heap"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrChallengeInvalid  = errors.New("invalid proof-of-work challenge")
+	ErrChallengeExpired  = errors.New("proof-of-work challenge expired")
+	ErrChallengeUsed     = errors.New("proof-of-work challenge already used")
+	ErrChallengeMismatch = errors.New("proof-of-work challenge issued for another cryptocurrency or poll")
+	ErrSolutionInvalid   = errors.New("proof-of-work solution does not meet the difficulty")
+)
+
+// ChallengeConfig holds the proof-of-work settings. Difficulty is the number
+// of leading zero bits required in sha256(challenge + ":" + nonce).
+type ChallengeConfig struct {
+	BaseDifficulty int
+	MaxDifficulty  int
+	TTL            time.Duration
+
+	// Every time the votes received over the last minute double past
+	// TargetVotesPerMinute the difficulty goes up by one bit.
+	TargetVotesPerMinute int
+}
+
+func DefaultChallengeConfig() ChallengeConfig {
+	return ChallengeConfig{
+		BaseDifficulty:       16,
+		MaxDifficulty:        24,
+		TTL:                  2 * time.Minute,
+		TargetVotesPerMinute: 60,
+	}
+}
+
+// Challenges are bound to the poll they were issued for: "default" for the
+// original crypto_vote counters, "poll-{id}" for the other polls. Voter
+// registrations use their own scope, with no cryptocurrency.
+const (
+	defaultChallengeScope = "default"
+	voterChallengeScope   = "voters"
+)
+
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Scope      string    `json:"scope"`
+	CryptoID   int       `json:"crypto_id"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ChallengeService issues hashcash-style puzzles for anonymous votes and
+// verifies their solutions. Challenges are signed with an HMAC so they do not
+// need to be stored; only solved challenges are kept until they expire to
+// prevent replays.
+type ChallengeService struct {
+	secret []byte
+	config ChallengeConfig
+
+	mu      sync.Mutex
+	used    expiringSet
+	traffic [60]int
+	second  int64
+}
+
+func NewChallengeService(secret []byte, config ChallengeConfig) *ChallengeService {
+	return &ChallengeService{
+		secret: secret,
+		config: config,
+	}
+}
+
+func (s *ChallengeService) GetChallenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := s.Issue(challengeScope(r), cryptoID, time.Now())
+	if err != nil {
+		http.Error(w, "Error creating challenge", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// GetVoterChallenge issues the challenge to solve for registering a voter.
+func (s *ChallengeService) GetVoterChallenge(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	challenge, err := s.Issue(voterChallengeScope, 0, time.Now())
+	if err != nil {
+		http.Error(w, "Error creating challenge", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(challenge)
+}
+
+// Issue creates a challenge bound to the poll and cryptocurrency, expiring
+// after the configured TTL, with the difficulty matching the current vote
+// traffic.
+func (s *ChallengeService) Issue(scope string, cryptoID int, now time.Time) (Challenge, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return Challenge{}, err
+	}
+
+	difficulty := s.Difficulty(now)
+	expiresAt := now.Add(s.config.TTL).UTC().Truncate(time.Second)
+	payload := fmt.Sprintf("%s.%d.%d.%d.%s", scope, cryptoID, expiresAt.Unix(), difficulty, hex.EncodeToString(salt))
+
+	return Challenge{
+		Challenge:  payload + "." + s.sign(payload),
+		Scope:      scope,
+		CryptoID:   cryptoID,
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify checks that the nonce solves the challenge for the poll and
+// cryptocurrency and marks the challenge as used. A vote that fails after
+// the check hands the challenge back with Release.
+func (s *ChallengeService) Verify(challenge, nonce, scope string, cryptoID int, now time.Time) error {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 6 {
+		return ErrChallengeInvalid
+	}
+
+	payload := strings.Join(parts[:5], ".")
+	if !hmac.Equal([]byte(parts[5]), []byte(s.sign(payload))) {
+		return ErrChallengeInvalid
+	}
+
+	challengeCryptoID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return ErrChallengeInvalid
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return ErrChallengeInvalid
+	}
+	difficulty, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return ErrChallengeInvalid
+	}
+
+	if parts[0] != scope || challengeCryptoID != cryptoID {
+		return ErrChallengeMismatch
+	}
+	if now.Unix() > expiresAt {
+		return ErrChallengeExpired
+	}
+
+	hash := sha256.Sum256([]byte(challenge + ":" + nonce))
+	if leadingZeroBits(hash[:]) < difficulty {
+		return ErrSolutionInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Forget expired challenges, they can no longer be replayed anyway
+	s.used.expire(now)
+
+	if !s.used.add(challenge, time.Unix(expiresAt, 0)) {
+		return ErrChallengeUsed
+	}
+	s.recordVote(now)
+
+	return nil
+}
+
+// Release forgets that the challenge was used, so the vote can be retried
+// with the same solution.
+func (s *ChallengeService) Release(challenge string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.used.remove(challenge)
+}
+
+// ChallengeClaim holds the solved challenge of a vote in progress. The
+// challenge is handed back when the vote fails, unless Keep was called once
+// the vote was recorded.
+type ChallengeClaim struct {
+	service   *ChallengeService
+	challenge string
+	kept      bool
+}
+
+// Keep consumes the challenge for good.
+func (c *ChallengeClaim) Keep() {
+	if c != nil {
+		c.kept = true
+	}
+}
+
+// Release hands the challenge back unless it was kept. It is meant to be
+// deferred by the vote handler.
+func (c *ChallengeClaim) Release() {
+	if c != nil && !c.kept {
+		c.service.Release(c.challenge)
+	}
+}
+
+// CheckRequest verifies the solved challenge sent in the X-PoW-Challenge and
+// X-PoW-Nonce headers of a vote request, for the poll of the route. When it
+// is missing or invalid the error response is written and false is returned.
+// A nil ChallengeService accepts every request.
+func (s *ChallengeService) CheckRequest(w http.ResponseWriter, r *http.Request, cryptoID int) (*ChallengeClaim, bool) {
+	return s.checkRequest(w, r, challengeScope(r), cryptoID)
+}
+
+// CheckVoterRegistration verifies the solved challenge sent with a voter
+// registration, like CheckRequest.
+func (s *ChallengeService) CheckVoterRegistration(w http.ResponseWriter, r *http.Request) (*ChallengeClaim, bool) {
+	return s.checkRequest(w, r, voterChallengeScope, 0)
+}
+
+func (s *ChallengeService) checkRequest(w http.ResponseWriter, r *http.Request, scope string, cryptoID int) (*ChallengeClaim, bool) {
+	if s == nil {
+		return nil, true
+	}
+
+	challenge := r.Header.Get("X-PoW-Challenge")
+	nonce := r.Header.Get("X-PoW-Nonce")
+	if challenge == "" || nonce == "" {
+		http.Error(w, "Proof-of-work challenge required", http.StatusPreconditionRequired)
+		return nil, false
+	}
+
+	if err := s.Verify(challenge, nonce, scope, cryptoID, time.Now()); err != nil {
+		http.Error(w, "Invalid proof-of-work: "+err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+
+	return &ChallengeClaim{service: s, challenge: challenge}, true
+}
+
+// challengeScope returns the scope of the challenges issued and verified on
+// the route: the poll in the pollId route variable, or the default poll.
+func challengeScope(r *http.Request) string {
+	if pollID, ok := mux.Vars(r)["pollId"]; ok {
+		return "poll-" + pollID
+	}
+	return defaultChallengeScope
+}
+
+// Difficulty returns the number of leading zero bits currently required.
+func (s *ChallengeService) Difficulty(now time.Time) int {
+	s.mu.Lock()
+	votesPerMinute := s.votesLastMinute(now)
+	s.mu.Unlock()
+
+	difficulty := s.config.BaseDifficulty
+	if s.config.TargetVotesPerMinute > 0 {
+		difficulty += int(math.Log2(1 + float64(votesPerMinute)/float64(s.config.TargetVotesPerMinute)))
+	}
+	if difficulty > s.config.MaxDifficulty {
+		difficulty = s.config.MaxDifficulty
+	}
+	return difficulty
+}
+
+// recordVote counts a vote in the per-second ring buffer. The caller must
+// hold the mutex.
+func (s *ChallengeService) recordVote(now time.Time) {
+	s.advance(now)
+	s.traffic[now.Unix()%60]++
+}
+
+// votesLastMinute sums the ring buffer. The caller must hold the mutex.
+func (s *ChallengeService) votesLastMinute(now time.Time) int {
+	s.advance(now)
+
+	total := 0
+	for _, count := range s.traffic {
+		total += count
+	}
+	return total
+}
+
+// advance clears the buckets of the seconds elapsed since the last call.
+func (s *ChallengeService) advance(now time.Time) {
+	second := now.Unix()
+	if second-s.second >= 60 {
+		s.traffic = [60]int{}
+	} else {
+		for t := s.second + 1; t <= second; t++ {
+			s.traffic[t%60] = 0
+		}
+	}
+	if second > s.second {
+		s.second = second
+	}
+}
+
+func (s *ChallengeService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func leadingZeroBits(hash []byte) int {
+	zeros := 0
+	for _, b := range hash {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// expiringSet holds keys until their expiry. Expired keys are dropped in
+// expiry order from a heap, so the cost does not grow with the number of
+// keys held.
+type expiringSet struct {
+	keys   map[string]time.Time
+	expiry expiryHeap
+}
+
+// add stores the key and returns false when it is already held.
+func (s *expiringSet) add(key string, expiresAt time.Time) bool {
+	if s.keys == nil {
+		s.keys = make(map[string]time.Time)
+	}
+	if _, ok := s.keys[key]; ok {
+		return false
+	}
+
+	s.keys[key] = expiresAt
+	heap.Push(&s.expiry, expiringKey{key: key, expiresAt: expiresAt})
+	return true
+}
+
+// remove drops the key before its expiry. Its heap entry is skipped when it
+// comes up.
+func (s *expiringSet) remove(key string) {
+	delete(s.keys, key)
+}
+
+// expire drops the keys that expired before now.
+func (s *expiringSet) expire(now time.Time) {
+	for s.expiry.Len() > 0 && now.After(s.expiry[0].expiresAt) {
+		entry := heap.Pop(&s.expiry).(expiringKey)
+		if expiresAt, ok := s.keys[entry.key]; ok && now.After(expiresAt) {
+			delete(s.keys, entry.key)
+		}
+	}
+}
+
+func (s *expiringSet) len() int {
+	return len(s.keys)
+}
+
+type expiringKey struct {
+	key       string
+	expiresAt time.Time
+}
+
+type expiryHeap []expiringKey
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiringKey)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// solveChallenge brute forces a nonce for the challenge
+func solveChallenge(challenge Challenge) string {
+	for nonce := 0; ; nonce++ {
+		hash := sha256.Sum256([]byte(challenge.Challenge + ":" + strconv.Itoa(nonce)))
+		if leadingZeroBits(hash[:]) >= challenge.Difficulty {
+			return strconv.Itoa(nonce)
+		}
+	}
+}
+
+func TestChallengeService(t *testing.T) {
+	config := ChallengeConfig{BaseDifficulty: 8, MaxDifficulty: 10, TTL: time.Minute, TargetVotesPerMinute: 2}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("VerifySolvedChallenge", func(t *testing.T) {
+		challengeService := NewChallengeService([]byte("secret"), config)
+
+		challenge, err := challengeService.Issue(defaultChallengeScope, 1, now)
+		assert.NoError(t, err)
+		assert.Equal(t, 8, challenge.Difficulty)
+
+		nonce := solveChallenge(challenge)
+		assert.NoError(t, challengeService.Verify(challenge.Challenge, nonce, defaultChallengeScope, 1, now))
+
+		// A solved challenge cannot be replayed
+		assert.Equal(t, ErrChallengeUsed, challengeService.Verify(challenge.Challenge, nonce, defaultChallengeScope, 1, now))
+	})
+
+	t.Run("ReleasedChallengeCanBeRetried", func(t *testing.T) {
+		challengeService := NewChallengeService([]byte("secret"), config)
+
+		challenge, err := challengeService.Issue("poll-3", 1, now)
+		assert.NoError(t, err)
+		nonce := solveChallenge(challenge)
+
+		// A vote that failed hands the challenge back
+		assert.NoError(t, challengeService.Verify(challenge.Challenge, nonce, "poll-3", 1, now))
+		challengeService.Release(challenge.Challenge)
+		assert.NoError(t, challengeService.Verify(challenge.Challenge, nonce, "poll-3", 1, now))
+
+		// Used challenges are forgotten once they expired
+		assert.Equal(t, 1, challengeService.used.len())
+		challengeService.used.expire(now.Add(2 * time.Minute))
+		assert.Equal(t, 0, challengeService.used.len())
+	})
+
+	t.Run("RejectInvalidChallenges", func(t *testing.T) {
+		challengeService := NewChallengeService([]byte("secret"), config)
+
+		challenge, err := challengeService.Issue(defaultChallengeScope, 1, now)
+		assert.NoError(t, err)
+		nonce := solveChallenge(challenge)
+
+		assert.Equal(t, ErrChallengeMismatch, challengeService.Verify(challenge.Challenge, nonce, defaultChallengeScope, 2, now))
+		assert.Equal(t, ErrChallengeMismatch, challengeService.Verify(challenge.Challenge, nonce, "poll-3", 1, now))
+		assert.Equal(t, ErrChallengeExpired, challengeService.Verify(challenge.Challenge, nonce, defaultChallengeScope, 1, now.Add(2*time.Minute)))
+		assert.Equal(t, ErrChallengeInvalid, challengeService.Verify(challenge.Challenge+"0", nonce, defaultChallengeScope, 1, now))
+
+		// Challenges signed with another secret are rejected
+		otherService := NewChallengeService([]byte("other"), config)
+		assert.Equal(t, ErrChallengeInvalid, otherService.Verify(challenge.Challenge, nonce, defaultChallengeScope, 1, now))
+	})
+
+	t.Run("DifficultyFollowsTraffic", func(t *testing.T) {
+		challengeService := NewChallengeService([]byte("secret"), config)
+
+		for i := 0; i < 6; i++ {
+			challenge, err := challengeService.Issue(defaultChallengeScope, 1, now)
+			assert.NoError(t, err)
+			assert.NoError(t, challengeService.Verify(challenge.Challenge, solveChallenge(challenge), defaultChallengeScope, 1, now))
+		}
+
+		// Six votes in a minute with a target of two raises the difficulty by two bits
+		assert.Equal(t, 10, challengeService.Difficulty(now))
+
+		// Once the traffic leaves the one minute window the difficulty drops back
+		assert.Equal(t, 8, challengeService.Difficulty(now.Add(time.Minute)))
+	})
+}
+
+func TestVoteHandsBackChallengeOnFailure(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	challengeService := NewChallengeService([]byte("secret"), ChallengeConfig{BaseDifficulty: 4, MaxDifficulty: 4, TTL: time.Minute})
+	cryptoService := NewCryptoCurrencyService(db)
+	cryptoService.RequireProofOfWork(challengeService)
+
+	challenge, err := challengeService.Issue(defaultChallengeScope, 1, time.Now())
+	assert.NoError(t, err)
+	nonce := solveChallenge(challenge)
+
+	// The cryptocurrency does not exist, then it does
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = \\? AND deleted_at IS NULL").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = \\? AND deleted_at IS NULL").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ 1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id, name, up_vote, down_vote").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).AddRow(1, "Bitcoin", 1, 0, 1))
+
+	// Set up the router
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/upvote", cryptoService.UpVoteCryptoCurrency).Methods("PUT")
+
+	vote := func(path string) int {
+		req, err := http.NewRequest("PUT", path, nil)
+		assert.NoError(t, err)
+		req.Header.Set("X-PoW-Challenge", challenge.Challenge)
+		req.Header.Set("X-PoW-Nonce", nonce)
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The failed vote does not burn the solution, the counted one does
+	assert.Equal(t, http.StatusNotFound, vote("/v1/cryptovote/1/upvote"))
+	assert.Equal(t, http.StatusOK, vote("/v1/cryptovote/1/upvote"))
+	assert.Equal(t, http.StatusForbidden, vote("/v1/cryptovote/1/upvote"))
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
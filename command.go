@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+const commandUsage = `usage:
+  crypto-vote-interface                         start the server
+  crypto-vote-interface rebuild [projection...] replay the event log into the projections
+  crypto-vote-interface import-tallies          seed an empty event log with the current tallies`
+
+// runCommand runs the maintenance command given on the command line instead
+// of the server.
+func runCommand(eventStore *EventStore, args []string) error {
+	switch args[0] {
+	case "rebuild":
+		replayed, err := eventStore.Rebuild(args[1:]...)
+		if err != nil {
+			return err
+		}
+		log.Println("Rebuilt projections from events:", replayed)
+		return nil
+
+	case "import-tallies":
+		if len(args) > 1 {
+			return fmt.Errorf("import-tallies takes no arguments\n%s", commandUsage)
+		}
+		imported, err := eventStore.ImportTallies()
+		if err != nil {
+			return err
+		}
+		log.Println("Imported tallies of cryptocurrencies:", imported)
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", args[0], commandUsage)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "time"
+
+// Commitment is the hidden choice of a voter in a commit-reveal poll. The
+// commitment is the hex encoded sha256 of "{crypto_id}:{salt}"; the choice is
+// only known once the voter reveals the crypto ID and salt.
+type Commitment struct {
+	PollID     int        `json:"poll_id"`
+	VoterID    string     `json:"voter_id"`
+	Commitment string     `json:"commitment"`
+	CryptoID   *int       `json:"crypto_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevealedAt *time.Time `json:"revealed_at,omitempty"`
+}
+
+type CommitRevealTallyEntry struct {
+	CryptoID int    `json:"crypto_id"`
+	Name     string `json:"name"`
+	Votes    int    `json:"votes"`
+}
+
+// CommitRevealTally counts the revealed choices. Commitments that were never
+// revealed are discarded.
+type CommitRevealTally struct {
+	PollID      int                      `json:"poll_id"`
+	Commitments int                      `json:"commitments"`
+	Revealed    int                      `json:"revealed"`
+	Discarded   int                      `json:"discarded"`
+	Results     []CommitRevealTallyEntry `json:"results"`
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var commitmentPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// minCommitmentSaltSize is the minimum number of random bytes in a salt, so a
+// commitment cannot be opened by hashing every candidate with guessed salts.
+const minCommitmentSaltSize = 16
+
+// commitmentHash returns the commitment to voting for the cryptocurrency with
+// the given salt.
+func commitmentHash(cryptoID int, salt string) string {
+	hash := sha256.Sum256([]byte(strconv.Itoa(cryptoID) + ":" + salt))
+	return hex.EncodeToString(hash[:])
+}
+
+// SubmitCommitment stores the hidden choice of the authenticated voter during
+// the commit phase of a commit-reveal poll.
+func (s *PollService) SubmitCommitment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	if poll.RevealClosesAt == nil {
+		http.Error(w, "Poll does not use commit-reveal voting", http.StatusConflict)
+		return
+	}
+
+	// Commitments are only accepted between the opening and closing times
+	if !checkVotingWindow(w, poll) {
+		return
+	}
+
+	voter, ok := authenticatedVoter(r)
+	if !ok {
+		http.Error(w, "Voter authentication is required to commit a vote", http.StatusUnauthorized)
+		return
+	}
+	commitment := Commitment{PollID: poll.ID, VoterID: voter}
+
+	var request struct {
+		Commitment string `json:"commitment"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	commitment.Commitment = strings.ToLower(request.Commitment)
+	if !commitmentPattern.MatchString(commitment.Commitment) {
+		http.Error(w, "Commitment must be a hex encoded sha256 hash", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the voter already committed in this poll
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM poll_commitments WHERE poll_id = ? AND voter_id = ?", poll.ID, commitment.VoterID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error committing vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Voter already committed a vote in this poll", http.StatusConflict)
+		return
+	}
+
+	commitment.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	_, err = s.db.Exec("INSERT INTO poll_commitments (poll_id, voter_id, commitment, created_at) VALUES (?, ?, ?, ?)",
+		commitment.PollID, commitment.VoterID, commitment.Commitment, commitment.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error committing vote", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(commitment)
+}
+
+// RevealCommitment opens the authenticated voter's commitment during the
+// reveal phase. The revealed crypto ID and the hex encoded salt of at least
+// minCommitmentSaltSize bytes must hash to the commitment.
+func (s *PollService) RevealCommitment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	if poll.RevealClosesAt == nil {
+		http.Error(w, "Poll does not use commit-reveal voting", http.StatusConflict)
+		return
+	}
+
+	if poll.Status != PollStatusRevealing {
+		http.Error(w, "Reveals are only accepted between "+poll.ClosesAt.UTC().Format(time.RFC3339)+" and "+poll.RevealClosesAt.UTC().Format(time.RFC3339), http.StatusForbidden)
+		return
+	}
+
+	voter, ok := authenticatedVoter(r)
+	if !ok {
+		http.Error(w, "Voter authentication is required to reveal a vote", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		CryptoID int    `json:"crypto_id"`
+		Salt     string `json:"salt"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.CryptoID <= 0 || request.Salt == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	salt, err := hex.DecodeString(request.Salt)
+	if err != nil || len(salt) < minCommitmentSaltSize {
+		http.Error(w, "Salt must be at least "+strconv.Itoa(minCommitmentSaltSize)+" hex encoded random bytes", http.StatusBadRequest)
+		return
+	}
+
+	commitment := Commitment{PollID: poll.ID, VoterID: voter}
+	err = s.db.QueryRow("SELECT commitment, crypto_id, created_at, revealed_at FROM poll_commitments WHERE poll_id = ? AND voter_id = ?", poll.ID, voter).
+		Scan(&commitment.Commitment, &commitment.CryptoID, &commitment.CreatedAt, &commitment.RevealedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Voter did not commit a vote in this poll", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error revealing vote", http.StatusInternalServerError)
+		return
+	}
+
+	if commitment.RevealedAt != nil {
+		http.Error(w, "Vote was already revealed", http.StatusConflict)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(commitmentHash(request.CryptoID, request.Salt)), []byte(commitment.Commitment)) != 1 {
+		http.Error(w, "Crypto ID and salt do not match the commitment", http.StatusForbidden)
+		return
+	}
+
+	// A cryptocurrency merged since the commitment counts for the survivor
+	var survivorID int
+	err = s.db.QueryRow("SELECT to_id FROM crypto_redirects WHERE from_id = ?", request.CryptoID).Scan(&survivorID)
+	if err == nil {
+		request.CryptoID = survivorID
+	} else if err != sql.ErrNoRows {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error revealing vote", http.StatusInternalServerError)
+		return
+	}
+
+	// Check if the revealed cryptocurrency is a candidate of the poll
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM poll_candidates WHERE poll_id = ? AND crypto_id = ?", poll.ID, request.CryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error revealing vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency is not a candidate of this poll", http.StatusNotFound)
+		return
+	}
+
+	revealedAt := time.Now().UTC().Truncate(time.Second)
+	commitment.CryptoID = &request.CryptoID
+	commitment.RevealedAt = &revealedAt
+
+	_, err = s.db.Exec("UPDATE poll_commitments SET crypto_id = ?, revealed_at = ? WHERE poll_id = ? AND voter_id = ?",
+		request.CryptoID, revealedAt, poll.ID, voter)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error revealing vote", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(commitment)
+}
+
+// GetCommitRevealTally counts the revealed votes of a commit-reveal poll. The
+// tally is only published once the reveal phase has ended. Once the poll is
+// finalized the votes are served from the frozen results, so later merges
+// and purges don't change them.
+func (s *PollService) GetCommitRevealTally(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	if poll.RevealClosesAt == nil {
+		http.Error(w, "Poll does not use commit-reveal voting", http.StatusNotFound)
+		return
+	}
+
+	if poll.Status != PollStatusClosed {
+		http.Error(w, "Tally is published after the reveal phase ends at "+poll.RevealClosesAt.UTC().Format(time.RFC3339), http.StatusForbidden)
+		return
+	}
+
+	tally := CommitRevealTally{PollID: poll.ID, Results: []CommitRevealTallyEntry{}}
+
+	err := s.db.QueryRow("SELECT COUNT(*), COUNT(revealed_at) FROM poll_commitments WHERE poll_id = ?", poll.ID).
+		Scan(&tally.Commitments, &tally.Revealed)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error tallying commit-reveal votes", http.StatusInternalServerError)
+		return
+	}
+	tally.Discarded = tally.Commitments - tally.Revealed
+
+	query := `SELECT pc.crypto_id, c.name, COUNT(v.voter_id) FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		LEFT JOIN poll_commitments v ON v.poll_id = pc.poll_id AND v.crypto_id = pc.crypto_id AND v.revealed_at IS NOT NULL
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL
+		GROUP BY pc.crypto_id, c.name
+		ORDER BY COUNT(v.voter_id) DESC, pc.crypto_id`
+	if poll.FinalizedAt != nil {
+		query = "SELECT crypto_id, name, up_vote FROM poll_results WHERE poll_id = ? ORDER BY `rank`"
+	}
+
+	rows, err := s.db.Query(query, poll.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error tallying commit-reveal votes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry CommitRevealTallyEntry
+		if err := rows.Scan(&entry.CryptoID, &entry.Name, &entry.Votes); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error tallying commit-reveal votes", http.StatusInternalServerError)
+			return
+		}
+		tally.Results = append(tally.Results, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error tallying commit-reveal votes", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tally)
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitmentHash(t *testing.T) {
+	assert.Equal(t, "6a866364f6be1561819c4a36c8d7e265ea268edd7b034ef7785fa9da945d9879", commitmentHash(5, "pepper"))
+}
+
+func TestCommitRevealPollStatus(t *testing.T) {
+	closesAt := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	revealClosesAt := closesAt.Add(24 * time.Hour)
+	poll := Poll{ClosesAt: &closesAt, RevealClosesAt: &revealClosesAt}
+
+	assert.Equal(t, PollStatusOpen, poll.StatusAt(closesAt.Add(-time.Second)))
+	assert.Equal(t, PollStatusRevealing, poll.StatusAt(closesAt))
+	assert.Equal(t, PollStatusClosed, poll.StatusAt(revealClosesAt))
+}
+
+func TestRevealCommitment(t *testing.T) {
+	// The poll is in its reveal phase
+	closesAt := time.Now().Add(-time.Hour)
+	revealClosesAt := time.Now().Add(time.Hour)
+	salt := "8f0e6a2d4c1b9e7f3a5d0c2e4b6f8a1d"
+
+	t.Run("MatchingReveal", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		// Set the expectations for the poll, the commitment and the reveal
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, closesAt, 0, revealClosesAt, nil, time.Now()))
+		mock.ExpectQuery("SELECT commitment, crypto_id, created_at, revealed_at FROM poll_commitments").
+			WithArgs(1, "7").
+			WillReturnRows(sqlmock.NewRows([]string{"commitment", "crypto_id", "created_at", "revealed_at"}).
+				AddRow(commitmentHash(5, salt), nil, closesAt, nil))
+		mock.ExpectQuery("SELECT to_id FROM crypto_redirects WHERE from_id = ?").
+			WithArgs(5).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_candidates WHERE poll_id = \\? AND crypto_id = \\?").
+			WithArgs(1, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("UPDATE poll_commitments SET crypto_id = \\?, revealed_at = \\?").
+			WithArgs(5, sqlmock.AnyArg(), 1, "7").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/polls/1/reveals", strings.NewReader(`{"crypto_id": 5, "salt": "`+salt+`"}`))
+		assert.NoError(t, err)
+		req = withVoter(req, "7")
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/reveals", pollService.RevealCommitment).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"crypto_id":5`)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("WrongSalt", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, closesAt, 0, revealClosesAt, nil, time.Now()))
+		mock.ExpectQuery("SELECT commitment, crypto_id, created_at, revealed_at FROM poll_commitments").
+			WithArgs(1, "7").
+			WillReturnRows(sqlmock.NewRows([]string{"commitment", "crypto_id", "created_at", "revealed_at"}).
+				AddRow(commitmentHash(5, salt), nil, closesAt, nil))
+
+		req, err := http.NewRequest("POST", "/v1/polls/1/reveals", strings.NewReader(`{"crypto_id": 6, "salt": "`+salt+`"}`))
+		assert.NoError(t, err)
+		req = withVoter(req, "7")
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/reveals", pollService.RevealCommitment).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("ShortSalt", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		// A guessable salt is rejected before the commitment is looked up
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, closesAt, 0, revealClosesAt, nil, time.Now()))
+
+		req, err := http.NewRequest("POST", "/v1/polls/1/reveals", strings.NewReader(`{"crypto_id": 5, "salt": "pepper"}`))
+		assert.NoError(t, err)
+		req = withVoter(req, "7")
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/reveals", pollService.RevealCommitment).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetCommitRevealTally(t *testing.T) {
+	t.Run("DuringRevealPhase", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		// Nothing is counted before the reveal phase ends
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, time.Now().Add(-time.Hour), 0, time.Now().Add(time.Hour), nil, time.Now()))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("GET", "/v1/polls/1/tally/commit-reveal", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/tally/commit-reveal", pollService.GetCommitRevealTally).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("AfterRevealPhase", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, time.Now().Add(-2*time.Hour), 0, time.Now().Add(-time.Hour), nil, time.Now()))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\), COUNT\\(revealed_at\\) FROM poll_commitments").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"commitments", "revealed"}).AddRow(4, 3))
+		mock.ExpectQuery("LEFT JOIN poll_commitments v ON .* AND v.revealed_at IS NOT NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "votes"}).
+				AddRow(5, "Arbitrum", 2).
+				AddRow(6, "Optimism", 1))
+
+		req, err := http.NewRequest("GET", "/v1/polls/1/tally/commit-reveal", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/tally/commit-reveal", pollService.GetCommitRevealTally).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{
+			"poll_id": 1,
+			"commitments": 4,
+			"revealed": 3,
+			"discarded": 1,
+			"results": [
+				{"crypto_id": 5, "name": "Arbitrum", "votes": 2},
+				{"crypto_id": 6, "name": "Optimism", "votes": 1}
+			]
+		}`, rr.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Finalized", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Next listing", "", "public", nil, time.Now().Add(-2*time.Hour), 0, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour), time.Now()))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\), COUNT\\(revealed_at\\) FROM poll_commitments").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"commitments", "revealed"}).AddRow(4, 3))
+		// The frozen standings are served, not the live commitments
+		mock.ExpectQuery("SELECT crypto_id, name, up_vote FROM poll_results WHERE poll_id = \\? ORDER BY `rank`").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "up_vote"}).
+				AddRow(5, "Arbitrum", 2).
+				AddRow(6, "Optimism", 1))
+
+		req, err := http.NewRequest("GET", "/v1/polls/1/tally/commit-reveal", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/tally/commit-reveal", pollService.GetCommitRevealTally).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{
+			"poll_id": 1,
+			"commitments": 4,
+			"revealed": 3,
+			"discarded": 1,
+			"results": [
+				{"crypto_id": 5, "name": "Arbitrum", "votes": 2},
+				{"crypto_id": 6, "name": "Optimism", "votes": 1}
+			]
+		}`, rr.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
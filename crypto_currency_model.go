@@ -6,4 +6,17 @@ type CryptoCurrency struct {
 	UpVote     int    `json:"up_vote"`
 	DownVote   int    `json:"down_vote"`
 	TotalVotes int    `json:"total_votes"`
+
+	// Only filled in by the lookups that return aliases
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+type CryptoCurrencyMerge struct {
+	MergedID           int            `json:"merged_id"`
+	Survivor           CryptoCurrency `json:"survivor"`
+	MovedUpVotes       int            `json:"moved_up_votes"`
+	MovedDownVotes     int            `json:"moved_down_votes"`
+	DuplicateUpVotes   int            `json:"duplicate_up_votes"`
+	DuplicateDownVotes int            `json:"duplicate_down_votes"`
+	RejectedVotes      int            `json:"rejected_votes"`
 }
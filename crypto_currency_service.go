@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -14,12 +16,36 @@ type Database interface {
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	QueryRow(query string, args ...interface{}) *sql.Row
 	Exec(query string, args ...interface{}) (sql.Result, error)
+	Begin() (*sql.Tx, error)
 	Ping() error
 	Close() error
 }
 
+// queryer runs queries on the database or in a transaction.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// rowQueryer reads a single row from the database or in a transaction.
+type rowQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// executor runs statements on the database or in a transaction.
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 type CryptoCurrencyService struct {
-	db Database
+	db         Database
+	analyzer   *VoteAnalyzer
+	challenges *ChallengeService
+	audit      *AuditService
+	observers  voteObservers
+	webhooks   *WebhookService
+	events     eventSinks
+	batcher    *VoteBatcher
+	cache      *ReadThroughCache
 }
 
 func NewCryptoCurrencyService(db *sql.DB) *CryptoCurrencyService {
@@ -28,36 +54,116 @@ func NewCryptoCurrencyService(db *sql.DB) *CryptoCurrencyService {
 	}
 }
 
+// EnableVoteScreening records every vote as a vote event and runs it through
+// the analyzer. Suspicious votes are quarantined instead of being counted.
+func (s *CryptoCurrencyService) EnableVoteScreening(analyzer *VoteAnalyzer) {
+	s.analyzer = analyzer
+}
+
+// RequireProofOfWork makes the vote endpoints accept only votes carrying a
+// solved challenge in the X-PoW-Challenge and X-PoW-Nonce headers.
+func (s *CryptoCurrencyService) RequireProofOfWork(challenges *ChallengeService) {
+	s.challenges = challenges
+}
+
+// EnableAuditLog records creations and deletions in the audit log.
+func (s *CryptoCurrencyService) EnableAuditLog(audit *AuditService) {
+	s.audit = audit
+}
+
+// EnableWebhooks publishes vote milestones to the webhook subscriptions.
+// Catalog changes reach them through the outbox, see WebhookEventPublisher.
+func (s *CryptoCurrencyService) EnableWebhooks(webhooks *WebhookService) {
+	s.webhooks = webhooks
+}
+
+// AddEventSinks records creations, deletions, restorations and votes as
+// domain events in the sinks, in the same transaction as the change.
+func (s *CryptoCurrencyService) AddEventSinks(sinks ...EventSink) {
+	s.events = append(s.events, sinks...)
+}
+
+// EnableCache serves the catalog from the cache and invalidates it when a
+// cryptocurrency is created, deleted or restored. Votes invalidate it through
+// the cache's vote observer.
+func (s *CryptoCurrencyService) EnableCache(cache *ReadThroughCache) {
+	s.cache = cache
+}
+
+// AddVoteObserver notifies the observer of every counted vote.
+func (s *CryptoCurrencyService) AddVoteObserver(observer VoteObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+// StartVoteBatching writes anonymous votes behind, flushing them every
+// interval, and returns the batcher to close on shutdown. The flushes use the
+// event sinks, vote observers and webhooks enabled before it is started.
+func (s *CryptoCurrencyService) StartVoteBatching(interval time.Duration) *VoteBatcher {
+	s.batcher = newVoteBatcher(s.db, s.events, s.observers, s.webhooks)
+	s.batcher.start(interval)
+	return s.batcher
+}
+
 func (s *CryptoCurrencyService) GetAllCryptoCurrencies(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	cryptoCurrencies := []CryptoCurrency{}
+	query := "SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE deleted_at IS NULL"
+	var args []interface{}
+
+	// Scope the list to a category when a tag is given, ranked by net votes
+	tag := r.URL.Query().Get("tag")
+	if tag != "" {
+		query = `SELECT c.id, c.name, c.up_vote, c.down_vote, (c.up_vote + c.down_vote) as total_votes FROM crypto_vote c
+			JOIN crypto_tags ct ON ct.crypto_id = c.id JOIN tags t ON t.id = ct.tag_id
+			WHERE c.deleted_at IS NULL AND t.name = ?
+			ORDER BY (c.up_vote - c.down_vote) DESC, c.id`
+		args = append(args, strings.ToLower(tag))
+	}
 
-	rows, err := s.db.Query("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote")
+	load := func() ([]byte, error) {
+		cryptoCurrencies, err := s.listCryptoCurrencies(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		return encodeJSON(cryptoCurrencies)
+	}
+
+	// Only the whole catalog is cached, the categories are read directly
+	var body []byte
+	var err error
+	if tag == "" {
+		body, err = s.cache.Get(cacheKeyCatalog, load)
+	} else {
+		body, err = load()
+	}
 	if err != nil {
 		log.Println("Error querying database:", err)
 		http.Error(w, "Error getting cryptocurrencies", http.StatusInternalServerError)
 		return
 	}
+
+	w.Write(body)
+}
+
+// listCryptoCurrencies runs the query selecting cryptocurrencies with their
+// votes.
+func (s *CryptoCurrencyService) listCryptoCurrencies(query string, args ...interface{}) ([]CryptoCurrency, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
+	cryptoCurrencies := []CryptoCurrency{}
 	for rows.Next() {
 		var crypto CryptoCurrency
 		if err := rows.Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes); err != nil {
-			log.Println("Error scanning row:", err)
-			http.Error(w, "Error getting cryptocurrencies", http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 		cryptoCurrencies = append(cryptoCurrencies, crypto)
 	}
 
-	if err := rows.Err(); err != nil {
-		log.Println("Error iterating over rows:", err)
-		http.Error(w, "Error getting cryptocurrencies", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(cryptoCurrencies)
+	return cryptoCurrencies, rows.Err()
 }
 
 func (s *CryptoCurrencyService) GetCryptoCurrencyByID(w http.ResponseWriter, r *http.Request) {
@@ -72,7 +178,7 @@ func (s *CryptoCurrencyService) GetCryptoCurrencyByID(w http.ResponseWriter, r *
 
 	// Check if the cryptocurrency exists in the database
 	var count int
-	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ?", cryptoID).Scan(&count)
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", cryptoID).Scan(&count)
 	if err != nil {
 		log.Println("Error querying database:", err)
 		http.Error(w, "Error getting cryptocurrency", http.StatusInternalServerError)
@@ -80,13 +186,26 @@ func (s *CryptoCurrencyService) GetCryptoCurrencyByID(w http.ResponseWriter, r *
 	}
 
 	if count == 0 {
+		// Merged cryptocurrencies redirect to the one they were merged into
+		var survivorID int
+		err = s.db.QueryRow("SELECT to_id FROM crypto_redirects WHERE from_id = ?", cryptoID).Scan(&survivorID)
+		if err == nil {
+			http.Redirect(w, r, "/v1/cryptovote/"+strconv.Itoa(survivorID), http.StatusMovedPermanently)
+			return
+		}
+		if err != sql.ErrNoRows {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error getting cryptocurrency", http.StatusInternalServerError)
+			return
+		}
+
 		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
 		return
 	}
 
 	var crypto CryptoCurrency
 
-	err = s.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=?", cryptoID).
+	err = s.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL", cryptoID).
 		Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes)
 	if err != nil {
 		log.Println("Error querying database:", err)
@@ -137,8 +256,29 @@ func (s *CryptoCurrencyService) CreateCryptoCurrency(w http.ResponseWriter, r *h
 		return
 	}
 
+	// Check if the name is already used as an alias of another cryptocurrency
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_aliases WHERE LOWER(alias) = LOWER(?)", crypto.Name).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error creating cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Cryptocurrency with this name already exists as an alias", http.StatusConflict)
+		return
+	}
+
 	// Validation successful, insert into the database
-	result, err := s.db.Exec("INSERT INTO crypto_vote (name) VALUES (?)",
+	tx, err := s.begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error creating cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO crypto_vote (name) VALUES (?)",
 		crypto.Name)
 	if err != nil {
 		log.Println("Error inserting into database:", err)
@@ -155,6 +295,22 @@ func (s *CryptoCurrencyService) CreateCryptoCurrency(w http.ResponseWriter, r *h
 
 	crypto.ID = int(lastInsertID)
 
+	err = s.audit.Record(tx, r, AuditActionCreate, crypto.ID, nil, crypto)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error creating cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	tx.Append(DomainEventCryptoCreated, crypto.ID, crypto)
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error creating cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	s.cache.Invalidate(catalogCacheKeys...)
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(crypto)
 }
@@ -177,16 +333,31 @@ func (s *CryptoCurrencyService) voteCryptoCurrency(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Check if the cryptocurrency exists in the database
-	var count int
-	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ?", cryptoID).Scan(&count)
+	// Anonymous votes must carry a solved proof-of-work challenge, which is
+	// handed back unless the vote is recorded
+	challenge, ok := s.challenges.CheckRequest(w, r, cryptoID)
+	if !ok {
+		return
+	}
+	defer challenge.Release()
+
+	// Check if the cryptocurrency exists in the database, or among the
+	// recently voted ones when votes are batched
+	var exists bool
+	if s.batcher != nil {
+		exists, err = s.batcher.Exists(cryptoID)
+	} else {
+		var count int
+		err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", cryptoID).Scan(&count)
+		exists = count > 0
+	}
 	if err != nil {
 		log.Println("Error querying database:", err)
 		http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
 		return
 	}
 
-	if count == 0 {
+	if !exists {
 		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
 		return
 	}
@@ -203,17 +374,95 @@ func (s *CryptoCurrencyService) voteCryptoCurrency(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Update the database with the new vote count
-	_, err = s.db.Exec("UPDATE crypto_vote SET "+voteColumn+" = "+voteColumn+" + 1, total_votes = up_vote + down_vote WHERE id = ?", cryptoID)
+	// Accepted votes are recorded as vote events along with the count, so an
+	// event is never left accepted for a vote that was not counted
+	var screened *VoteEvent
+	if s.analyzer != nil {
+		event, err := s.screenVote(r, cryptoID, voteColumn)
+		if err != nil {
+			log.Println("Error screening vote:", err)
+			http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
+			return
+		}
+		screened = &event
+
+		// Quarantined votes are not counted until a moderator approves them
+		if event.Status == VoteStatusQuarantined {
+			event, err = recordVoteEvent(s.db, event)
+			if err != nil {
+				log.Println("Error screening vote:", err)
+				http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
+				return
+			}
+			challenge.Keep()
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(event)
+			return
+		}
+	}
+
+	// Batched votes are written behind and answered with the projected counts
+	if s.batcher != nil {
+		crypto, err := s.batcher.Vote(cryptoID, strings.TrimSuffix(voteColumn, "_vote"), time.Now().UTC(), screened)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
+			return
+		}
+		challenge.Keep()
+
+		json.NewEncoder(w).Encode(crypto)
+		return
+	}
+
+	// Update the database with the new vote count, in a transaction with the
+	// vote event when the vote was screened
+	var tx *EventTx
+	if screened != nil {
+		tx, err = s.events.BeginTx(s.db)
+	} else {
+		tx, err = s.events.Begin(s.db)
+	}
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE crypto_vote SET "+voteColumn+" = "+voteColumn+" + 1, total_votes = up_vote + down_vote WHERE id = ?", cryptoID)
 	if err != nil {
 		log.Println("Error updating database:", err)
 		http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
 		return
 	}
 
+	if screened != nil {
+		if _, err := recordVoteEvent(tx, *screened); err != nil {
+			log.Println("Error screening vote:", err)
+			http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	vote := VoteCast{CryptoID: cryptoID, Direction: strings.TrimSuffix(voteColumn, "_vote"), Source: VoteSourceAnonymous, CastAt: time.Now().UTC()}
+	tx.Append(DomainEventVoteCast, cryptoID, vote)
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error voting for cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+	challenge.Keep()
+
+	s.observers.notify(cryptoID, vote.Direction, vote.CastAt)
+
 	// Retrieve the updated cryptocurrency
 	var crypto CryptoCurrency
-	err = s.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=?", cryptoID).
+	err = s.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL", cryptoID).
 		Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes)
 	if err != nil {
 		log.Println("Error querying database:", err)
@@ -221,6 +470,8 @@ func (s *CryptoCurrencyService) voteCryptoCurrency(w http.ResponseWriter, r *htt
 		return
 	}
 
+	s.webhooks.CheckMilestones(crypto)
+
 	json.NewEncoder(w).Encode(crypto)
 }
 
@@ -236,7 +487,7 @@ func (s *CryptoCurrencyService) DeleteCryptoCurrency(w http.ResponseWriter, r *h
 
 	// Check if the cryptocurrency exists in the database
 	var count int
-	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ?", cryptoID).Scan(&count)
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", cryptoID).Scan(&count)
 	if err != nil {
 		log.Println("Error querying database:", err)
 		http.Error(w, "Error deleting cryptocurrency", http.StatusInternalServerError)
@@ -248,13 +499,280 @@ func (s *CryptoCurrencyService) DeleteCryptoCurrency(w http.ResponseWriter, r *h
 		return
 	}
 
-	// Delete the cryptocurrency from the database
-	_, err = s.db.Exec("DELETE FROM crypto_vote WHERE id = ?", cryptoID)
+	// Keep the deleted values for the audit log and the events
+	var before CryptoCurrency
+	if s.audit != nil || len(s.events) > 0 {
+		err = s.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL", cryptoID).
+			Scan(&before.ID, &before.Name, &before.UpVote, &before.DownVote, &before.TotalVotes)
+		if err != nil {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error deleting cryptocurrency", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Move the cryptocurrency to the trash, it is purged after the retention period
+	tx, err := s.begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error deleting cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE crypto_vote SET deleted_at = UTC_TIMESTAMP() WHERE id = ?", cryptoID)
 	if err != nil {
 		log.Println("Error deleting from database:", err)
 		http.Error(w, "Error deleting cryptocurrency", http.StatusInternalServerError)
 		return
 	}
 
+	err = s.audit.Record(tx, r, AuditActionDelete, cryptoID, before, nil)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error deleting cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	tx.Append(DomainEventCryptoDeleted, cryptoID, before)
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error deleting cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	// Stop counting batched votes, other instances stop at their next flush
+	if s.batcher != nil {
+		s.batcher.Forget(cryptoID)
+	}
+
+	s.cache.Invalidate(catalogCacheKeys...)
+
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// begin starts a change of a cryptocurrency, in a transaction when the audit
+// log records it so that the entry is written with the change.
+func (s *CryptoCurrencyService) begin() (*EventTx, error) {
+	if s.audit != nil {
+		return s.events.BeginTx(s.db)
+	}
+	return s.events.Begin(s.db)
+}
+
+// screenVote analyzes the vote and returns it as a vote event with the
+// resulting status, to be recorded with recordVoteEvent.
+func (s *CryptoCurrencyService) screenVote(r *http.Request, cryptoID int, voteColumn string) (VoteEvent, error) {
+	event := VoteEvent{
+		CryptoID:  cryptoID,
+		Direction: strings.TrimSuffix(voteColumn, "_vote"),
+		VoterIP:   clientIP(r),
+		VoterID:   voterID(r),
+		Status:    VoteStatusAccepted,
+		CreatedAt: time.Now().UTC(),
+	}
+	event.VoterSubnet = subnetOf(event.VoterIP)
+
+	// Batched votes are screened cheaply, so that they are not slowed down
+	// by the queries of the analysis
+	var reasons []string
+	var err error
+	if s.batcher != nil {
+		reasons, err = s.analyzer.AnalyzeSampled(event)
+	} else {
+		reasons, err = s.analyzer.Analyze(event)
+	}
+	if err != nil {
+		return event, err
+	}
+	if len(reasons) > 0 {
+		event.Status = VoteStatusQuarantined
+		event.Reasons = joinReasons(reasons)
+	}
+
+	return event, nil
+}
+
+// recordVoteEvent stores the screened vote and returns it with its ID.
+func recordVoteEvent(exec executor, event VoteEvent) (VoteEvent, error) {
+	result, err := exec.Exec("INSERT INTO vote_events (crypto_id, direction, voter_ip, voter_subnet, voter_id, status, reasons, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		event.CryptoID, event.Direction, event.VoterIP, event.VoterSubnet, event.VoterID, event.Status, event.Reasons, event.CreatedAt)
+	if err != nil {
+		return event, err
+	}
+
+	lastInsertID, err := result.LastInsertId()
+	if err != nil {
+		return event, err
+	}
+	event.ID = int(lastInsertID)
+
+	return event, nil
+}
+
+func (s *CryptoCurrencyService) RestoreCryptoCurrency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := s.begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error restoring cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Only cryptocurrencies in the trash can be restored
+	result, err := tx.Exec("UPDATE crypto_vote SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", cryptoID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error restoring cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error restoring cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Deleted cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+
+	// Retrieve the restored cryptocurrency
+	var crypto CryptoCurrency
+	err = tx.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL", cryptoID).
+		Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionRestore, cryptoID, nil, crypto)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error restoring cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	tx.Append(DomainEventCryptoRestored, cryptoID, crypto)
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error restoring cryptocurrency", http.StatusInternalServerError)
+		return
+	}
+
+	s.cache.Invalidate(catalogCacheKeys...)
+
+	json.NewEncoder(w).Encode(crypto)
+}
+
+// PurgeDeletedCryptoCurrencies hard deletes the cryptocurrencies that have
+// been in the trash for longer than the retention period, along with their
+// aliases, tags, poll candidacies, vote history and the redirects to them.
+func (s *CryptoCurrencyService) PurgeDeletedCryptoCurrencies(retention time.Duration) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the purged rows so they can't be restored halfway through
+	rows, err := tx.Query("SELECT id FROM crypto_vote WHERE deleted_at IS NOT NULL AND deleted_at < ? FOR UPDATE", time.Now().UTC().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []interface{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// The quadratic votes for a purged cryptocurrency are refunded before
+	// they are deleted, the cost of a weight is its square
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	for _, query := range []string{
+		"DELETE FROM crypto_aliases WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM crypto_tags WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM poll_candidates WHERE crypto_id IN (" + placeholders + ")",
+		`UPDATE poll_credits c JOIN (SELECT poll_id, voter_id, SUM(weight * weight) AS cost FROM poll_quadratic_votes
+			WHERE crypto_id IN (` + placeholders + `) GROUP BY poll_id, voter_id) q ON q.poll_id = c.poll_id AND q.voter_id = c.voter_id
+			SET c.spent = c.spent - q.cost`,
+		"DELETE FROM poll_quadratic_votes WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM poll_token_votes WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM poll_commitments WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM vote_buckets WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM webhook_milestones WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM anomalies WHERE crypto_id IN (" + placeholders + ")",
+		"DELETE FROM crypto_redirects WHERE to_id IN (" + placeholders + ")",
+	} {
+		if _, err := tx.Exec(query, ids...); err != nil {
+			return 0, err
+		}
+	}
+
+	// Ballots keep ranking the other choices
+	for _, id := range ids {
+		cryptoID := id.(int)
+		err := rewriteBallots(tx, cryptoID, func(ranking []int) []int {
+			return removeFromRanking(ranking, cryptoID)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM crypto_vote WHERE id IN ("+placeholders+")", ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, tx.Commit()
+}
+
+// StartTrashPurger purges the trash every interval in the background.
+func (s *CryptoCurrencyService) StartTrashPurger(retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purged, err := s.PurgeDeletedCryptoCurrencies(retention)
+			if err != nil {
+				log.Println("Error purging deleted cryptocurrencies:", err)
+				continue
+			}
+			if purged > 0 {
+				log.Println("Purged deleted cryptocurrencies:", purged)
+			}
+		}
+	}()
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gorilla/mux"
@@ -129,6 +130,12 @@ func TestCreateCryptoCurrency(t *testing.T) {
 		WithArgs("Bitcoin").
 		WillReturnRows(rows)
 
+	// Mock the database query to check if the name is already used as an alias
+	aliasRows := sqlmock.NewRows([]string{"count"}).AddRow(0)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_aliases WHERE LOWER\\(alias\\) = LOWER\\(\\?\\)").
+		WithArgs("Bitcoin").
+		WillReturnRows(aliasRows)
+
 	// Mock the database insert to create a new cryptocurrency
 	result := sqlmock.NewResult(1, 1) // Last insert ID: 1, Rows affected: 1
 	mock.ExpectExec("INSERT INTO crypto_vote \\(name\\) VALUES \\(\\?\\)").
@@ -301,9 +308,9 @@ func TestDeleteCryptoCurrency(t *testing.T) {
 			WithArgs(cryptoID).
 			WillReturnRows(rowsCount)
 
-		// Set the expectations for the Exec call (delete cryptocurrency query)
+		// Set the expectations for the Exec call (soft delete cryptocurrency query)
 		result := sqlmock.NewResult(1, 1) // Rows affected: 1
-		mock.ExpectExec("DELETE FROM crypto_vote WHERE id = ?").
+		mock.ExpectExec("UPDATE crypto_vote SET deleted_at = UTC_TIMESTAMP\\(\\) WHERE id = ?").
 			WithArgs(cryptoID).
 			WillReturnResult(result)
 
@@ -405,8 +412,8 @@ func TestDeleteCryptoCurrency(t *testing.T) {
 			WithArgs(cryptoID).
 			WillReturnRows(rowsCount)
 
-		// Set the expectations for the Exec call (delete cryptocurrency query with error)
-		mock.ExpectExec("DELETE FROM crypto_vote WHERE id = ?").
+		// Set the expectations for the Exec call (soft delete cryptocurrency query with error)
+		mock.ExpectExec("UPDATE crypto_vote SET deleted_at = UTC_TIMESTAMP\\(\\) WHERE id = ?").
 			WithArgs(cryptoID).
 			WillReturnError(fmt.Errorf("database error"))
 
@@ -428,3 +435,188 @@ func TestDeleteCryptoCurrency(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
+
+func TestRestoreCryptoCurrency(t *testing.T) {
+	t.Run("RestoreDeletedCrypto", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		cryptoService := NewCryptoCurrencyService(db)
+		cryptoID := 1
+
+		// Set the expectations for the Exec call (restore cryptocurrency query)
+		mock.ExpectExec("UPDATE crypto_vote SET deleted_at = NULL WHERE id = \\? AND deleted_at IS NOT NULL").
+			WithArgs(cryptoID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		// Set the expectations for the QueryRow call (get restored cryptocurrency query)
+		rowsCrypto := sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).
+			AddRow(1, "Bitcoin", 100, 20, 120)
+		mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE id=\\? AND deleted_at IS NULL").
+			WithArgs(cryptoID).
+			WillReturnRows(rowsCrypto)
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/cryptovote/"+strconv.Itoa(cryptoID)+":restore", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/cryptovote/{id:[0-9]+}:restore", cryptoService.RestoreCryptoCurrency).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var restoredCrypto CryptoCurrency
+		err = json.Unmarshal(rr.Body.Bytes(), &restoredCrypto)
+		assert.NoError(t, err)
+		assert.Equal(t, CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 100, DownVote: 20, TotalVotes: 120}, restoredCrypto)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RestoreCryptoNotInTrash", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		cryptoService := NewCryptoCurrencyService(db)
+		cryptoID := 1
+
+		// Set the expectations for the Exec call (nothing to restore)
+		mock.ExpectExec("UPDATE crypto_vote SET deleted_at = NULL WHERE id = \\? AND deleted_at IS NOT NULL").
+			WithArgs(cryptoID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/cryptovote/"+strconv.Itoa(cryptoID)+":restore", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/cryptovote/{id:[0-9]+}:restore", cryptoService.RestoreCryptoCurrency).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPurgeDeletedCryptoCurrencies(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cryptoService := NewCryptoCurrencyService(db)
+
+	// Set the expectations for the purged rows and their dependents, deleted
+	// in one transaction
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM crypto_vote WHERE deleted_at IS NOT NULL AND deleted_at < \\? FOR UPDATE").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(7))
+	mock.ExpectExec("DELETE FROM crypto_aliases WHERE crypto_id IN \\(\\?, \\?\\)").
+		WithArgs(3, 7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM crypto_tags WHERE crypto_id IN \\(\\?, \\?\\)").
+		WithArgs(3, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM poll_candidates WHERE crypto_id IN \\(\\?, \\?\\)").
+		WithArgs(3, 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE poll_credits c JOIN \\(SELECT poll_id, voter_id, SUM\\(weight \\* weight\\) AS cost FROM poll_quadratic_votes\\s+WHERE crypto_id IN \\(\\?, \\?\\)").
+		WithArgs(3, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range []string{"poll_quadratic_votes", "poll_token_votes", "poll_commitments", "vote_buckets", "webhook_milestones", "anomalies"} {
+		mock.ExpectExec("DELETE FROM " + table + " WHERE crypto_id IN \\(\\?, \\?\\)").
+			WithArgs(3, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec("DELETE FROM crypto_redirects WHERE to_id IN \\(\\?, \\?\\)").
+		WithArgs(3, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// The purged cryptocurrencies are taken out of the ballots ranking them
+	mock.ExpectQuery("SELECT id, ranking FROM poll_ballots WHERE JSON_CONTAINS\\(ranking, \\?\\) FOR UPDATE").
+		WithArgs("3").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ranking"}).AddRow(11, "[5, 3, 2]"))
+	mock.ExpectExec("UPDATE poll_ballots SET ranking = \\? WHERE id = \\?").
+		WithArgs("[5,2]", 11).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id, ranking FROM poll_ballots WHERE JSON_CONTAINS\\(ranking, \\?\\) FOR UPDATE").
+		WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ranking"}))
+	mock.ExpectExec("DELETE FROM crypto_vote WHERE id IN \\(\\?, \\?\\)").
+		WithArgs(3, 7).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	purged, err := cryptoService.PurgeDeletedCryptoCurrencies(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestScreenedVote(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cryptoService := NewCryptoCurrencyService(db)
+	cryptoService.EnableVoteScreening(NewVoteAnalyzer(db, DefaultVoteAnalyzerConfig()))
+
+	// The accepted vote event is written in the transaction of the count
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("FROM vote_events WHERE voter_ip = \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT\\(DISTINCT voter_ip\\) FROM vote_events").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("FROM vote_events WHERE crypto_id = \\? AND status = \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"up", "total"}).AddRow(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ 1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO vote_events").
+		WithArgs(1, "up", "192.0.2.1", "192.0.2.0/24", "", VoteStatusAccepted, "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE id=?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).AddRow(1, "Bitcoin", 101, 21, 122))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("PUT", "/v1/cryptovote/1/upvote", nil)
+	assert.NoError(t, err)
+	req.RemoteAddr = "192.0.2.1:5000"
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/upvote", cryptoService.UpVoteCryptoCurrency).Methods("PUT")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DecayAlgorithm weighs a vote by how long ago it was cast, so recent votes
+// count for more than old ones in the trending score.
+type DecayAlgorithm interface {
+	Name() string
+	Weight(age time.Duration) float64
+}
+
+// GravityDecay is the Hacker News ranking: a vote cast age hours ago weighs
+// 1 / (age + 2) ^ Gravity.
+type GravityDecay struct {
+	Gravity float64
+}
+
+func (d GravityDecay) Name() string {
+	return "gravity"
+}
+
+func (d GravityDecay) Weight(age time.Duration) float64 {
+	return 1 / math.Pow(age.Hours()+2, d.Gravity)
+}
+
+// HalfLifeDecay halves the weight of a vote every HalfLife.
+type HalfLifeDecay struct {
+	HalfLife time.Duration
+}
+
+func (d HalfLifeDecay) Name() string {
+	return "half-life"
+}
+
+func (d HalfLifeDecay) Weight(age time.Duration) float64 {
+	return math.Exp2(-float64(age) / float64(d.HalfLife))
+}
+
+// parseDecayAlgorithm returns the decay algorithm described by the value:
+// "gravity" or "half-life", optionally followed by a colon and the gravity
+// or the half-life duration, such as "gravity:1.5" or "half-life:12h". The
+// gravity defaults to 1.8 and the half-life to 6 hours.
+func parseDecayAlgorithm(value string) (DecayAlgorithm, error) {
+	name, parameter, _ := strings.Cut(value, ":")
+
+	switch name {
+	case "gravity":
+		decay := GravityDecay{Gravity: 1.8}
+		if parameter != "" {
+			gravity, err := strconv.ParseFloat(parameter, 64)
+			if err != nil || gravity <= 0 {
+				return nil, fmt.Errorf("invalid gravity %q", parameter)
+			}
+			decay.Gravity = gravity
+		}
+		return decay, nil
+	case "half-life":
+		decay := HalfLifeDecay{HalfLife: 6 * time.Hour}
+		if parameter != "" {
+			halfLife, err := time.ParseDuration(parameter)
+			if err != nil || halfLife <= 0 {
+				return nil, fmt.Errorf("invalid half-life %q", parameter)
+			}
+			decay.HalfLife = halfLife
+		}
+		return decay, nil
+	}
+
+	return nil, fmt.Errorf("unknown decay algorithm %q", name)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecayAlgorithms(t *testing.T) {
+	t.Run("Gravity", func(t *testing.T) {
+		decay := GravityDecay{Gravity: 2}
+
+		assert.InDelta(t, 0.25, decay.Weight(0), 1e-9)
+		assert.InDelta(t, 1.0/16, decay.Weight(2*time.Hour), 1e-9)
+	})
+
+	t.Run("HalfLife", func(t *testing.T) {
+		decay := HalfLifeDecay{HalfLife: 6 * time.Hour}
+
+		assert.InDelta(t, 1, decay.Weight(0), 1e-9)
+		assert.InDelta(t, 0.5, decay.Weight(6*time.Hour), 1e-9)
+		assert.InDelta(t, 0.25, decay.Weight(12*time.Hour), 1e-9)
+	})
+}
+
+func TestParseDecayAlgorithm(t *testing.T) {
+	decay, err := parseDecayAlgorithm("gravity")
+	assert.NoError(t, err)
+	assert.Equal(t, GravityDecay{Gravity: 1.8}, decay)
+
+	decay, err = parseDecayAlgorithm("half-life:12h")
+	assert.NoError(t, err)
+	assert.Equal(t, HalfLifeDecay{HalfLife: 12 * time.Hour}, decay)
+
+	_, err = parseDecayAlgorithm("half-life:-1h")
+	assert.Error(t, err)
+
+	_, err = parseDecayAlgorithm("newest")
+	assert.Error(t, err)
+}
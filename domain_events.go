@@ -0,0 +1,141 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// EventSink stores the domain events of a change in the transaction of the
+// change, such as the outbox or the event store. A failing sink rolls the
+// change back.
+type EventSink interface {
+	Store(tx *sql.Tx, events []DomainEvent) error
+}
+
+type eventSinks []EventSink
+
+// Begin starts a change on the database. Without sinks the statements of the
+// change run directly on the database and its events are dropped.
+func (sinks eventSinks) Begin(db Database) (*EventTx, error) {
+	if len(sinks) == 0 {
+		return &EventTx{db: db}, nil
+	}
+	return sinks.BeginTx(db)
+}
+
+// BeginTx starts a change in a transaction, for changes that need one even
+// when no sink stores their events.
+func (sinks eventSinks) BeginTx(db Database) (*EventTx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &EventTx{db: db, tx: tx, sinks: sinks}, nil
+}
+
+// EventTx is a change recording domain events. The appended events are
+// stored by every sink when the change commits.
+type EventTx struct {
+	db     Database
+	tx     *sql.Tx
+	sinks  eventSinks
+	events []DomainEvent
+	err    error
+}
+
+func (t *EventTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if t.tx == nil {
+		return t.db.Exec(query, args...)
+	}
+	return t.tx.Exec(query, args...)
+}
+
+func (t *EventTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if t.tx == nil {
+		return t.db.Query(query, args...)
+	}
+	return t.tx.Query(query, args...)
+}
+
+func (t *EventTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	if t.tx == nil {
+		return t.db.QueryRow(query, args...)
+	}
+	return t.tx.QueryRow(query, args...)
+}
+
+// Append adds an event to be stored when the change commits.
+func (t *EventTx) Append(eventType string, aggregateID int, data interface{}) {
+	if len(t.sinks) == 0 {
+		return
+	}
+
+	event, err := newDomainEvent(eventType, aggregateID, data)
+	if err != nil {
+		t.err = err
+		return
+	}
+	t.events = append(t.events, event)
+}
+
+// Commit stores the appended events and commits the change.
+func (t *EventTx) Commit() error {
+	if t.tx == nil {
+		return nil
+	}
+	if t.err != nil {
+		return t.err
+	}
+
+	if len(t.events) > 0 {
+		for _, sink := range t.sinks {
+			if err := sink.Store(t.tx, t.events); err != nil {
+				return err
+			}
+		}
+	}
+
+	return t.tx.Commit()
+}
+
+// Rollback abandons the change unless it was committed.
+func (t *EventTx) Rollback() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Rollback()
+}
+
+func newDomainEvent(eventType string, aggregateID int, data interface{}) (DomainEvent, error) {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return DomainEvent{}, err
+	}
+
+	return DomainEvent{
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Data:        dataJSON,
+		OccurredAt:  time.Now().UTC(),
+	}, nil
+}
+
+// scanDomainEvents reads the events selected as id, event_type, aggregate_id,
+// payload and occurred_at, and closes the rows.
+func scanDomainEvents(rows *sql.Rows) ([]DomainEvent, error) {
+	defer rows.Close()
+
+	var events []DomainEvent
+	for rows.Next() {
+		var event DomainEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Type, &event.AggregateID, &payload, &event.OccurredAt); err != nil {
+			return nil, err
+		}
+		event.Data = payload
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var errEventLogNotEmpty = errors.New("the event log already has events, tallies can only be imported into an empty log")
+
+// EventStore keeps the append-only log of domain events, the source of truth
+// of the tally. Projectors build read models from the log: live projectors
+// are updated in the transaction of every change, and any projector can be
+// rebuilt by replaying the log from the start.
+type EventStore struct {
+	db         Database
+	projectors []Projector
+	live       map[string]bool
+	batchSize  int
+}
+
+func NewEventStore(db *sql.DB) *EventStore {
+	return &EventStore{
+		db:        db,
+		live:      make(map[string]bool),
+		batchSize: 1000,
+	}
+}
+
+// AddProjector registers the projector for rebuilds. A live projector is also
+// applied to every event as it is stored.
+func (s *EventStore) AddProjector(projector Projector, live bool) {
+	s.projectors = append(s.projectors, projector)
+	s.live[projector.Name()] = live
+}
+
+// Store appends the events of a change to the log and applies them to the
+// live projectors.
+func (s *EventStore) Store(tx *sql.Tx, events []DomainEvent) error {
+	for _, event := range events {
+		result, err := tx.Exec("INSERT INTO events (event_type, aggregate_id, payload, occurred_at) VALUES (?, ?, ?, ?)",
+			event.Type, event.AggregateID, string(event.Data), event.OccurredAt)
+		if err != nil {
+			return err
+		}
+
+		event.ID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, projector := range s.projectors {
+			if !s.live[projector.Name()] {
+				continue
+			}
+			if err := projector.Apply(tx, event); err != nil {
+				return fmt.Errorf("projecting event %d into %s: %w", event.ID, projector.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// Rebuild resets the named projections, or all of them without names, and
+// replays the whole log into them in a single transaction. It returns the
+// number of events replayed. Changes are not projected while a rebuild runs,
+// so it is meant to run with the server stopped.
+func (s *EventStore) Rebuild(names ...string) (int, error) {
+	projectors := s.projectors
+	if len(names) > 0 {
+		projectors = nil
+		for _, name := range names {
+			projector := s.projector(name)
+			if projector == nil {
+				return 0, fmt.Errorf("unknown projection %q", name)
+			}
+			projectors = append(projectors, projector)
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, projector := range projectors {
+		if err := projector.Reset(tx); err != nil {
+			return 0, fmt.Errorf("resetting %s: %w", projector.Name(), err)
+		}
+	}
+
+	// Replay the log in batches, each one read in full before it is applied
+	var replayed int
+	var lastID int64
+	for {
+		rows, err := tx.Query("SELECT id, event_type, aggregate_id, payload, occurred_at FROM events WHERE id > ? ORDER BY id LIMIT ?", lastID, s.batchSize)
+		if err != nil {
+			return 0, err
+		}
+
+		events, err := scanDomainEvents(rows)
+		if err != nil {
+			return 0, err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for _, event := range events {
+			for _, projector := range projectors {
+				if err := projector.Apply(tx, event); err != nil {
+					return 0, fmt.Errorf("projecting event %d into %s: %w", event.ID, projector.Name(), err)
+				}
+			}
+		}
+
+		replayed += len(events)
+		lastID = events[len(events)-1].ID
+	}
+
+	return replayed, tx.Commit()
+}
+
+// ImportTallies seeds an empty log with a TallyImported event for every
+// cryptocurrency, so the votes counted before the log was kept survive a
+// rebuild. It returns the number of imported cryptocurrencies.
+func (s *EventStore) ImportTallies() (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM events").Scan(&count); err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, errEventLogNotEmpty
+	}
+
+	// Lock the tallies so no vote lands between reading and importing them
+	rows, err := tx.Query("SELECT id, name, up_vote, down_vote, deleted_at IS NOT NULL FROM crypto_vote ORDER BY id FOR UPDATE")
+	if err != nil {
+		return 0, err
+	}
+
+	var events []DomainEvent
+	for rows.Next() {
+		var tally TallyImported
+		if err := rows.Scan(&tally.CryptoID, &tally.Name, &tally.UpVote, &tally.DownVote, &tally.Deleted); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		event, err := newDomainEvent(DomainEventTallyImported, tally.CryptoID, tally)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := s.Store(tx, events); err != nil {
+		return 0, err
+	}
+
+	return len(events), tx.Commit()
+}
+
+func (s *EventStore) projector(name string) Projector {
+	for _, projector := range s.projectors {
+		if projector.Name() == name {
+			return projector
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEventStore(db *sql.DB) *EventStore {
+	eventStore := NewEventStore(db)
+	eventStore.AddProjector(TallyProjector{}, false)
+	eventStore.AddProjector(LeaderboardProjector{}, true)
+	return eventStore
+}
+
+func TestEventStoreStore(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	eventStore := newTestEventStore(db)
+	event, err := newDomainEvent(DomainEventVoteCast, 1, VoteCast{CryptoID: 1, Direction: "up", Source: VoteSourceAnonymous})
+	assert.NoError(t, err)
+
+	// The event is appended and projected into the leaderboard only, the
+	// vote endpoint already counted it in the tally
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO events \\(event_type, aggregate_id, payload, occurred_at\\)").
+		WithArgs(DomainEventVoteCast, 1, string(event.Data), event.OccurredAt).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectExec("UPDATE leaderboard SET up_vote = up_vote \\+ 1, score = up_vote - down_vote WHERE crypto_id = ?").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, eventStore.Store(tx, []DomainEvent{event}))
+	assert.NoError(t, tx.Commit())
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRebuildProjections(t *testing.T) {
+	occurredAt := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	t.Run("ReplaysTheLog", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		eventStore := newTestEventStore(db)
+		eventStore.batchSize = 2
+
+		// Set the expectations for resetting the projections and replaying
+		// the log in batches
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = 0, down_vote = 0, total_votes = 0").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("DELETE FROM leaderboard").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectQuery("FROM events WHERE id > \\? ORDER BY id LIMIT \\?").
+			WithArgs(0, 2).
+			WillReturnRows(sqlmock.NewRows(outboxColumns).
+				AddRow(1, DomainEventCryptoCreated, 5, `{"id":5,"name":"Arbitrum"}`, occurredAt).
+				AddRow(2, DomainEventVoteCast, 5, `{"crypto_id":5,"direction":"down"}`, occurredAt))
+		mock.ExpectExec("INSERT INTO leaderboard").
+			WithArgs(5, "Arbitrum").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE crypto_vote SET down_vote = down_vote \\+ 1").
+			WithArgs(5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE leaderboard SET down_vote = down_vote \\+ 1").
+			WithArgs(5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM events WHERE id > \\? ORDER BY id LIMIT \\?").
+			WithArgs(2, 2).
+			WillReturnRows(sqlmock.NewRows(outboxColumns).
+				AddRow(3, DomainEventCryptoDeleted, 5, `{"id":5,"name":"Arbitrum"}`, occurredAt))
+		mock.ExpectExec("UPDATE leaderboard SET deleted = TRUE WHERE crypto_id = ?").
+			WithArgs(5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM events WHERE id > \\? ORDER BY id LIMIT \\?").
+			WithArgs(3, 2).
+			WillReturnRows(sqlmock.NewRows(outboxColumns))
+		mock.ExpectCommit()
+
+		replayed, err := eventStore.Rebuild()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, replayed)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("SingleProjection", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		eventStore := newTestEventStore(db)
+
+		// Only the tally is reset and replayed, merges move the votes kept
+		// on the survivor
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = 0").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectQuery("FROM events WHERE id > \\?").
+			WillReturnRows(sqlmock.NewRows(outboxColumns).
+				AddRow(1, DomainEventCryptoMerged, 2, `{"merged_id":2,"survivor":{"id":1},"moved_up_votes":4,"moved_down_votes":1}`, occurredAt))
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ \\?, down_vote = down_vote \\+ \\?").
+			WithArgs(4, 1, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM events WHERE id > \\?").
+			WithArgs(1, 1000).
+			WillReturnRows(sqlmock.NewRows(outboxColumns))
+		mock.ExpectCommit()
+
+		replayed, err := eventStore.Rebuild("tally")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, replayed)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UnknownProjection", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		eventStore := newTestEventStore(db)
+
+		_, err = eventStore.Rebuild("trending")
+		assert.EqualError(t, err, `unknown projection "trending"`)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestImportTallies(t *testing.T) {
+	t.Run("EmptyLog", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		eventStore := newTestEventStore(db)
+
+		// Set the expectations for importing every tally, trashed ones included
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM events").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("FROM crypto_vote ORDER BY id FOR UPDATE").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "deleted"}).
+				AddRow(1, "Bitcoin", 10, 2, false).
+				AddRow(2, "Ethereum", 3, 1, true))
+		mock.ExpectExec("INSERT INTO events").
+			WithArgs(DomainEventTallyImported, 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO leaderboard").
+			WithArgs(1, "Bitcoin", 10, 2, 8, false).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO events").
+			WithArgs(DomainEventTallyImported, 2, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec("INSERT INTO leaderboard").
+			WithArgs(2, "Ethereum", 3, 1, 2, true).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		imported, err := eventStore.ImportTallies()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, imported)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("LogNotEmpty", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		eventStore := newTestEventStore(db)
+
+		// Importing again would count the logged votes twice
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM events").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+		mock.ExpectRollback()
+
+		_, err = eventStore.ImportTallies()
+		assert.Equal(t, errEventLogNotEmpty, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
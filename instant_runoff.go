@@ -0,0 +1,88 @@
+package main
+
+import "sort"
+
+// runInstantRunoff tallies ranked ballots by instant-runoff elimination.
+// Every round each ballot counts for its highest ranked candidate still in the
+// race. A candidate with more than half of the ballots that are not exhausted
+// wins; otherwise the candidate with the fewest votes is eliminated and the
+// next round starts.
+//
+// Ties for elimination are broken deterministically: the tied candidate with
+// the fewest votes in the latest earlier round where their counts differ is
+// eliminated, and if they were tied in every round, the one with the highest
+// cryptocurrency ID is.
+//
+// Rankings may contain IDs that are not candidates, they are skipped. There is
+// no winner when no ballot ranks any candidate.
+func runInstantRunoff(candidates []int, ballots [][]int) ([]InstantRunoffRound, *int) {
+	continuing := make(map[int]bool, len(candidates))
+	for _, candidate := range candidates {
+		continuing[candidate] = true
+	}
+
+	var rounds []InstantRunoffRound
+	for len(continuing) > 0 {
+		round := InstantRunoffRound{Round: len(rounds) + 1, Counts: make(map[int]int, len(continuing))}
+		for candidate := range continuing {
+			round.Counts[candidate] = 0
+		}
+
+		for _, ranking := range ballots {
+			counted := false
+			for _, candidate := range ranking {
+				if continuing[candidate] {
+					round.Counts[candidate]++
+					counted = true
+					break
+				}
+			}
+			if !counted {
+				round.Exhausted++
+			}
+		}
+
+		active := len(ballots) - round.Exhausted
+		if active == 0 {
+			rounds = append(rounds, round)
+			return rounds, nil
+		}
+
+		// Sort the continuing candidates from the strongest to the weakest
+		ordered := make([]int, 0, len(continuing))
+		for candidate := range continuing {
+			ordered = append(ordered, candidate)
+		}
+		sort.Slice(ordered, func(i, j int) bool {
+			return stronger(ordered[i], ordered[j], round, rounds)
+		})
+
+		leader := ordered[0]
+		if 2*round.Counts[leader] > active || len(ordered) == 1 {
+			rounds = append(rounds, round)
+			return rounds, &leader
+		}
+
+		round.Eliminated = ordered[len(ordered)-1]
+		delete(continuing, round.Eliminated)
+		rounds = append(rounds, round)
+	}
+
+	return rounds, nil
+}
+
+// stronger reports whether candidate a ranks above candidate b in the current
+// round, applying the tie-breaking rules of runInstantRunoff.
+func stronger(a, b int, round InstantRunoffRound, previous []InstantRunoffRound) bool {
+	if round.Counts[a] != round.Counts[b] {
+		return round.Counts[a] > round.Counts[b]
+	}
+
+	for i := len(previous) - 1; i >= 0; i-- {
+		if previous[i].Counts[a] != previous[i].Counts[b] {
+			return previous[i].Counts[a] > previous[i].Counts[b]
+		}
+	}
+
+	return a < b
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunInstantRunoff(t *testing.T) {
+	t.Run("FirstRoundMajority", func(t *testing.T) {
+		rounds, winner := runInstantRunoff([]int{1, 2, 3}, [][]int{{1, 2}, {1}, {2, 1}})
+
+		assert.Equal(t, []InstantRunoffRound{
+			{Round: 1, Counts: map[int]int{1: 2, 2: 1, 3: 0}},
+		}, rounds)
+		assert.Equal(t, 1, *winner)
+	})
+
+	t.Run("TransfersAfterElimination", func(t *testing.T) {
+		// Nobody has a majority until the votes of 3 move to their next choice
+		ballots := [][]int{{1}, {1}, {2}, {2}, {3, 2}}
+		rounds, winner := runInstantRunoff([]int{1, 2, 3}, ballots)
+
+		assert.Equal(t, []InstantRunoffRound{
+			{Round: 1, Counts: map[int]int{1: 2, 2: 2, 3: 1}, Eliminated: 3},
+			{Round: 2, Counts: map[int]int{1: 2, 2: 3}},
+		}, rounds)
+		assert.Equal(t, 2, *winner)
+	})
+
+	t.Run("ExhaustedBallots", func(t *testing.T) {
+		// Ballots ranking only eliminated candidates no longer count toward the majority
+		ballots := [][]int{{1}, {1}, {2}, {3}, {3}, {4}}
+		rounds, winner := runInstantRunoff([]int{1, 2, 3, 4}, ballots)
+
+		assert.Len(t, rounds, 4)
+		assert.Equal(t, 4, rounds[0].Eliminated)
+		assert.Equal(t, 2, rounds[1].Eliminated)
+		assert.Equal(t, 2, rounds[2].Exhausted)
+		assert.Equal(t, 3, rounds[2].Eliminated)
+		assert.Equal(t, InstantRunoffRound{Round: 4, Counts: map[int]int{1: 2}, Exhausted: 4}, rounds[3])
+		assert.Equal(t, 1, *winner)
+	})
+
+	t.Run("TieBrokenByEarlierRound", func(t *testing.T) {
+		// 2 and 3 tie in round two, 3 had fewer votes in round one
+		ballots := [][]int{{1}, {1}, {1}, {2}, {2}, {3}, {4, 3}, {5, 1}}
+		rounds, winner := runInstantRunoff([]int{1, 2, 3, 4, 5}, ballots)
+
+		assert.Equal(t, 5, rounds[0].Eliminated)
+		assert.Equal(t, 4, rounds[1].Eliminated)
+		assert.Equal(t, map[int]int{1: 4, 2: 2, 3: 2}, rounds[2].Counts)
+		assert.Equal(t, 3, rounds[2].Eliminated)
+		assert.Equal(t, InstantRunoffRound{Round: 4, Counts: map[int]int{1: 4, 2: 2}, Exhausted: 2}, rounds[3])
+		assert.Equal(t, 1, *winner)
+	})
+
+	t.Run("TieBrokenByID", func(t *testing.T) {
+		rounds, winner := runInstantRunoff([]int{1, 2}, [][]int{{2}, {1}})
+
+		assert.Equal(t, 2, rounds[0].Eliminated)
+		assert.Equal(t, 1, *winner)
+	})
+
+	t.Run("NoBallots", func(t *testing.T) {
+		rounds, winner := runInstantRunoff([]int{1, 2}, nil)
+
+		assert.Equal(t, []InstantRunoffRound{{Round: 1, Counts: map[int]int{1: 0, 2: 0}}}, rounds)
+		assert.Nil(t, winner)
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import "time"
+
+// Snapshot dates are UTC calendar days.
+const leaderboardDateLayout = "2006-01-02"
+
+type LeaderboardEntry struct {
+	Rank     int    `json:"rank"`
+	CryptoID int    `json:"crypto_id"`
+	Name     string `json:"name"`
+	UpVote   int    `json:"up_vote"`
+	DownVote int    `json:"down_vote"`
+	Score    int    `json:"score"`
+}
+
+type Leaderboard struct {
+	Date    string             `json:"date"`
+	TakenAt time.Time          `json:"taken_at"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// RankChange describes how a cryptocurrency moved between two snapshots.
+// Change is positive when it climbed. FromRank is nil for new entries and
+// ToRank is nil for cryptocurrencies that left the leaderboard.
+type RankChange struct {
+	CryptoID int    `json:"crypto_id"`
+	Name     string `json:"name"`
+	FromRank *int   `json:"from_rank"`
+	ToRank   *int   `json:"to_rank"`
+	Change   int    `json:"change"`
+}
+
+type LeaderboardChanges struct {
+	From       string       `json:"from"`
+	To         string       `json:"to"`
+	NewEntries []RankChange `json:"new_entries"`
+	Risers     []RankChange `json:"risers"`
+	Fallers    []RankChange `json:"fallers"`
+	Dropped    []RankChange `json:"dropped"`
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultLeaderboardLimit = 100
+	maxLeaderboardLimit     = 1000
+)
+
+// LeaderboardService snapshots the ranked cryptocurrency leaderboard once a
+// day and compares past snapshots to track how the rankings move.
+type LeaderboardService struct {
+	db    Database
+	cache *ReadThroughCache
+}
+
+func NewLeaderboardService(db *sql.DB) *LeaderboardService {
+	return &LeaderboardService{
+		db: db,
+	}
+}
+
+// EnableCache serves the current leaderboard with the default limit from the
+// cache.
+func (s *LeaderboardService) EnableCache(cache *ReadThroughCache) {
+	s.cache = cache
+}
+
+// StartSnapshots takes the snapshot of the current day right away and then
+// checks every interval whether a new day needs its snapshot.
+func (s *LeaderboardService) StartSnapshots(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			taken, err := s.TakeSnapshot(time.Now().UTC())
+			if err != nil {
+				log.Println("Error taking leaderboard snapshot:", err)
+			} else if taken {
+				log.Println("Took leaderboard snapshot")
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// TakeSnapshot stores the current leaderboard as the snapshot of the day of
+// now. Every day is only snapshotted once, even with several instances
+// running the job, and it reports whether this call took the snapshot.
+func (s *LeaderboardService) TakeSnapshot(now time.Time) (bool, error) {
+	date := now.UTC().Format(leaderboardDateLayout)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT IGNORE INTO leaderboard_snapshots (snapshot_date, taken_at) VALUES (?, ?)", date, now.UTC().Truncate(time.Second))
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+
+	rows, err := tx.Query(`SELECT id, name, up_vote, down_vote FROM crypto_vote WHERE deleted_at IS NULL
+		ORDER BY (up_vote - down_vote) DESC, up_vote DESC, id`)
+	if err != nil {
+		return false, err
+	}
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		entry := LeaderboardEntry{Rank: len(entries) + 1}
+		if err := rows.Scan(&entry.CryptoID, &entry.Name, &entry.UpVote, &entry.DownVote); err != nil {
+			rows.Close()
+			return false, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		_, err := tx.Exec("INSERT INTO leaderboard_entries (snapshot_date, `rank`, crypto_id, name, up_vote, down_vote) VALUES (?, ?, ?, ?, ?, ?)",
+			date, entry.Rank, entry.CryptoID, entry.Name, entry.UpVote, entry.DownVote)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// GetSnapshotDates lists the dates of every leaderboard snapshot, most recent
+// first.
+func (s *LeaderboardService) GetSnapshotDates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rows, err := s.db.Query("SELECT snapshot_date FROM leaderboard_snapshots ORDER BY snapshot_date DESC")
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting leaderboard snapshots", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	dates := []string{}
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting leaderboard snapshots", http.StatusInternalServerError)
+			return
+		}
+		dates = append(dates, date.Format(leaderboardDateLayout))
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting leaderboard snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(dates)
+}
+
+// GetSnapshot returns the leaderboard as it was snapshotted on the date.
+func (s *LeaderboardService) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	date, err := time.Parse(leaderboardDateLayout, mux.Vars(r)["date"])
+	if err != nil {
+		http.Error(w, "Date must be formatted as YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+
+	leaderboard, err := s.getLeaderboard(date)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No leaderboard snapshot was taken on "+date.Format(leaderboardDateLayout), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting leaderboard snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(leaderboard)
+}
+
+// GetRankChanges compares the snapshots of the from and to dates. Without a
+// to date the latest snapshot is used, and without a from date the snapshot
+// of a week before.
+func (s *LeaderboardService) GetRankChanges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	var to time.Time
+	var err error
+	if value := query.Get("to"); value != "" {
+		to, err = time.Parse(leaderboardDateLayout, value)
+		if err != nil {
+			http.Error(w, "Invalid to date, it must be formatted as YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	} else {
+		err = s.db.QueryRow("SELECT snapshot_date FROM leaderboard_snapshots ORDER BY snapshot_date DESC LIMIT 1").Scan(&to)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No leaderboard snapshot was taken yet", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error getting rank changes", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	from := to.AddDate(0, 0, -7)
+	if value := query.Get("from"); value != "" {
+		from, err = time.Parse(leaderboardDateLayout, value)
+		if err != nil {
+			http.Error(w, "Invalid from date, it must be formatted as YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	var snapshots [2]Leaderboard
+	for i, date := range []time.Time{from, to} {
+		snapshots[i], err = s.getLeaderboard(date)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No leaderboard snapshot was taken on "+date.Format(leaderboardDateLayout), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error getting rank changes", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	changes := compareLeaderboards(snapshots[0].Entries, snapshots[1].Entries)
+	changes.From = snapshots[0].Date
+	changes.To = snapshots[1].Date
+
+	json.NewEncoder(w).Encode(changes)
+}
+
+// GetCurrentLeaderboard ranks the cryptocurrencies by score from the
+// leaderboard projection of the event store.
+func (s *LeaderboardService) GetCurrentLeaderboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := defaultLeaderboardLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxLeaderboardLimit {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	load := func() ([]byte, error) {
+		entries, err := s.currentLeaderboard(limit)
+		if err != nil {
+			return nil, err
+		}
+		return encodeJSON(entries)
+	}
+
+	// Only the leaderboard with the default limit is cached
+	var body []byte
+	var err error
+	if limit == defaultLeaderboardLimit {
+		body, err = s.cache.Get(cacheKeyLeaderboard, load)
+	} else {
+		body, err = load()
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(body)
+}
+
+// currentLeaderboard ranks the top cryptocurrencies of the leaderboard
+// projection.
+func (s *LeaderboardService) currentLeaderboard(limit int) ([]LeaderboardEntry, error) {
+	rows, err := s.db.Query(`SELECT crypto_id, name, up_vote, down_vote FROM leaderboard WHERE deleted = FALSE
+		ORDER BY score DESC, up_vote DESC, crypto_id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []LeaderboardEntry{}
+	for rows.Next() {
+		entry := LeaderboardEntry{Rank: len(entries) + 1}
+		if err := rows.Scan(&entry.CryptoID, &entry.Name, &entry.UpVote, &entry.DownVote); err != nil {
+			return nil, err
+		}
+		entry.Score = entry.UpVote - entry.DownVote
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// getLeaderboard loads the snapshot of the date. It returns sql.ErrNoRows when
+// no snapshot was taken that day.
+func (s *LeaderboardService) getLeaderboard(date time.Time) (Leaderboard, error) {
+	leaderboard := Leaderboard{Date: date.Format(leaderboardDateLayout), Entries: []LeaderboardEntry{}}
+
+	err := s.db.QueryRow("SELECT taken_at FROM leaderboard_snapshots WHERE snapshot_date = ?", leaderboard.Date).Scan(&leaderboard.TakenAt)
+	if err != nil {
+		return leaderboard, err
+	}
+
+	rows, err := s.db.Query("SELECT `rank`, crypto_id, name, up_vote, down_vote FROM leaderboard_entries WHERE snapshot_date = ? ORDER BY `rank`", leaderboard.Date)
+	if err != nil {
+		return leaderboard, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry LeaderboardEntry
+		if err := rows.Scan(&entry.Rank, &entry.CryptoID, &entry.Name, &entry.UpVote, &entry.DownVote); err != nil {
+			return leaderboard, err
+		}
+		entry.Score = entry.UpVote - entry.DownVote
+		leaderboard.Entries = append(leaderboard.Entries, entry)
+	}
+
+	return leaderboard, rows.Err()
+}
+
+// compareLeaderboards classifies every cryptocurrency by how its rank moved
+// between the two leaderboards. Risers and fallers are sorted by the size of
+// the move, the others by rank.
+func compareLeaderboards(from, to []LeaderboardEntry) LeaderboardChanges {
+	changes := LeaderboardChanges{
+		NewEntries: []RankChange{},
+		Risers:     []RankChange{},
+		Fallers:    []RankChange{},
+		Dropped:    []RankChange{},
+	}
+
+	fromRanks := make(map[int]int, len(from))
+	for _, entry := range from {
+		fromRanks[entry.CryptoID] = entry.Rank
+	}
+
+	for _, entry := range to {
+		toRank := entry.Rank
+		change := RankChange{CryptoID: entry.CryptoID, Name: entry.Name, ToRank: &toRank}
+
+		fromRank, ok := fromRanks[entry.CryptoID]
+		delete(fromRanks, entry.CryptoID)
+		if !ok {
+			changes.NewEntries = append(changes.NewEntries, change)
+			continue
+		}
+
+		change.FromRank = &fromRank
+		change.Change = fromRank - toRank
+		switch {
+		case change.Change > 0:
+			changes.Risers = append(changes.Risers, change)
+		case change.Change < 0:
+			changes.Fallers = append(changes.Fallers, change)
+		}
+	}
+
+	for _, entry := range from {
+		if _, ok := fromRanks[entry.CryptoID]; ok {
+			fromRank := entry.Rank
+			changes.Dropped = append(changes.Dropped, RankChange{CryptoID: entry.CryptoID, Name: entry.Name, FromRank: &fromRank})
+		}
+	}
+
+	sort.SliceStable(changes.Risers, func(i, j int) bool {
+		return changes.Risers[i].Change > changes.Risers[j].Change
+	})
+	sort.SliceStable(changes.Fallers, func(i, j int) bool {
+		return changes.Fallers[i].Change < changes.Fallers[j].Change
+	})
+
+	return changes
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var leaderboardEntryColumns = []string{"rank", "crypto_id", "name", "up_vote", "down_vote"}
+
+func TestTakeLeaderboardSnapshot(t *testing.T) {
+	t.Run("FirstSnapshotOfTheDay", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		leaderboardService := NewLeaderboardService(db)
+		now := time.Date(2026, 3, 8, 0, 5, 0, 0, time.UTC)
+
+		// Set the expectations for claiming the day and storing the ranking
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT IGNORE INTO leaderboard_snapshots").
+			WithArgs("2026-03-08", now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("ORDER BY \\(up_vote - down_vote\\) DESC, up_vote DESC, id").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote"}).
+				AddRow(1, "Bitcoin", 50, 5).
+				AddRow(2, "Ethereum", 40, 10))
+		mock.ExpectExec("INSERT INTO leaderboard_entries").
+			WithArgs("2026-03-08", 1, 1, "Bitcoin", 50, 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO leaderboard_entries").
+			WithArgs("2026-03-08", 2, 2, "Ethereum", 40, 10).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		taken, err := leaderboardService.TakeSnapshot(now)
+		assert.NoError(t, err)
+		assert.True(t, taken)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("AlreadyTaken", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		leaderboardService := NewLeaderboardService(db)
+		now := time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT IGNORE INTO leaderboard_snapshots").
+			WithArgs("2026-03-08", now).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		taken, err := leaderboardService.TakeSnapshot(now)
+		assert.NoError(t, err)
+		assert.False(t, taken)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCompareLeaderboards(t *testing.T) {
+	from := []LeaderboardEntry{
+		{Rank: 1, CryptoID: 1, Name: "Bitcoin"},
+		{Rank: 2, CryptoID: 2, Name: "Ethereum"},
+		{Rank: 3, CryptoID: 3, Name: "Solana"},
+		{Rank: 4, CryptoID: 4, Name: "Cardano"},
+		{Rank: 5, CryptoID: 5, Name: "Dogecoin"},
+	}
+	to := []LeaderboardEntry{
+		{Rank: 1, CryptoID: 1, Name: "Bitcoin"},
+		{Rank: 2, CryptoID: 5, Name: "Dogecoin"},
+		{Rank: 3, CryptoID: 6, Name: "Arbitrum"},
+		{Rank: 4, CryptoID: 4, Name: "Cardano"},
+		{Rank: 5, CryptoID: 2, Name: "Ethereum"},
+	}
+
+	changes := compareLeaderboards(from, to)
+
+	rank := func(rank int) *int { return &rank }
+	assert.Equal(t, []RankChange{{CryptoID: 6, Name: "Arbitrum", ToRank: rank(3)}}, changes.NewEntries)
+	assert.Equal(t, []RankChange{{CryptoID: 5, Name: "Dogecoin", FromRank: rank(5), ToRank: rank(2), Change: 3}}, changes.Risers)
+	assert.Equal(t, []RankChange{{CryptoID: 2, Name: "Ethereum", FromRank: rank(2), ToRank: rank(5), Change: -3}}, changes.Fallers)
+	assert.Equal(t, []RankChange{{CryptoID: 3, Name: "Solana", FromRank: rank(3)}}, changes.Dropped)
+}
+
+func TestGetRankChanges(t *testing.T) {
+	t.Run("LastWeek", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		leaderboardService := NewLeaderboardService(db)
+		to := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+
+		// Without dates the latest snapshot is compared to the one a week before
+		mock.ExpectQuery("SELECT snapshot_date FROM leaderboard_snapshots ORDER BY snapshot_date DESC LIMIT 1").
+			WillReturnRows(sqlmock.NewRows([]string{"snapshot_date"}).AddRow(to))
+		mock.ExpectQuery("SELECT taken_at FROM leaderboard_snapshots WHERE snapshot_date = ?").
+			WithArgs("2026-03-01").
+			WillReturnRows(sqlmock.NewRows([]string{"taken_at"}).AddRow(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)))
+		mock.ExpectQuery("FROM leaderboard_entries WHERE snapshot_date = ?").
+			WithArgs("2026-03-01").
+			WillReturnRows(sqlmock.NewRows(leaderboardEntryColumns).
+				AddRow(1, 1, "Bitcoin", 10, 0).
+				AddRow(2, 2, "Ethereum", 5, 0))
+		mock.ExpectQuery("SELECT taken_at FROM leaderboard_snapshots WHERE snapshot_date = ?").
+			WithArgs("2026-03-08").
+			WillReturnRows(sqlmock.NewRows([]string{"taken_at"}).AddRow(to))
+		mock.ExpectQuery("FROM leaderboard_entries WHERE snapshot_date = ?").
+			WithArgs("2026-03-08").
+			WillReturnRows(sqlmock.NewRows(leaderboardEntryColumns).
+				AddRow(1, 2, "Ethereum", 30, 0).
+				AddRow(2, 1, "Bitcoin", 12, 0))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("GET", "/v1/leaderboard/changes", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/leaderboard/changes", leaderboardService.GetRankChanges).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{
+			"from": "2026-03-01",
+			"to": "2026-03-08",
+			"new_entries": [],
+			"risers": [{"crypto_id": 2, "name": "Ethereum", "from_rank": 2, "to_rank": 1, "change": 1}],
+			"fallers": [{"crypto_id": 1, "name": "Bitcoin", "from_rank": 1, "to_rank": 2, "change": -1}],
+			"dropped": []
+		}`, rr.Body.String())
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("MissingSnapshot", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		leaderboardService := NewLeaderboardService(db)
+
+		mock.ExpectQuery("SELECT taken_at FROM leaderboard_snapshots WHERE snapshot_date = ?").
+			WithArgs("2026-03-01").
+			WillReturnRows(sqlmock.NewRows([]string{"taken_at"}))
+
+		req, err := http.NewRequest("GET", "/v1/leaderboard/changes?from=2026-03-01&to=2026-03-08", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/leaderboard/changes", leaderboardService.GetRankChanges).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetCurrentLeaderboard(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	leaderboardService := NewLeaderboardService(db)
+
+	// Set the expectations for ranking the leaderboard projection
+	mock.ExpectQuery("FROM leaderboard WHERE deleted = FALSE").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "up_vote", "down_vote"}).
+			AddRow(2, "Ethereum", 30, 2).
+			AddRow(1, "Bitcoin", 12, 0))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/leaderboard?limit=2", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/leaderboard", leaderboardService.GetCurrentLeaderboard).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[
+		{"rank": 1, "crypto_id": 2, "name": "Ethereum", "up_vote": 30, "down_vote": 2, "score": 28},
+		{"rank": 2, "crypto_id": 1, "name": "Bitcoin", "up_vote": 12, "down_vote": 0, "score": 12}
+	]`, rr.Body.String())
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/handlers"
@@ -15,16 +22,57 @@ func enableCorsMiddleware(next http.Handler) http.Handler {
 	return handlers.CORS(
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Voter-ID", "X-Voter-Key", "X-Voter-Timestamp", "X-Voter-Nonce", "X-Voter-Signature", "X-PoW-Challenge", "X-PoW-Nonce", "X-Request-ID"}),
 	)(next)
 }
 
+// loadSecret reads a secret from the environment variable, generating a random
+// one when it is not set. Random secrets do not survive a restart.
+func loadSecret(name string) []byte {
+	if secret := os.Getenv(name); secret != "" {
+		return []byte(secret)
+	}
+
+	log.Printf("%s not set, using a random secret", name)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal("Error generating secret: ", err)
+	}
+	return secret
+}
+
+// requireSecret reads a secret that must be the same on every instance and
+// across restarts from the environment variable, exiting when it is not set.
+func requireSecret(name string) []byte {
+	secret := os.Getenv(name)
+	if secret == "" {
+		log.Fatalf("%s must be set", name)
+	}
+	return []byte(secret)
+}
+
+// durationFromEnv parses a duration such as "30s" from the environment
+// variable, falling back to the default when it is not set.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid %s: %q", name, value)
+	}
+	return duration
+}
+
 func main() {
 	// Set up for the routes
 	myRouter := mux.NewRouter()
 
-	// Apply CORS middleware
+	// Apply CORS and request ID middlewares
 	myRouter.Use(enableCorsMiddleware)
+	myRouter.Use(requestIDMiddleware)
 
 	// Add API version prefix to the routes
 	apiRouter := myRouter.PathPrefix("/v1").Subrouter()
@@ -36,16 +84,265 @@ func main() {
 	}
 	defer db.Close()
 
+	// Initialize the EventStore keeping the append-only log of domain events and its projections
+	eventStore := NewEventStore(db)
+	eventStore.AddProjector(TallyProjector{}, false)
+	eventStore.AddProjector(LeaderboardProjector{}, true)
+
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(eventStore, os.Args[1:]); err != nil {
+			log.Fatal("Error running command: ", err)
+		}
+		return
+	}
+
+	// Initialize Audit service recording every mutating operation
+	auditService := NewAuditService(db)
+
+	// Initialize VoteHistory service aggregating counted votes into time series
+	voteHistoryService := NewVoteHistoryService(db)
+
+	// Initialize Trending service ranking cryptocurrencies by their time-decayed recent votes
+	trendingAlgorithm := os.Getenv("TRENDING_ALGORITHM")
+	if trendingAlgorithm == "" {
+		trendingAlgorithm = "gravity"
+	}
+	decay, err := parseDecayAlgorithm(trendingAlgorithm)
+	if err != nil {
+		log.Fatal("Error parsing TRENDING_ALGORITHM: ", err)
+	}
+	trendingService := NewTrendingService(db, decay)
+	if err := trendingService.Load(time.Now()); err != nil {
+		log.Println("Error loading trending votes:", err)
+	}
+
+	// Initialize Anomaly service detecting bursts of votes on a cryptocurrency
+	anomalyService := NewAnomalyService(db, NewAnomalyDetector(DefaultAnomalyDetectorConfig()))
+	anomalyService.AddNotifier(LogNotifier{})
+	if url := os.Getenv("ANOMALY_WEBHOOK_URL"); url != "" {
+		anomalyService.AddNotifier(NewWebhookNotifier(url))
+	}
+	if err := anomalyService.Load(time.Now()); err != nil {
+		log.Println("Error loading vote history into the anomaly detector:", err)
+	}
+
+	// Initialize Webhook service delivering catalog and vote events to subscribers
+	webhookService := NewWebhookService(db, DefaultWebhookConfig())
+	webhookService.EnableAuditLog(auditService)
+	webhookService.StartDispatcher(durationFromEnv("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second))
+
+	// Collect the sinks storing domain events along with the changes they describe
+	var eventSinks []EventSink
+	eventStoreEnabled := os.Getenv("EVENT_STORE_ENABLED") == "true"
+	if eventStoreEnabled {
+		eventSinks = append(eventSinks, eventStore)
+	}
+	// The outbox always relays catalog changes to the webhook subscriptions,
+	// and every domain event to the server log when enabled
+	webhookPublisher := NewWebhookEventPublisher(webhookService)
+	var outbox *Outbox
+	if os.Getenv("OUTBOX_ENABLED") == "true" {
+		outbox = NewOutbox(db, EventPublishers{webhookPublisher, LogEventPublisher{}})
+	} else {
+		outbox = NewOutbox(db, webhookPublisher)
+		outbox.StoreOnly(webhookPublisher.DomainEventTypes()...)
+	}
+	outbox.StartRelay(durationFromEnv("OUTBOX_RELAY_INTERVAL", time.Second))
+	eventSinks = append(eventSinks, outbox)
+
+	// Initialize the read-through cache of the catalog and leaderboard reads
+	var catalogCache *ReadThroughCache
+	if os.Getenv("CACHE_ENABLED") == "true" {
+		catalogCache = NewReadThroughCache(NewLRUCache(100), durationFromEnv("CACHE_TTL", 5*time.Second))
+	}
+
 	// Initialize CryptoCurrency service with database connection
 	cryptoService := NewCryptoCurrencyService(db)
+	cryptoService.EnableAuditLog(auditService)
+	cryptoService.EnableWebhooks(webhookService)
+	cryptoService.AddEventSinks(eventSinks...)
+	cryptoService.AddVoteObserver(voteHistoryService)
+	cryptoService.AddVoteObserver(trendingService)
+	cryptoService.AddVoteObserver(anomalyService)
+	cryptoService.EnableCache(catalogCache)
+	cryptoService.AddVoteObserver(catalogCache)
+	cryptoService.StartTrashPurger(durationFromEnv("TRASH_RETENTION", 30*24*time.Hour), time.Hour)
+	cryptoService.EnableVoteScreening(NewVoteAnalyzer(db, DefaultVoteAnalyzerConfig()))
+
+	// Write anonymous votes behind in batches when enabled, after the observers are added
+	var voteBatcher *VoteBatcher
+	if os.Getenv("VOTE_BATCHING_ENABLED") == "true" {
+		voteBatcher = cryptoService.StartVoteBatching(durationFromEnv("VOTE_BATCH_INTERVAL", 100*time.Millisecond))
+	}
+
+	// Initialize Challenge service issuing proof-of-work puzzles for anonymous votes
+	challengeService := NewChallengeService(loadSecret("POW_SECRET"), DefaultChallengeConfig())
+	if os.Getenv("POW_ENABLED") == "true" {
+		cryptoService.RequireProofOfWork(challengeService)
+	}
+
+	// Initialize Poll service for polls with their own candidates and votes
+	pollService := NewPollService(db)
+	pollService.EnableAuditLog(auditService)
+	pollService.StartScheduler(durationFromEnv("POLL_SCHEDULER_INTERVAL", time.Minute))
+	if os.Getenv("POW_ENABLED") == "true" {
+		pollService.RequireProofOfWork(challengeService)
+	}
+
+	// Initialize SignedVote service for votes signed with registered voter keys
+	signedVoteService := NewSignedVoteService(db)
+	signedVoteService.AddEventSinks(eventSinks...)
+	signedVoteService.AddVoteObserver(voteHistoryService)
+	signedVoteService.AddVoteObserver(trendingService)
+	signedVoteService.AddVoteObserver(anomalyService)
+	signedVoteService.AddVoteObserver(catalogCache)
+	signedVoteService.EnableWebhooks(webhookService)
+	// Registering a key always costs a proof-of-work and every key votes at
+	// the pace of an identified anonymous voter, so signed votes are no way
+	// around vote screening
+	signedVoteService.RequireProofOfWork(challengeService)
+	signedVoteService.LimitVoteRate(DefaultVoteAnalyzerConfig().MaxVotesPerVoter, DefaultVoteAnalyzerConfig().VelocityWindow)
+
+	// Initialize Merkle service sealing the signed vote ledger into signed tree
+	// heads, the published heads only verify if the key never changes
+	merkleSeed := sha256.Sum256(requireSecret("MERKLE_SIGNING_SECRET"))
+	merkleService := NewMerkleService(db, ed25519.NewKeyFromSeed(merkleSeed[:]))
+	merkleService.StartSealing(durationFromEnv("MERKLE_SEAL_INTERVAL", time.Minute))
+
+	// Initialize Alias service for alternative cryptocurrency names
+	aliasService := NewAliasService(db)
+	aliasService.EnableAuditLog(auditService)
+
+	// Initialize Tag service for categorizing cryptocurrencies
+	tagService := NewTagService(db)
+	tagService.EnableAuditLog(auditService)
+
+	// Initialize Merge service for folding duplicate cryptocurrencies together
+	mergeService := NewMergeService(db)
+	mergeService.EnableAuditLog(auditService)
+	mergeService.AddEventSinks(eventSinks...)
+	mergeService.EnableCache(catalogCache)
+	mergeService.UseVoteBatcher(voteBatcher)
+
+	// Initialize Moderation service for reviewing quarantined votes
+	moderationService := NewModerationService(db)
+	moderationService.EnableAuditLog(auditService)
+	moderationService.AddEventSinks(eventSinks...)
+	moderationService.AddVoteObserver(voteHistoryService)
+	moderationService.AddVoteObserver(trendingService)
+	moderationService.AddVoteObserver(anomalyService)
+	moderationService.AddVoteObserver(catalogCache)
+	moderationService.EnableWebhooks(webhookService)
+
+	// Initialize Leaderboard service snapshotting the ranked leaderboard daily
+	leaderboardService := NewLeaderboardService(db)
+	leaderboardService.EnableCache(catalogCache)
+	leaderboardService.StartSnapshots(durationFromEnv("LEADERBOARD_SNAPSHOT_INTERVAL", time.Hour))
+
+	// Initialize Stats service summarizing the catalog for dashboards
+	statsService := NewStatsService(db, durationFromEnv("STATS_CACHE_TTL", 30*time.Second))
 
 	// Register API endpoints with handlers
+	// Catalog changes are public unless CATALOG_WRITES_REQUIRE_ADMIN is set,
+	// the audit log records them as anonymous with the client IP
+	catalogWrite := func(handler http.HandlerFunc) http.Handler {
+		if os.Getenv("CATALOG_WRITES_REQUIRE_ADMIN") == "true" {
+			return requireAdminMiddleware(handler)
+		}
+		return handler
+	}
+
 	apiRouter.HandleFunc("/cryptovote", cryptoService.GetAllCryptoCurrencies).Methods("GET")
 	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}", cryptoService.GetCryptoCurrencyByID).Methods("GET")
-	apiRouter.HandleFunc("/cryptovote", cryptoService.CreateCryptoCurrency).Methods("POST")
+	apiRouter.HandleFunc("/cryptovote/trending", trendingService.GetTrending).Methods("GET")
+	apiRouter.Handle("/cryptovote", catalogWrite(cryptoService.CreateCryptoCurrency)).Methods("POST")
+	apiRouter.HandleFunc("/cryptovote/by-name/{name}", aliasService.GetCryptoCurrencyByName).Methods("GET")
+	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}/aliases", aliasService.GetAliases).Methods("GET")
+	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}/tags", tagService.GetCryptoCurrencyTags).Methods("GET")
+	apiRouter.HandleFunc("/tags", tagService.GetAllTags).Methods("GET")
+	apiRouter.HandleFunc("/stats", statsService.GetStats).Methods("GET")
+	apiRouter.HandleFunc("/anomalies", anomalyService.GetAnomalies).Methods("GET")
+	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}/history", voteHistoryService.GetHistory).Methods("GET")
+	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}/challenge", challengeService.GetChallenge).Methods("GET")
 	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}/upvote", cryptoService.UpVoteCryptoCurrency).Methods("PUT")
 	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}/downvote", cryptoService.DownVoteCryptoCurrency).Methods("PUT")
-	apiRouter.HandleFunc("/cryptovote/{id:[0-9]+}", cryptoService.DeleteCryptoCurrency).Methods("DELETE")
+	apiRouter.Handle("/cryptovote/{id:[0-9]+}", catalogWrite(cryptoService.DeleteCryptoCurrency)).Methods("DELETE")
+	apiRouter.Handle("/cryptovote/{id:[0-9]+}:restore", catalogWrite(cryptoService.RestoreCryptoCurrency)).Methods("POST")
+	apiRouter.HandleFunc("/voters/challenge", challengeService.GetVoterChallenge).Methods("GET")
+	apiRouter.HandleFunc("/voters", signedVoteService.RegisterVoter).Methods("POST")
+	apiRouter.HandleFunc("/votes", signedVoteService.CastSignedVote).Methods("POST")
+	apiRouter.HandleFunc("/votes/ledger", signedVoteService.GetLedger).Methods("GET")
+	apiRouter.HandleFunc("/votes/{id:[0-9]+}/proof", merkleService.GetInclusionProof).Methods("GET")
+	apiRouter.HandleFunc("/merkle/tree-heads/latest", merkleService.GetLatestTreeHead).Methods("GET")
+	apiRouter.HandleFunc("/merkle/consistency", merkleService.GetConsistencyProof).Methods("GET")
+	apiRouter.HandleFunc("/merkle/public-key", merkleService.GetPublicKey).Methods("GET")
+	apiRouter.HandleFunc("/leaderboard/snapshots", leaderboardService.GetSnapshotDates).Methods("GET")
+	apiRouter.HandleFunc("/leaderboard/snapshots/{date}", leaderboardService.GetSnapshot).Methods("GET")
+	apiRouter.HandleFunc("/leaderboard/changes", leaderboardService.GetRankChanges).Methods("GET")
+
+	// The current leaderboard is a projection of the event store
+	if eventStoreEnabled {
+		apiRouter.HandleFunc("/leaderboard", leaderboardService.GetCurrentLeaderboard).Methods("GET")
+	}
+
+	// Register poll endpoints, managing polls and candidates requires admin authentication
+	apiRouter.HandleFunc("/polls", pollService.GetAllPolls).Methods("GET")
+	apiRouter.Handle("/polls", requireAdminMiddleware(http.HandlerFunc(pollService.CreatePoll))).Methods("POST")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}", pollService.GetPollByID).Methods("GET")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/results", pollService.GetPollResults).Methods("GET")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/ballots", signedVoteService.RequireVoter(http.HandlerFunc(pollService.SubmitBallot))).Methods("POST")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/tally/instant-runoff", pollService.GetInstantRunoffTally).Methods("GET")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/credits", signedVoteService.RequireVoter(http.HandlerFunc(pollService.GetVoterCredits))).Methods("GET")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/snapshot", requireAdminMiddleware(http.HandlerFunc(pollService.ImportTokenSnapshot))).Methods("PUT")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/tally/token-weighted", pollService.GetTokenWeightedTally).Methods("GET")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/commitments", signedVoteService.RequireVoter(http.HandlerFunc(pollService.SubmitCommitment))).Methods("POST")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/reveals", signedVoteService.RequireVoter(http.HandlerFunc(pollService.RevealCommitment))).Methods("POST")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/tally/commit-reveal", pollService.GetCommitRevealTally).Methods("GET")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/cryptovote", pollService.GetPollCandidates).Methods("GET")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/cryptovote", requireAdminMiddleware(http.HandlerFunc(pollService.AddPollCandidate))).Methods("POST")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}", pollService.GetPollCandidate).Methods("GET")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}", requireAdminMiddleware(http.HandlerFunc(pollService.RemovePollCandidate))).Methods("DELETE")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/challenge", challengeService.GetChallenge).Methods("GET")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/upvote", pollService.UpVotePollCandidate).Methods("PUT")
+	apiRouter.HandleFunc("/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/downvote", pollService.DownVotePollCandidate).Methods("PUT")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/quadratic-vote", signedVoteService.RequireVoter(http.HandlerFunc(pollService.CastQuadraticVote))).Methods("POST")
+	apiRouter.Handle("/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/token-vote", signedVoteService.RequireVoter(http.HandlerFunc(pollService.CastTokenVote))).Methods("POST")
+
+	// The original crypto_vote counters are the default poll
+	apiRouter.HandleFunc("/polls/default/cryptovote", cryptoService.GetAllCryptoCurrencies).Methods("GET")
+	apiRouter.HandleFunc("/polls/default/cryptovote/{id:[0-9]+}", cryptoService.GetCryptoCurrencyByID).Methods("GET")
+	apiRouter.HandleFunc("/polls/default/cryptovote/{id:[0-9]+}/challenge", challengeService.GetChallenge).Methods("GET")
+	apiRouter.HandleFunc("/polls/default/cryptovote/{id:[0-9]+}/upvote", cryptoService.UpVoteCryptoCurrency).Methods("PUT")
+	apiRouter.HandleFunc("/polls/default/cryptovote/{id:[0-9]+}/downvote", cryptoService.DownVoteCryptoCurrency).Methods("PUT")
+
+	// Register moderator endpoints behind admin authentication
+	moderationRouter := apiRouter.PathPrefix("/moderation").Subrouter()
+	moderationRouter.Use(requireAdminMiddleware)
+	moderationRouter.HandleFunc("/votes", moderationService.GetVoteEvents).Methods("GET")
+	moderationRouter.HandleFunc("/votes/{id:[0-9]+}/approve", moderationService.ApproveVote).Methods("POST")
+	moderationRouter.HandleFunc("/votes/{id:[0-9]+}/reject", moderationService.RejectVote).Methods("POST")
+
+	// Register admin endpoints behind admin authentication
+	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(requireAdminMiddleware)
+	adminRouter.HandleFunc("/audit", auditService.GetAuditLog).Methods("GET")
+	adminRouter.HandleFunc("/cryptovote/{id:[0-9]+}/merge", mergeService.MergeCryptoCurrency).Methods("POST")
+	adminRouter.HandleFunc("/cryptovote/{id:[0-9]+}/aliases", aliasService.AddAlias).Methods("POST")
+	adminRouter.HandleFunc("/cryptovote/{id:[0-9]+}/aliases/{alias}", aliasService.DeleteAlias).Methods("DELETE")
+	adminRouter.HandleFunc("/cryptovote/{id:[0-9]+}/tags/{tag}", tagService.AddTag).Methods("PUT")
+	adminRouter.HandleFunc("/cryptovote/{id:[0-9]+}/tags/{tag}", tagService.RemoveTag).Methods("DELETE")
+	adminRouter.HandleFunc("/voters/{voterId:[0-9]+}/wallets/{address}", pollService.VerifyWallet).Methods("PUT")
+	adminRouter.HandleFunc("/webhooks", webhookService.GetWebhooks).Methods("GET")
+	adminRouter.HandleFunc("/webhooks", webhookService.CreateWebhook).Methods("POST")
+	adminRouter.HandleFunc("/webhooks/dead-letters", webhookService.GetDeadLetters).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/deliveries/{deliveryId:[0-9]+}/retry", webhookService.RetryDelivery).Methods("POST")
+	adminRouter.HandleFunc("/webhooks/{id:[0-9]+}", webhookService.GetWebhook).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/{id:[0-9]+}", webhookService.DeleteWebhook).Methods("DELETE")
+	adminRouter.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", webhookService.GetWebhookDeliveries).Methods("GET")
+	if catalogCache != nil {
+		adminRouter.HandleFunc("/cache", catalogCache.GetStats).Methods("GET")
+	}
 
 	// Start the server
 	serverPort := os.Getenv("PORT")
@@ -54,6 +351,31 @@ func main() {
 	}
 
 	serverAddress := fmt.Sprintf(":%s", serverPort)
-	log.Println("Server listening on", serverAddress)
-	log.Fatal(http.ListenAndServe(serverAddress, myRouter))
+	server := &http.Server{Addr: serverAddress, Handler: myRouter}
+	go func() {
+		log.Println("Server listening on", serverAddress)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Shut down gracefully on SIGINT or SIGTERM, finishing the requests in flight
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), durationFromEnv("SHUTDOWN_TIMEOUT", 10*time.Second))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error shutting down server:", err)
+	}
+
+	// Flush the votes still waiting in the batch
+	if voteBatcher != nil {
+		if err := voteBatcher.Close(ctx); err != nil {
+			log.Println("Error flushing votes:", err)
+			os.Exit(1)
+		}
+	}
 }
\ No newline at end of file
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type MergeService struct {
+	db      Database
+	audit   *AuditService
+	events  eventSinks
+	cache   *ReadThroughCache
+	batcher *VoteBatcher
+}
+
+func NewMergeService(db *sql.DB) *MergeService {
+	return &MergeService{
+		db: db,
+	}
+}
+
+// EnableAuditLog records merges in the audit log.
+func (s *MergeService) EnableAuditLog(audit *AuditService) {
+	s.audit = audit
+}
+
+// EnableCache invalidates the cached catalog reads after every merge.
+func (s *MergeService) EnableCache(cache *ReadThroughCache) {
+	s.cache = cache
+}
+
+// UseVoteBatcher flushes the batched votes of a cryptocurrency before it is
+// merged, so they are moved to the survivor with the stored ones.
+func (s *MergeService) UseVoteBatcher(batcher *VoteBatcher) {
+	s.batcher = batcher
+}
+
+// AddEventSinks records merges as domain events in the sinks, in the same
+// transaction as the merge.
+func (s *MergeService) AddEventSinks(sinks ...EventSink) {
+	s.events = append(s.events, sinks...)
+}
+
+// MergeCryptoCurrency folds the cryptocurrency into the one given in the
+// request body. Its votes are added to the survivor, except the signed votes
+// of voters who already voted on the survivor, and the old ID is redirected
+// to the survivor. Its quarantined votes are rejected.
+func (s *MergeService) MergeCryptoCurrency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	sourceID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Into int `json:"into"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if request.Into == sourceID {
+		http.Error(w, "Cannot merge a cryptocurrency into itself", http.StatusBadRequest)
+		return
+	}
+
+	// Stop counting batched votes for the merged cryptocurrency and write the
+	// pending ones, otherwise they would be flushed to a removed row
+	if s.batcher != nil {
+		s.batcher.Forget(sourceID)
+		if _, err := s.batcher.Flush(); err != nil {
+			log.Println("Error flushing votes:", err)
+			http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tx, err := s.events.BeginTx(s.db)
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock both rows so no vote lands on the source while it is merged
+	var source, survivor CryptoCurrency
+	err = tx.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL FOR UPDATE", sourceID).
+		Scan(&source.ID, &source.Name, &source.UpVote, &source.DownVote, &source.TotalVotes)
+	if err == nil {
+		err = tx.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL FOR UPDATE", request.Into).
+			Scan(&survivor.ID, &survivor.Name, &survivor.UpVote, &survivor.DownVote, &survivor.TotalVotes)
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	before := []CryptoCurrency{source, survivor}
+	merge := CryptoCurrencyMerge{MergedID: source.ID}
+
+	// Signed voters who voted on both count once: their votes on the source
+	// are dropped. Anonymous votes can't be matched and are all kept, so are
+	// recorded votes since their X-Voter-ID header is not authenticated and
+	// anyone could claim another voter's ID to have their votes dropped.
+	// Signed votes can't be re-attributed without breaking their signature,
+	// they keep the source ID and are followed through the redirect.
+	var signedUp, signedDown int
+	err = tx.QueryRow(`SELECT COALESCE(SUM(e.direction = 'up'), 0), COALESCE(SUM(e.direction = 'down'), 0) FROM signed_votes e
+		JOIN (SELECT DISTINCT voter_id FROM signed_votes WHERE crypto_id = ?) d ON d.voter_id = e.voter_id
+		WHERE e.crypto_id = ?`,
+		survivor.ID, source.ID).Scan(&signedUp, &signedDown)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	merge.DuplicateUpVotes = signedUp
+	merge.DuplicateDownVotes = signedDown
+	merge.MovedUpVotes = source.UpVote - merge.DuplicateUpVotes
+	merge.MovedDownVotes = source.DownVote - merge.DuplicateDownVotes
+
+	// Quarantined votes were screened against the merged cryptocurrency and
+	// approving them later would count voters twice, they are rejected
+	result, err := tx.Exec("UPDATE vote_events SET status = ? WHERE crypto_id = ? AND status = ?", VoteStatusRejected, source.ID, VoteStatusQuarantined)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	rejected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+	merge.RejectedVotes = int(rejected)
+
+	// Re-attribute the remaining recorded votes
+	_, err = tx.Exec("UPDATE vote_events SET crypto_id = ? WHERE crypto_id = ?", survivor.ID, source.ID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE crypto_vote SET up_vote = up_vote + ?, down_vote = down_vote + ?, total_votes = up_vote + down_vote WHERE id = ?",
+		merge.MovedUpVotes, merge.MovedDownVotes, survivor.ID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	// The aliases of the merged cryptocurrency now point to the survivor
+	_, err = tx.Exec("UPDATE crypto_aliases SET crypto_id = ? WHERE crypto_id = ?", survivor.ID, source.ID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	// So do its tags, without duplicating the ones both already share
+	_, err = tx.Exec("INSERT IGNORE INTO crypto_tags (crypto_id, tag_id) SELECT ?, tag_id FROM crypto_tags WHERE crypto_id = ?", survivor.ID, source.ID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM crypto_tags WHERE crypto_id = ?", source.ID)
+	}
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	// Candidacies in polls move over too, adding up the votes when both
+	// cryptocurrencies are candidates of the same poll
+	_, err = tx.Exec(`INSERT INTO poll_candidates (poll_id, crypto_id, up_vote, down_vote, weighted_votes)
+		SELECT poll_id, ?, up_vote, down_vote, weighted_votes FROM poll_candidates WHERE crypto_id = ?
+		ON DUPLICATE KEY UPDATE up_vote = poll_candidates.up_vote + VALUES(up_vote), down_vote = poll_candidates.down_vote + VALUES(down_vote),
+			weighted_votes = poll_candidates.weighted_votes + VALUES(weighted_votes)`, survivor.ID, source.ID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM poll_candidates WHERE crypto_id = ?", source.ID)
+	}
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	// A voter who put quadratic votes on both keeps the larger weight
+	if err := mergeQuadraticVotes(tx, source.ID, survivor.ID); err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	// Token-weighted votes and revealed commitments are one per voter and
+	// poll, they simply move
+	_, err = tx.Exec("UPDATE poll_token_votes SET crypto_id = ? WHERE crypto_id = ?", survivor.ID, source.ID)
+	if err == nil {
+		_, err = tx.Exec("UPDATE poll_commitments SET crypto_id = ? WHERE crypto_id = ?", survivor.ID, source.ID)
+	}
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	err = mergeBallots(tx, source.ID, survivor.ID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	// The vote history of the merged cryptocurrency is added to the survivor's
+	_, err = tx.Exec(`INSERT INTO vote_buckets (crypto_id, bucket_start, up_vote, down_vote)
+		SELECT ?, bucket_start, up_vote, down_vote FROM vote_buckets WHERE crypto_id = ?
+		ON DUPLICATE KEY UPDATE up_vote = vote_buckets.up_vote + VALUES(up_vote), down_vote = vote_buckets.down_vote + VALUES(down_vote)`, survivor.ID, source.ID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM vote_buckets WHERE crypto_id = ?", source.ID)
+	}
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM crypto_vote WHERE id = ?", source.ID)
+	if err != nil {
+		log.Println("Error deleting from database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	// Point older redirects straight at the survivor to avoid chains
+	_, err = tx.Exec("UPDATE crypto_redirects SET to_id = ? WHERE to_id = ?", survivor.ID, source.ID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO crypto_redirects (from_id, to_id, created_at) VALUES (?, ?, UTC_TIMESTAMP())", source.ID, survivor.ID)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	survivor.UpVote += merge.MovedUpVotes
+	survivor.DownVote += merge.MovedDownVotes
+	survivor.TotalVotes = survivor.UpVote + survivor.DownVote
+	merge.Survivor = survivor
+
+	err = s.audit.Record(tx, r, AuditActionMerge, source.ID, before, merge)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	tx.Append(DomainEventCryptoMerged, source.ID, merge)
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error merging cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	s.cache.Invalidate(catalogCacheKeys...)
+
+	json.NewEncoder(w).Encode(merge)
+}
+
+// mergeQuadraticVotes moves the quadratic votes to the survivor. A voter who
+// voted on both keeps the larger weight: adding them up would hold a+b votes
+// paid a²+b² credits instead of (a+b)². The cost of the smaller weight is
+// refunded and the weight is taken off the survivor's candidacies.
+func mergeQuadraticVotes(tx executor, sourceID, survivorID int) error {
+	_, err := tx.Exec(`UPDATE poll_credits c JOIN (SELECT s.poll_id, s.voter_id, LEAST(s.weight, v.weight) AS dropped FROM poll_quadratic_votes s
+		JOIN poll_quadratic_votes v ON v.poll_id = s.poll_id AND v.voter_id = s.voter_id AND v.crypto_id = ?
+		WHERE s.crypto_id = ?) d ON d.poll_id = c.poll_id AND d.voter_id = c.voter_id
+		SET c.spent = c.spent - d.dropped * d.dropped`, survivorID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE poll_candidates pc JOIN (SELECT s.poll_id, SUM(LEAST(s.weight, v.weight)) AS dropped FROM poll_quadratic_votes s
+		JOIN poll_quadratic_votes v ON v.poll_id = s.poll_id AND v.voter_id = s.voter_id AND v.crypto_id = ?
+		WHERE s.crypto_id = ? GROUP BY s.poll_id) d ON d.poll_id = pc.poll_id
+		SET pc.weighted_votes = pc.weighted_votes - d.dropped WHERE pc.crypto_id = ?`, survivorID, sourceID, survivorID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO poll_quadratic_votes (poll_id, voter_id, crypto_id, weight)
+		SELECT poll_id, voter_id, ?, weight FROM poll_quadratic_votes WHERE crypto_id = ?
+		ON DUPLICATE KEY UPDATE weight = GREATEST(poll_quadratic_votes.weight, VALUES(weight))`, survivorID, sourceID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM poll_quadratic_votes WHERE crypto_id = ?", sourceID)
+	return err
+}
+
+// mergeBallots replaces the merged cryptocurrency by the survivor in the
+// rankings of the ranked-choice ballots.
+func mergeBallots(tx *EventTx, sourceID, survivorID int) error {
+	return rewriteBallots(tx, sourceID, func(ranking []int) []int {
+		return mergeRanking(ranking, sourceID, survivorID)
+	})
+}
+
+// mergeRanking replaces the merged cryptocurrency by the survivor in the
+// ranking. When both are ranked the survivor keeps the better place.
+func mergeRanking(ranking []int, sourceID, survivorID int) []int {
+	merged := make([]int, 0, len(ranking))
+	ranked := false
+	for _, cryptoID := range ranking {
+		if cryptoID == sourceID {
+			cryptoID = survivorID
+		}
+		if cryptoID == survivorID {
+			if ranked {
+				continue
+			}
+			ranked = true
+		}
+		merged = append(merged, cryptoID)
+	}
+	return merged
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeCryptoCurrency(t *testing.T) {
+	cryptoColumns := []string{"id", "name", "up_vote", "down_vote", "total_votes"}
+
+	t.Run("MergeIntoSurvivor", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		mergeService := NewMergeService(db)
+
+		// Set the expectations for locking both cryptocurrencies
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, name, .* FROM crypto_vote WHERE id=\\? AND deleted_at IS NULL FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(2, "bitcoin", 10, 4, 14))
+		mock.ExpectQuery("SELECT id, name, .* FROM crypto_vote WHERE id=\\? AND deleted_at IS NULL FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(1, "Bitcoin", 100, 20, 120))
+
+		// One signed down vote comes from a voter who voted on both, recorded
+		// votes are all kept
+		mock.ExpectQuery("FROM signed_votes e").
+			WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"up", "down"}).AddRow(0, 1))
+
+		// One quarantined vote on the merged cryptocurrency is rejected
+		mock.ExpectExec("UPDATE vote_events SET status = \\? WHERE crypto_id = \\? AND status = \\?").
+			WithArgs(VoteStatusRejected, 2, VoteStatusQuarantined).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		// Set the expectations for moving the votes and leaving the redirect
+		mock.ExpectExec("UPDATE vote_events SET crypto_id = \\? WHERE crypto_id = \\?").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 12))
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ \\?, down_vote = down_vote \\+ \\?").
+			WithArgs(10, 3, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE crypto_aliases SET crypto_id = \\? WHERE crypto_id = \\?").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT IGNORE INTO crypto_tags").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM crypto_tags WHERE crypto_id = ?").
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO poll_candidates \\(poll_id, crypto_id, up_vote, down_vote, weighted_votes\\)").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM poll_candidates WHERE crypto_id = ?").
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		expectQuadraticMerge(mock, 0, 1)
+		mock.ExpectExec("UPDATE poll_token_votes SET crypto_id = \\? WHERE crypto_id = \\?").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE poll_commitments SET crypto_id = \\? WHERE crypto_id = \\?").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		// A ballot ranking both keeps the survivor at the better place
+		mock.ExpectQuery("SELECT id, ranking FROM poll_ballots WHERE JSON_CONTAINS\\(ranking, \\?\\) FOR UPDATE").
+			WithArgs("2").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "ranking"}).AddRow(7, "[3, 2, 5, 1]"))
+		mock.ExpectExec("UPDATE poll_ballots SET ranking = \\? WHERE id = \\?").
+			WithArgs("[3,1,5]", 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectExec("INSERT INTO vote_buckets \\(crypto_id, bucket_start, up_vote, down_vote\\)").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM vote_buckets WHERE crypto_id = ?").
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM crypto_vote WHERE id = ?").
+			WithArgs(2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE crypto_redirects SET to_id = \\? WHERE to_id = \\?").
+			WithArgs(1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO crypto_redirects").
+			WithArgs(2, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/admin/cryptovote/2/merge", strings.NewReader(`{"into": 1}`))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/merge", mergeService.MergeCryptoCurrency).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var merge CryptoCurrencyMerge
+		err = json.Unmarshal(rr.Body.Bytes(), &merge)
+		assert.NoError(t, err)
+
+		expectedMerge := CryptoCurrencyMerge{
+			MergedID:           2,
+			Survivor:           CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 110, DownVote: 23, TotalVotes: 133},
+			MovedUpVotes:       10,
+			MovedDownVotes:     3,
+			DuplicateUpVotes:   0,
+			DuplicateDownVotes: 1,
+			RejectedVotes:      1,
+		}
+		assert.Equal(t, expectedMerge, merge)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("FlushesBatchedVotes", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		mergeService := NewMergeService(db)
+		batcher := newVoteBatcher(db, nil, nil, nil)
+		mergeService.UseVoteBatcher(batcher)
+
+		mock.ExpectQuery("FROM crypto_vote WHERE id=?").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(2, "bitcoin", 10, 4, 14))
+		_, err = batcher.Vote(2, "up", time.Now(), nil)
+		assert.NoError(t, err)
+
+		// The pending vote is written before the merge, which stops at the
+		// missing survivor
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ CASE id").
+			WithArgs(2, 1, 2, 0, 2).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("FROM crypto_vote WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(2, "bitcoin", 11, 4, 15))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id, name, .* FROM crypto_vote WHERE id=\\? AND deleted_at IS NULL FOR UPDATE").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(2, "bitcoin", 11, 4, 15))
+		mock.ExpectQuery("SELECT id, name, .* FROM crypto_vote WHERE id=\\? AND deleted_at IS NULL FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(cryptoColumns))
+		mock.ExpectRollback()
+
+		req, err := http.NewRequest("POST", "/v1/admin/cryptovote/2/merge", strings.NewReader(`{"into": 1}`))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/merge", mergeService.MergeCryptoCurrency).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		// The cryptocurrency is no longer batched, it is read again on the next
+		// vote
+		assert.Empty(t, batcher.cryptos)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("MergeIntoItself", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		mergeService := NewMergeService(db)
+
+		req, err := http.NewRequest("POST", "/v1/admin/cryptovote/1/merge", strings.NewReader(`{"into": 1}`))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/merge", mergeService.MergeCryptoCurrency).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestGetMergedCryptoCurrencyRedirects(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cryptoService := NewCryptoCurrencyService(db)
+
+	// The merged cryptocurrency no longer exists but has a redirect
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT to_id FROM crypto_redirects WHERE from_id = ?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"to_id"}).AddRow(1))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/cryptovote/2", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/{id:[0-9]+}", cryptoService.GetCryptoCurrencyByID).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and the redirect target
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, "/v1/cryptovote/1", rr.Header().Get("Location"))
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMergeQuadraticVotes(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// A voter who put 3 votes on both keeps 3 on the survivor and gets the
+	// 9 credits of the other 3 back
+	expectQuadraticMerge(mock, 1, 1)
+
+	err = mergeQuadraticVotes(db, 2, 1)
+	assert.NoError(t, err)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectQuadraticMerge sets the expectations for merging the quadratic votes
+// of cryptocurrency 2 into 1, refunding the given number of voters.
+func expectQuadraticMerge(mock sqlmock.Sqlmock, refunded, moved int64) {
+	mock.ExpectExec("UPDATE poll_credits c JOIN \\(SELECT s.poll_id, s.voter_id, LEAST\\(s.weight, v.weight\\) AS dropped .* SET c.spent = c.spent - d.dropped \\* d.dropped").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, refunded))
+	mock.ExpectExec("UPDATE poll_candidates pc JOIN \\(SELECT s.poll_id, SUM\\(LEAST\\(s.weight, v.weight\\)\\) AS dropped .* SET pc.weighted_votes = pc.weighted_votes - d.dropped").
+		WithArgs(1, 2, 1).
+		WillReturnResult(sqlmock.NewResult(0, refunded))
+	mock.ExpectExec("INSERT INTO poll_quadratic_votes \\(poll_id, voter_id, crypto_id, weight\\) .* GREATEST\\(poll_quadratic_votes.weight, VALUES\\(weight\\)\\)").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, moved))
+	mock.ExpectExec("DELETE FROM poll_quadratic_votes WHERE crypto_id = ?").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, moved))
+}
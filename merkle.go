@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/bits"
+)
+
+// Merkle tree hashing as specified by RFC 6962 (Certificate Transparency).
+// Leaves and interior nodes use different prefixes so a leaf can never be
+// passed off as a subtree.
+
+func merkleLeafHash(data []byte) []byte {
+	hash := sha256.Sum256(append([]byte{0x00}, data...))
+	return hash[:]
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, 0x01)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	hash := sha256.Sum256(buf)
+	return hash[:]
+}
+
+// merkleSplit returns the largest power of two smaller than n.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleRoot computes the tree head over the given leaf hashes.
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		hash := sha256.Sum256(nil)
+		return hash[:]
+	case 1:
+		return leaves[0]
+	}
+
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// merkleInclusionProof returns the audit path of the leaf at index m.
+func merkleInclusionProof(m int, leaves [][]byte) [][]byte {
+	return merkleRangeRoots(merkleInclusionRanges(m, len(leaves)), leaves)
+}
+
+// merkleConsistencyProof proves that the tree of the first m leaves is a
+// prefix of the tree over all the leaves.
+func merkleConsistencyProof(m int, leaves [][]byte) [][]byte {
+	return merkleRangeRoots(merkleConsistencyRanges(m, len(leaves)), leaves)
+}
+
+func merkleRangeRoots(ranges []merkleRange, leaves [][]byte) [][]byte {
+	roots := make([][]byte, len(ranges))
+	for i, r := range ranges {
+		roots[i] = merkleRoot(leaves[r.lo:r.hi])
+	}
+	return roots
+}
+
+// merkleRange is the subtree over the leaves [lo, hi). The proofs are made of
+// the roots of such subtrees, which never need more than the hashes of
+// their complete subtrees.
+type merkleRange struct {
+	lo, hi int
+}
+
+// merkleInclusionRanges returns the subtrees whose roots make up the audit
+// path of the leaf at index m in the tree of n leaves.
+func merkleInclusionRanges(m, n int) []merkleRange {
+	return merkleInclusionSubranges(m, merkleRange{0, n})
+}
+
+func merkleInclusionSubranges(m int, r merkleRange) []merkleRange {
+	if r.hi-r.lo <= 1 {
+		return nil
+	}
+
+	k := merkleSplit(r.hi - r.lo)
+	if m < k {
+		return append(merkleInclusionSubranges(m, merkleRange{r.lo, r.lo + k}), merkleRange{r.lo + k, r.hi})
+	}
+	return append(merkleInclusionSubranges(m-k, merkleRange{r.lo + k, r.hi}), merkleRange{r.lo, r.lo + k})
+}
+
+// merkleConsistencyRanges returns the subtrees whose roots make up the
+// consistency proof between the trees of m and n leaves.
+func merkleConsistencyRanges(m, n int) []merkleRange {
+	if m <= 0 || m >= n {
+		return nil
+	}
+	return merkleSubproofRanges(m, merkleRange{0, n}, true)
+}
+
+func merkleSubproofRanges(m int, r merkleRange, complete bool) []merkleRange {
+	if m == r.hi-r.lo {
+		if complete {
+			return nil
+		}
+		return []merkleRange{r}
+	}
+
+	k := merkleSplit(r.hi - r.lo)
+	if m <= k {
+		return append(merkleSubproofRanges(m, merkleRange{r.lo, r.lo + k}, complete), merkleRange{r.lo + k, r.hi})
+	}
+	return append(merkleSubproofRanges(m-k, merkleRange{r.lo + k, r.hi}, false), merkleRange{r.lo, r.lo + k})
+}
+
+// merkleNode is the root of the complete subtree over the leaves
+// [index << level, (index + 1) << level). The nodes of level 0 are the leaves.
+// Once all its leaves are sealed a node never changes, so its hash can be
+// stored.
+type merkleNode struct {
+	level, index int
+}
+
+// nodes returns the complete subtrees the root of the range is computed from,
+// at most two per level. The range must start at a multiple of the largest
+// power of two below its size, as all the ranges of the proofs do.
+func (r merkleRange) nodes() []merkleNode {
+	n := r.hi - r.lo
+	if n&(n-1) == 0 {
+		level := bits.TrailingZeros(uint(n))
+		return []merkleNode{{level, r.lo >> level}}
+	}
+
+	k := merkleSplit(n)
+	return append(merkleRange{r.lo, r.lo + k}.nodes(), merkleRange{r.lo + k, r.hi}.nodes()...)
+}
+
+// root computes the root of the range from the hashes of its complete
+// subtrees.
+func (r merkleRange) root(hashes map[merkleNode][]byte) []byte {
+	n := r.hi - r.lo
+	if n == 0 {
+		return merkleRoot(nil)
+	}
+	if n&(n-1) == 0 {
+		level := bits.TrailingZeros(uint(n))
+		return hashes[merkleNode{level, r.lo >> level}]
+	}
+
+	k := merkleSplit(n)
+	return merkleNodeHash(merkleRange{r.lo, r.lo + k}.root(hashes), merkleRange{r.lo + k, r.hi}.root(hashes))
+}
+
+// merkleNewNodes returns the interior nodes completed by growing the tree
+// from oldSize to newSize leaves, children before their parents.
+func merkleNewNodes(oldSize, newSize int) []merkleNode {
+	var nodes []merkleNode
+	for level := 1; 1<<level <= newSize; level++ {
+		for index := oldSize >> level; index < newSize>>level; index++ {
+			nodes = append(nodes, merkleNode{level, index})
+		}
+	}
+	return nodes
+}
+
+// hash computes the hash of an interior node from the hashes of its children.
+func (n merkleNode) hash(hashes map[merkleNode][]byte) []byte {
+	return merkleNodeHash(hashes[merkleNode{n.level - 1, 2 * n.index}], hashes[merkleNode{n.level - 1, 2*n.index + 1}])
+}
+
+// verifyMerkleInclusion checks an audit path against a tree head, following
+// RFC 9162 section 2.1.3.2. Auditors can use the same algorithm.
+func verifyMerkleInclusion(index, treeSize int, leafHash []byte, proof [][]byte, root []byte) bool {
+	if index < 0 || index >= treeSize {
+		return false
+	}
+
+	fn, sn := index, treeSize-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// verifyMerkleConsistency checks a consistency proof between two tree heads,
+// following RFC 9162 section 2.1.4.2.
+func verifyMerkleConsistency(firstSize, secondSize int, firstRoot, secondRoot []byte, proof [][]byte) bool {
+	if firstSize <= 0 || firstSize > secondSize {
+		return false
+	}
+	if firstSize == secondSize {
+		return len(proof) == 0 && bytes.Equal(firstRoot, secondRoot)
+	}
+
+	// When the first tree is complete its root is the starting point
+	if firstSize&(firstSize-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	if len(proof) == 0 {
+		return false
+	}
+
+	fn, sn := firstSize-1, secondSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+
+		if fn&1 == 1 || fn == sn {
+			fr = merkleNodeHash(c, fr)
+			sr = merkleNodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = merkleNodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && bytes.Equal(fr, firstRoot) && bytes.Equal(sr, secondRoot)
+}
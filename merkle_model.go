@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TreeHead is a signed commitment to the first TreeSize leaves of the vote log.
+type TreeHead struct {
+	TreeSize  int       `json:"tree_size"`
+	RootHash  string    `json:"root_hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Signature string    `json:"signature"`
+}
+
+// Message returns the bytes signed by the server for the tree head.
+func (h TreeHead) Message() []byte {
+	return []byte(fmt.Sprintf("crypto-vote-sth:%d:%d:%s", h.TreeSize, h.Timestamp.Unix(), h.RootHash))
+}
+
+type InclusionProof struct {
+	VoteID    int      `json:"vote_id"`
+	LeafIndex int      `json:"leaf_index"`
+	LeafHash  string   `json:"leaf_hash"`
+	AuditPath []string `json:"audit_path"`
+	TreeHead  TreeHead `json:"tree_head"`
+}
+
+type ConsistencyProof struct {
+	First  TreeHead `json:"first"`
+	Second TreeHead `json:"second"`
+	Proof  []string `json:"proof"`
+}
+
+// merkleLeafData returns the serialization of a signed vote that is hashed
+// into the tree: its ledger ID, the voter key, the signed message and the
+// signature, one per line.
+func merkleLeafData(vote SignedVote) []byte {
+	return []byte(fmt.Sprintf("%d\n%s\n%s\n%s", vote.ID, vote.PublicKey, vote.Message(), vote.Signature))
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Maximum number of ledger votes sealed into the tree at once.
+const merkleSealBatchSize = 10000
+
+// MerkleService seals the signed vote ledger into an append-only Merkle tree,
+// publishes signed tree heads and serves inclusion and consistency proofs.
+type MerkleService struct {
+	db         Database
+	signingKey ed25519.PrivateKey
+
+	// Sealing is not safe to run concurrently
+	mu sync.Mutex
+}
+
+func NewMerkleService(db *sql.DB, signingKey ed25519.PrivateKey) *MerkleService {
+	return &MerkleService{
+		db:         db,
+		signingKey: signingKey,
+	}
+}
+
+// StartSealing seals new ledger votes every interval in the background.
+func (s *MerkleService) StartSealing(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			head, err := s.Seal()
+			if err != nil {
+				log.Println("Error sealing vote batch:", err)
+				continue
+			}
+			if head != nil {
+				log.Println("Published tree head of size", head.TreeSize)
+			}
+		}
+	}()
+}
+
+// Seal appends the ledger votes not sealed yet as leaves of the tree and
+// publishes a signed tree head, in a single transaction. It returns nil when
+// there was nothing to seal.
+func (s *MerkleService) Seal() (*TreeHead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var oldSize int
+	err = tx.QueryRow("SELECT COUNT(*) FROM merkle_leaves").Scan(&oldSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Votes are picked by whether they were sealed rather than by ID, since a
+	// vote can commit after a vote with a higher ID was sealed
+	rows, err := tx.Query(`SELECT v.id, k.public_key, v.crypto_id, v.direction, v.nonce, v.timestamp, v.signature
+		FROM signed_votes v JOIN voters k ON k.id = v.voter_id LEFT JOIN merkle_leaves l ON l.vote_id = v.id
+		WHERE l.vote_id IS NULL ORDER BY v.id LIMIT ?`, merkleSealBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []SignedVote
+	for rows.Next() {
+		var vote SignedVote
+		if err := rows.Scan(&vote.ID, &vote.PublicKey, &vote.CryptoID, &vote.Direction, &vote.Nonce, &vote.Timestamp, &vote.Signature); err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(votes) == 0 {
+		return nil, nil
+	}
+
+	hashes := make(map[merkleNode][]byte)
+	treeSize := oldSize
+	for _, vote := range votes {
+		leafHash := merkleLeafHash(merkleLeafData(vote))
+		_, err := tx.Exec("INSERT INTO merkle_leaves (leaf_index, vote_id, leaf_hash) VALUES (?, ?, ?)",
+			treeSize, vote.ID, hex.EncodeToString(leafHash))
+		if err != nil {
+			return nil, err
+		}
+		hashes[merkleNode{0, treeSize}] = leafHash
+		treeSize++
+	}
+
+	// Load the nodes sealed before that the new nodes and the root are
+	// computed from
+	newNodes := merkleNewNodes(oldSize, treeSize)
+	isNew := make(map[merkleNode]bool, len(newNodes))
+	for _, node := range newNodes {
+		isNew[node] = true
+	}
+
+	var sealed []merkleNode
+	needed := merkleRange{0, treeSize}.nodes()
+	for _, node := range newNodes {
+		needed = append(needed, merkleNode{node.level - 1, 2 * node.index})
+	}
+	for _, node := range needed {
+		if _, ok := hashes[node]; !ok && !isNew[node] {
+			sealed = append(sealed, node)
+		}
+	}
+	if err := loadMerkleNodes(tx, sealed, hashes); err != nil {
+		return nil, err
+	}
+
+	for _, node := range newNodes {
+		hashes[node] = node.hash(hashes)
+		_, err := tx.Exec("INSERT INTO merkle_nodes (level, node_index, hash) VALUES (?, ?, ?)",
+			node.level, node.index, hex.EncodeToString(hashes[node]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	head := TreeHead{
+		TreeSize:  treeSize,
+		RootHash:  hex.EncodeToString(merkleRange{0, treeSize}.root(hashes)),
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+	head.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.signingKey, head.Message()))
+
+	_, err = tx.Exec("INSERT INTO tree_heads (tree_size, root_hash, timestamp, signature) VALUES (?, ?, ?, ?)",
+		head.TreeSize, head.RootHash, head.Timestamp, head.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &head, nil
+}
+
+func (s *MerkleService) GetPublicKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(s.signingKey.Public().(ed25519.PublicKey)),
+	})
+}
+
+func (s *MerkleService) GetLatestTreeHead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	head, err := s.getTreeHead(0)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No tree head has been published yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting tree head", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(head)
+}
+
+// GetInclusionProof returns the audit path proving that the vote is part of
+// the tree head of size tree_size, or of the latest tree head.
+func (s *MerkleService) GetInclusionProof(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	voteID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid vote ID", http.StatusBadRequest)
+		return
+	}
+
+	treeSize := 0
+	if value := r.URL.Query().Get("tree_size"); value != "" {
+		treeSize, err = strconv.Atoi(value)
+		if err != nil || treeSize <= 0 {
+			http.Error(w, "Invalid tree size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	proof := InclusionProof{VoteID: voteID}
+
+	err = s.db.QueryRow("SELECT leaf_index, leaf_hash FROM merkle_leaves WHERE vote_id = ?", voteID).Scan(&proof.LeafIndex, &proof.LeafHash)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Vote has not been sealed yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting inclusion proof", http.StatusInternalServerError)
+		return
+	}
+
+	proof.TreeHead, err = s.getTreeHead(treeSize)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Tree head does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting inclusion proof", http.StatusInternalServerError)
+		return
+	}
+
+	if proof.LeafIndex >= proof.TreeHead.TreeSize {
+		http.Error(w, "Vote is not included in this tree head", http.StatusNotFound)
+		return
+	}
+
+	auditPath, err := s.rangeRoots(merkleInclusionRanges(proof.LeafIndex, proof.TreeHead.TreeSize))
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting inclusion proof", http.StatusInternalServerError)
+		return
+	}
+
+	proof.AuditPath = encodeHashes(auditPath)
+
+	json.NewEncoder(w).Encode(proof)
+}
+
+// GetConsistencyProof proves that the tree head of size first is a prefix of
+// the tree head of size second, i.e. that no sealed vote was changed or
+// dropped in between.
+func (s *MerkleService) GetConsistencyProof(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	first, err := strconv.Atoi(r.URL.Query().Get("first"))
+	if err != nil || first <= 0 {
+		http.Error(w, "Invalid first tree size", http.StatusBadRequest)
+		return
+	}
+
+	second, err := strconv.Atoi(r.URL.Query().Get("second"))
+	if err != nil || second < first {
+		http.Error(w, "Invalid second tree size", http.StatusBadRequest)
+		return
+	}
+
+	var proof ConsistencyProof
+
+	proof.First, err = s.getTreeHead(first)
+	if err == nil {
+		proof.Second, err = s.getTreeHead(second)
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Tree head does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting consistency proof", http.StatusInternalServerError)
+		return
+	}
+
+	consistencyProof, err := s.rangeRoots(merkleConsistencyRanges(first, second))
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting consistency proof", http.StatusInternalServerError)
+		return
+	}
+
+	proof.Proof = encodeHashes(consistencyProof)
+
+	json.NewEncoder(w).Encode(proof)
+}
+
+// getTreeHead returns the tree head of the given size, or the latest one when
+// the size is zero.
+func (s *MerkleService) getTreeHead(treeSize int) (TreeHead, error) {
+	var head TreeHead
+	var err error
+
+	if treeSize == 0 {
+		err = s.db.QueryRow("SELECT tree_size, root_hash, timestamp, signature FROM tree_heads ORDER BY tree_size DESC LIMIT 1").
+			Scan(&head.TreeSize, &head.RootHash, &head.Timestamp, &head.Signature)
+	} else {
+		err = s.db.QueryRow("SELECT tree_size, root_hash, timestamp, signature FROM tree_heads WHERE tree_size = ?", treeSize).
+			Scan(&head.TreeSize, &head.RootHash, &head.Timestamp, &head.Signature)
+	}
+
+	return head, err
+}
+
+// rangeRoots returns the roots of the subtrees making up a proof, read from
+// the stored hashes of their complete subtrees rather than from every leaf.
+func (s *MerkleService) rangeRoots(ranges []merkleRange) ([][]byte, error) {
+	var nodes []merkleNode
+	for _, r := range ranges {
+		nodes = append(nodes, r.nodes()...)
+	}
+
+	hashes := make(map[merkleNode][]byte, len(nodes))
+	if err := loadMerkleNodes(s.db, nodes, hashes); err != nil {
+		return nil, err
+	}
+
+	roots := make([][]byte, len(ranges))
+	for i, r := range ranges {
+		roots[i] = r.root(hashes)
+	}
+	return roots, nil
+}
+
+// loadMerkleNodes reads the hashes of the nodes into hashes, the leaves from
+// merkle_leaves and the interior nodes from merkle_nodes.
+func loadMerkleNodes(q queryer, nodes []merkleNode, hashes map[merkleNode][]byte) error {
+	var leafArgs, nodeArgs []interface{}
+	for _, node := range nodes {
+		if node.level == 0 {
+			leafArgs = append(leafArgs, node.index)
+		} else {
+			nodeArgs = append(nodeArgs, node.level, node.index)
+		}
+	}
+
+	if len(leafArgs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(leafArgs)), ", ")
+		err := scanMerkleNodes(q, hashes, "SELECT 0, leaf_index, leaf_hash FROM merkle_leaves WHERE leaf_index IN ("+placeholders+")", leafArgs...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(nodeArgs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("(?, ?), ", len(nodeArgs)/2), ", ")
+		err := scanMerkleNodes(q, hashes, "SELECT level, node_index, hash FROM merkle_nodes WHERE (level, node_index) IN ("+placeholders+")", nodeArgs...)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, node := range nodes {
+		if _, ok := hashes[node]; !ok {
+			return fmt.Errorf("merkle node %d/%d is missing", node.level, node.index)
+		}
+	}
+	return nil
+}
+
+func scanMerkleNodes(q queryer, hashes map[merkleNode][]byte, query string, args ...interface{}) error {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var node merkleNode
+		var hash string
+		if err := rows.Scan(&node.level, &node.index, &hash); err != nil {
+			return err
+		}
+
+		decoded, err := hex.DecodeString(hash)
+		if err != nil {
+			return err
+		}
+		hashes[node] = decoded
+	}
+
+	return rows.Err()
+}
+
+func encodeHashes(hashes [][]byte) []string {
+	encoded := make([]string, len(hashes))
+	for i, hash := range hashes {
+		encoded[i] = hex.EncodeToString(hash)
+	}
+	return encoded
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeal(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, signingKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	merkleService := NewMerkleService(db, signingKey)
+
+	sealedLeaf := merkleLeafHash([]byte("sealed vote"))
+	votes := []SignedVote{
+		{ID: 3, PublicKey: "key", CryptoID: 1, Direction: "up", Nonce: "a", Timestamp: 1, Signature: "sig"},
+		{ID: 5, PublicKey: "key", CryptoID: 1, Direction: "down", Nonce: "b", Timestamp: 2, Signature: "sig"},
+	}
+
+	// Set the expectations for sealing two votes onto a tree of one leaf,
+	// the vote 3 committed after the vote 4 was sealed
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM merkle_leaves").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	rows := sqlmock.NewRows([]string{"id", "public_key", "crypto_id", "direction", "nonce", "timestamp", "signature"})
+	for _, vote := range votes {
+		rows.AddRow(vote.ID, vote.PublicKey, vote.CryptoID, vote.Direction, vote.Nonce, vote.Timestamp, vote.Signature)
+	}
+	mock.ExpectQuery("LEFT JOIN merkle_leaves l ON l.vote_id = v.id WHERE l.vote_id IS NULL ORDER BY v.id LIMIT \\?").
+		WithArgs(merkleSealBatchSize).
+		WillReturnRows(rows)
+	for i, vote := range votes {
+		mock.ExpectExec("INSERT INTO merkle_leaves").
+			WithArgs(1+i, vote.ID, hex.EncodeToString(merkleLeafHash(merkleLeafData(vote)))).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	// Only the sealed leaf the new node is computed from is read
+	mock.ExpectQuery("SELECT 0, leaf_index, leaf_hash FROM merkle_leaves WHERE leaf_index IN \\(\\?\\)").
+		WithArgs(0).
+		WillReturnRows(sqlmock.NewRows([]string{"level", "leaf_index", "leaf_hash"}).AddRow(0, 0, hex.EncodeToString(sealedLeaf)))
+
+	leaves := [][]byte{sealedLeaf, merkleLeafHash(merkleLeafData(votes[0])), merkleLeafHash(merkleLeafData(votes[1]))}
+	mock.ExpectExec("INSERT INTO merkle_nodes \\(level, node_index, hash\\)").
+		WithArgs(1, 0, hex.EncodeToString(merkleNodeHash(leaves[0], leaves[1]))).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO tree_heads").
+		WithArgs(3, hex.EncodeToString(merkleRoot(leaves)), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	head, err := merkleService.Seal()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, head.TreeSize)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
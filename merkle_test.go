@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = merkleLeafHash([]byte("vote " + strconv.Itoa(i)))
+	}
+	return leaves
+}
+
+func TestMerkleRoot(t *testing.T) {
+	// Root of the empty tree is the hash of the empty string
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hex.EncodeToString(merkleRoot(nil)))
+
+	// Three leaves split into a complete left subtree of two and a single right leaf
+	leaves := testLeaves(3)
+	expected := merkleNodeHash(merkleNodeHash(leaves[0], leaves[1]), leaves[2])
+	assert.Equal(t, expected, merkleRoot(leaves))
+}
+
+func TestMerkleInclusionProof(t *testing.T) {
+	for treeSize := 1; treeSize <= 17; treeSize++ {
+		leaves := testLeaves(treeSize)
+		root := merkleRoot(leaves)
+
+		for index := 0; index < treeSize; index++ {
+			proof := merkleInclusionProof(index, leaves)
+			assert.True(t, verifyMerkleInclusion(index, treeSize, leaves[index], proof, root), "size %d index %d", treeSize, index)
+
+			// An altered leaf must not verify
+			assert.False(t, verifyMerkleInclusion(index, treeSize, merkleLeafHash([]byte("forged")), proof, root))
+		}
+	}
+}
+
+func TestMerkleConsistencyProof(t *testing.T) {
+	for secondSize := 1; secondSize <= 17; secondSize++ {
+		leaves := testLeaves(secondSize)
+		secondRoot := merkleRoot(leaves)
+
+		for firstSize := 1; firstSize <= secondSize; firstSize++ {
+			firstRoot := merkleRoot(leaves[:firstSize])
+			proof := merkleConsistencyProof(firstSize, leaves)
+			assert.True(t, verifyMerkleConsistency(firstSize, secondSize, firstRoot, secondRoot, proof), "sizes %d and %d", firstSize, secondSize)
+		}
+	}
+
+	// Rewriting history breaks consistency with the earlier tree head
+	leaves := testLeaves(8)
+	firstRoot := merkleRoot(leaves[:5])
+	leaves[2] = merkleLeafHash([]byte("altered"))
+	proof := merkleConsistencyProof(5, leaves)
+	assert.False(t, verifyMerkleConsistency(5, 8, firstRoot, merkleRoot(leaves), proof))
+}
+
+func TestMerkleStoredNodes(t *testing.T) {
+	leaves := testLeaves(21)
+
+	// Grow the tree in uneven batches, storing the nodes each batch completes
+	hashes := make(map[merkleNode][]byte)
+	treeSize := 0
+	for _, batch := range []int{1, 2, 5, 1, 8, 4} {
+		oldSize := treeSize
+		for ; treeSize < oldSize+batch; treeSize++ {
+			hashes[merkleNode{0, treeSize}] = leaves[treeSize]
+		}
+		for _, node := range merkleNewNodes(oldSize, treeSize) {
+			_, ok := hashes[node]
+			assert.False(t, ok, "node %v computed twice", node)
+			hashes[node] = node.hash(hashes)
+		}
+
+		assert.Equal(t, merkleRoot(leaves[:treeSize]), merkleRange{0, treeSize}.root(hashes), "size %d", treeSize)
+	}
+
+	// The proofs computed from the stored nodes match the ones computed from
+	// every leaf
+	for index := 0; index < treeSize; index++ {
+		ranges := merkleInclusionRanges(index, treeSize)
+		for i, r := range ranges {
+			assert.Equal(t, merkleInclusionProof(index, leaves[:treeSize])[i], r.root(hashes))
+		}
+	}
+	for first := 1; first < treeSize; first++ {
+		ranges := merkleConsistencyRanges(first, treeSize)
+		for i, r := range ranges {
+			assert.Equal(t, merkleConsistencyProof(first, leaves[:treeSize])[i], r.root(hashes))
+		}
+	}
+}
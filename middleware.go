@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type contextKey string
+
+const (
+	requestIDContextKey contextKey = "request_id"
+	actorContextKey     contextKey = "actor"
+	voterContextKey     contextKey = "voter"
+)
+
+// Request ID middleware implementation. The X-Request-ID sent by the client
+// (or a proxy) is kept, otherwise a random one is generated. Either way it is
+// echoed back in the response.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 64 {
+			buf := make([]byte, 16)
+			rand.Read(buf)
+			requestID = hex.EncodeToString(buf)
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey, requestID)))
+	})
+}
+
+// Admin middleware implementation. Moderator and admin routes require the
+// ADMIN_TOKEN environment variable to be sent as a bearer token.
+func requireAdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if os.Getenv("ADMIN_TOKEN") == "" {
+			http.Error(w, "Admin access is not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		if !isAdmin(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorContextKey, "admin")))
+	})
+}
+
+// isAdmin reports whether the request carries the admin bearer token. It is
+// used by routes that are public but show more to admins.
+func isAdmin(r *http.Request) bool {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+// requestID returns the ID assigned to the request by requestIDMiddleware.
+func requestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// actor identifies who performed the request from its credentials: "admin"
+// on authenticated admin routes, "voter:{id}" on routes signed by a
+// registered voter, otherwise "anonymous". The X-Voter-ID header is chosen by
+// the client and never identifies the actor.
+func actor(r *http.Request) string {
+	if actor, ok := r.Context().Value(actorContextKey).(string); ok {
+		return actor
+	}
+	return "anonymous"
+}
+
+// clientIP returns the address of the client that sent the request. The
+// X-Forwarded-For header is only honoured when TRUST_PROXY_HEADERS is set,
+// otherwise any client could pick its own IP. Every proxy appends the address
+// it received the request from, so the client is the entry added by the
+// outermost trusted proxy and the entries left of it are chosen by the client.
+func clientIP(r *http.Request) string {
+	if proxies := trustedProxies(); proxies > 0 {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			entries := strings.Split(strings.Join(forwarded, ","), ",")
+			client := len(entries) - proxies
+			if client < 0 {
+				client = 0
+			}
+			return strings.TrimSpace(entries[client])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trustedProxies returns the number of proxies in front of the server from
+// TRUST_PROXY_HEADERS, one unless it is set to a larger count.
+func trustedProxies() int {
+	value := os.Getenv("TRUST_PROXY_HEADERS")
+	if value == "" {
+		return 0
+	}
+	if proxies, err := strconv.Atoi(value); err == nil && proxies > 1 {
+		return proxies
+	}
+	return 1
+}
+
+// authenticatedVoter returns the ID of the registered voter who signed the
+// request, on routes behind RequireVoter.
+func authenticatedVoter(r *http.Request) (string, bool) {
+	voter, ok := r.Context().Value(voterContextKey).(string)
+	return voter, ok
+}
+
+// voterID returns the optional voter identifier sent by the client. It is
+// not authenticated and only serves as a hint to vote screening.
+func voterID(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Voter-ID"))
+}
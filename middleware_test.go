@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIP(t *testing.T) {
+	req, err := http.NewRequest("GET", "/v1/cryptovote", nil)
+	assert.NoError(t, err)
+	req.RemoteAddr = "10.0.0.2:5000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 198.51.100.4, 10.0.0.1")
+
+	// The forwarded addresses are ignored unless the proxies are trusted
+	assert.Equal(t, "10.0.0.2", clientIP(req))
+
+	// The entries left of the ones added by the trusted proxies are chosen
+	// by the client
+	t.Setenv("TRUST_PROXY_HEADERS", "true")
+	assert.Equal(t, "10.0.0.1", clientIP(req))
+
+	t.Setenv("TRUST_PROXY_HEADERS", "2")
+	assert.Equal(t, "198.51.100.4", clientIP(req))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type ModerationService struct {
+	db        Database
+	audit     *AuditService
+	observers voteObservers
+	events    eventSinks
+	webhooks  *WebhookService
+}
+
+func NewModerationService(db *sql.DB) *ModerationService {
+	return &ModerationService{
+		db: db,
+	}
+}
+
+// EnableAuditLog records vote reviews in the audit log.
+func (s *ModerationService) EnableAuditLog(audit *AuditService) {
+	s.audit = audit
+}
+
+// AddEventSinks records approved votes as domain events in the sinks, in the
+// same transaction as the review.
+func (s *ModerationService) AddEventSinks(sinks ...EventSink) {
+	s.events = append(s.events, sinks...)
+}
+
+// EnableWebhooks publishes the vote milestones reached by approved votes to
+// the webhook subscriptions.
+func (s *ModerationService) EnableWebhooks(webhooks *WebhookService) {
+	s.webhooks = webhooks
+}
+
+// AddVoteObserver notifies the observer of approved votes, at the time they
+// were cast.
+func (s *ModerationService) AddVoteObserver(observer VoteObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+func (s *ModerationService) GetVoteEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = VoteStatusQuarantined
+	}
+
+	if status != VoteStatusAccepted && status != VoteStatusQuarantined && status != VoteStatusRejected && status != VoteStatusMerged {
+		http.Error(w, "Invalid vote status", http.StatusBadRequest)
+		return
+	}
+
+	events := []VoteEvent{}
+
+	rows, err := s.db.Query("SELECT id, crypto_id, direction, voter_ip, voter_subnet, voter_id, status, reasons, created_at, reviewed_at FROM vote_events WHERE status = ? ORDER BY id", status)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting votes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event VoteEvent
+		if err := rows.Scan(&event.ID, &event.CryptoID, &event.Direction, &event.VoterIP, &event.VoterSubnet, &event.VoterID,
+			&event.Status, &event.Reasons, &event.CreatedAt, &event.ReviewedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting votes", http.StatusInternalServerError)
+			return
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting votes", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(events)
+}
+
+func (s *ModerationService) ApproveVote(w http.ResponseWriter, r *http.Request) {
+	s.reviewVote(w, r, VoteStatusAccepted)
+}
+
+func (s *ModerationService) RejectVote(w http.ResponseWriter, r *http.Request) {
+	s.reviewVote(w, r, VoteStatusRejected)
+}
+
+func (s *ModerationService) reviewVote(w http.ResponseWriter, r *http.Request, status string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	voteID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid vote ID", http.StatusBadRequest)
+		return
+	}
+
+	var event VoteEvent
+	err = s.db.QueryRow("SELECT id, crypto_id, direction, voter_ip, voter_subnet, voter_id, status, reasons, created_at, reviewed_at FROM vote_events WHERE id = ?", voteID).
+		Scan(&event.ID, &event.CryptoID, &event.Direction, &event.VoterIP, &event.VoterSubnet, &event.VoterID,
+			&event.Status, &event.Reasons, &event.CreatedAt, &event.ReviewedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Vote does not exist", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+		return
+	}
+
+	if event.Status != VoteStatusQuarantined {
+		http.Error(w, "Vote is not quarantined", http.StatusConflict)
+		return
+	}
+
+	// The review and the tally update are applied together or not at all
+	tx, err := s.events.BeginTx(s.db)
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Only the first review of a quarantined vote takes effect
+	result, err := tx.Exec("UPDATE vote_events SET status = ?, reviewed_at = UTC_TIMESTAMP() WHERE id = ? AND status = ?",
+		status, voteID, VoteStatusQuarantined)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Vote is not quarantined", http.StatusConflict)
+		return
+	}
+
+	// Approved votes are added to the public tally
+	if status == VoteStatusAccepted {
+		var voteColumn string
+		switch event.Direction {
+		case "up":
+			voteColumn = "up_vote"
+		case "down":
+			voteColumn = "down_vote"
+		default:
+			http.Error(w, "Invalid vote type", http.StatusInternalServerError)
+			return
+		}
+
+		result, err = tx.Exec("UPDATE crypto_vote SET "+voteColumn+" = "+voteColumn+" + 1, total_votes = up_vote + down_vote WHERE id = ?", event.CryptoID)
+		if err != nil {
+			log.Println("Error updating database:", err)
+			http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+			return
+		}
+
+		rowsAffected, err = result.RowsAffected()
+		if err != nil {
+			log.Println("Error getting rows affected:", err)
+			http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+			return
+		}
+
+		// The cryptocurrency was purged since the vote was cast, the vote
+		// stays quarantined
+		if rowsAffected == 0 {
+			http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+			return
+		}
+
+		tx.Append(DomainEventVoteCast, event.CryptoID, VoteCast{CryptoID: event.CryptoID, Direction: event.Direction, Source: VoteSourceModerated, CastAt: event.CreatedAt})
+	}
+
+	before := event
+	event.Status = status
+
+	action := AuditActionVoteReject
+	if status == VoteStatusAccepted {
+		action = AuditActionVoteAccept
+	}
+
+	err = s.audit.Record(tx, r, action, event.ID, before, event)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error reviewing vote", http.StatusInternalServerError)
+		return
+	}
+
+	if status == VoteStatusAccepted {
+		s.observers.notify(event.CryptoID, event.Direction, event.CreatedAt)
+		s.webhooks.CheckMilestonesOf(event.CryptoID)
+	}
+
+	json.NewEncoder(w).Encode(event)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewVote(t *testing.T) {
+	voteColumns := []string{"id", "crypto_id", "direction", "voter_ip", "voter_subnet", "voter_id", "status", "reasons", "created_at", "reviewed_at"}
+	createdAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("ApproveQuarantinedVote", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		moderationService := NewModerationService(db)
+
+		// Set the expectations for the vote event lookup
+		rows := sqlmock.NewRows(voteColumns).
+			AddRow(7, 1, "up", "10.0.0.1", "10.0.0.0/24", "", VoteStatusQuarantined, "subnet_cluster", createdAt, nil)
+		mock.ExpectQuery("SELECT .* FROM vote_events WHERE id = ?").
+			WithArgs(7).
+			WillReturnRows(rows)
+
+		// Set the expectations for the status update and the tally update
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE vote_events SET status = \\?").
+			WithArgs(VoteStatusAccepted, 7, VoteStatusQuarantined).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ 1").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/moderation/votes/7/approve", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/moderation/votes/{id:[0-9]+}/approve", moderationService.ApproveVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var event VoteEvent
+		err = json.Unmarshal(rr.Body.Bytes(), &event)
+		assert.NoError(t, err)
+		assert.Equal(t, VoteStatusAccepted, event.Status)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ApproveVoteOfPurgedCryptoCurrency", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		moderationService := NewModerationService(db)
+
+		rows := sqlmock.NewRows(voteColumns).
+			AddRow(7, 1, "up", "10.0.0.1", "10.0.0.0/24", "", VoteStatusQuarantined, "subnet_cluster", createdAt, nil)
+		mock.ExpectQuery("SELECT .* FROM vote_events WHERE id = ?").
+			WithArgs(7).
+			WillReturnRows(rows)
+
+		// The cryptocurrency is gone, the review is rolled back
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE vote_events SET status = \\?").
+			WithArgs(VoteStatusAccepted, 7, VoteStatusQuarantined).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ 1").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		req, err := http.NewRequest("POST", "/v1/moderation/votes/7/approve", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/moderation/votes/{id:[0-9]+}/approve", moderationService.ApproveVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RejectAlreadyReviewedVote", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		moderationService := NewModerationService(db)
+
+		// Set the expectations for the vote event lookup of an accepted vote
+		rows := sqlmock.NewRows(voteColumns).
+			AddRow(7, 1, "up", "10.0.0.1", "10.0.0.0/24", "", VoteStatusAccepted, "", createdAt, createdAt)
+		mock.ExpectQuery("SELECT .* FROM vote_events WHERE id = ?").
+			WithArgs(7).
+			WillReturnRows(rows)
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/moderation/votes/7/reject", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/moderation/votes/{id:[0-9]+}/reject", moderationService.RejectVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSubnetOf(t *testing.T) {
+	assert.Equal(t, "203.0.113.0/24", subnetOf("203.0.113.57"))
+	assert.Equal(t, "2001:db8:abcd::/48", subnetOf("2001:db8:abcd:12::1"))
+	assert.Equal(t, "not-an-ip", subnetOf("not-an-ip"))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Notifier alerts about detected anomalies.
+type Notifier interface {
+	Notify(anomaly Anomaly) error
+}
+
+// LogNotifier writes anomalies to the server log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(anomaly Anomaly) error {
+	log.Printf("Vote anomaly on cryptocurrency %d: %d votes in the minute starting at %s, %.1f expected (z-score %.1f)",
+		anomaly.CryptoID, anomaly.Votes, anomaly.WindowStart.Format(time.RFC3339), anomaly.Expected, anomaly.ZScore)
+	return nil
+}
+
+// WebhookNotifier posts anomalies as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) Notify(anomaly Anomaly) error {
+	body, err := json.Marshal(anomaly)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.Client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
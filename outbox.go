@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+// EventPublisher delivers domain events relayed from the outbox, for example
+// to a message broker. Publish may be called more than once for the same
+// event, so consumers should ignore event IDs they have already seen.
+type EventPublisher interface {
+	Publish(event DomainEvent) error
+}
+
+// LogEventPublisher writes the relayed events to the server log.
+type LogEventPublisher struct{}
+
+func (LogEventPublisher) Publish(event DomainEvent) error {
+	log.Printf("Domain event %d: %s on cryptocurrency %d: %s", event.ID, event.Type, event.AggregateID, event.Data)
+	return nil
+}
+
+// EventPublishers publishes every event to each publisher in turn. A failing
+// publisher stops the event, which is published to all of them again on the
+// next relay.
+type EventPublishers []EventPublisher
+
+func (publishers EventPublishers) Publish(event DomainEvent) error {
+	for _, publisher := range publishers {
+		if err := publisher.Publish(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Outbox stores domain events in the transaction of the change they
+// describe, so an event is never lost nor published for a change that was
+// rolled back. The relay publishes the stored events afterwards, at least
+// once and in order.
+type Outbox struct {
+	db        Database
+	publisher EventPublisher
+	batchSize int
+
+	// Types of the events stored, all of them when nil
+	eventTypes map[string]bool
+}
+
+func NewOutbox(db *sql.DB, publisher EventPublisher) *Outbox {
+	return &Outbox{
+		db:        db,
+		publisher: publisher,
+		batchSize: 100,
+	}
+}
+
+// StoreOnly limits the outbox to the events of the given types, when the
+// publisher ignores the others.
+func (o *Outbox) StoreOnly(eventTypes ...string) {
+	o.eventTypes = make(map[string]bool, len(eventTypes))
+	for _, eventType := range eventTypes {
+		o.eventTypes[eventType] = true
+	}
+}
+
+// Store adds the events of a change to the outbox, to be published by the
+// relay.
+func (o *Outbox) Store(tx *sql.Tx, events []DomainEvent) error {
+	for _, event := range events {
+		if o.eventTypes != nil && !o.eventTypes[event.Type] {
+			continue
+		}
+
+		_, err := tx.Exec("INSERT INTO outbox (event_type, aggregate_id, payload, occurred_at) VALUES (?, ?, ?, ?)",
+			event.Type, event.AggregateID, string(event.Data), event.OccurredAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartRelay publishes the stored events every interval in the background.
+func (o *Outbox) StartRelay(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			_, err := o.Relay(time.Now().UTC())
+			if err != nil {
+				log.Println("Error relaying outbox events:", err)
+			}
+		}
+	}()
+}
+
+// Relay publishes the oldest unpublished events in order and marks them
+// published. Publishing stops at the first failure, which is retried on the
+// next relay. The events are locked while they are published: a relay
+// running on another instance waits for them instead of skipping ahead, then
+// carries on after the events published meanwhile, so the order holds across
+// instances. An event is published again if marking it fails, never skipped.
+func (o *Outbox) Relay(now time.Time) (int, error) {
+	tx, err := o.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, event_type, aggregate_id, payload, occurred_at FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT ? FOR UPDATE", o.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	events, err := scanDomainEvents(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	var published []interface{}
+	var publishErr error
+	for _, event := range events {
+		if publishErr = o.publisher.Publish(event); publishErr != nil {
+			break
+		}
+		published = append(published, event.ID)
+	}
+
+	if len(published) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(published)), ", ")
+		_, err = tx.Exec("UPDATE outbox SET published_at = ? WHERE id IN ("+placeholders+")", append([]interface{}{now}, published...)...)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(published), publishErr
+}
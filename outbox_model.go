@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	DomainEventCryptoCreated  = "CryptoCreated"
+	DomainEventCryptoDeleted  = "CryptoDeleted"
+	DomainEventCryptoRestored = "CryptoRestored"
+	DomainEventCryptoMerged   = "CryptoMerged"
+	DomainEventVoteCast       = "VoteCast"
+	DomainEventTallyImported  = "TallyImported"
+)
+
+const (
+	VoteSourceAnonymous = "anonymous"
+	VoteSourceSigned    = "signed"
+	VoteSourceModerated = "moderated"
+)
+
+// DomainEvent records a change to a cryptocurrency, the aggregate. Events are
+// numbered in the order they were committed.
+type DomainEvent struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID int             `json:"aggregate_id"`
+	Data        json.RawMessage `json:"data"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+}
+
+// VoteCast is the data of a VoteCast event. Source tells whether the vote was
+// cast anonymously, signed or approved by a moderator.
+type VoteCast struct {
+	CryptoID  int       `json:"crypto_id"`
+	Direction string    `json:"direction"`
+	Source    string    `json:"source"`
+	CastAt    time.Time `json:"cast_at"`
+}
+
+// TallyImported is the data of a TallyImported event. It seeds the event log
+// with the tally a cryptocurrency had before its votes were recorded as
+// events.
+type TallyImported struct {
+	CryptoID int    `json:"crypto_id"`
+	Name     string `json:"name"`
+	UpVote   int    `json:"up_vote"`
+	DownVote int    `json:"down_vote"`
+	Deleted  bool   `json:"deleted"`
+}
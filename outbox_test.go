@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type eventPublisherFunc func(event DomainEvent) error
+
+func (f eventPublisherFunc) Publish(event DomainEvent) error {
+	return f(event)
+}
+
+var outboxColumns = []string{"id", "event_type", "aggregate_id", "payload", "occurred_at"}
+
+func TestVoteWithOutbox(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cryptoService := NewCryptoCurrencyService(db)
+	cryptoService.AddEventSinks(NewOutbox(db, LogEventPublisher{}))
+
+	// The vote and its event are committed together
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ 1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox \\(event_type, aggregate_id, payload, occurred_at\\)").
+		WithArgs(DomainEventVoteCast, 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE id=?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).AddRow(1, "Bitcoin", 11, 2, 13))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("PUT", "/v1/cryptovote/1/upvote", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/upvote", cryptoService.UpVoteCryptoCurrency).Methods("PUT")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVoteRolledBackWithoutEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cryptoService := NewCryptoCurrencyService(db)
+	cryptoService.AddEventSinks(NewOutbox(db, LogEventPublisher{}))
+
+	// Failing to store the event rolls back the vote
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE crypto_vote SET down_vote = down_vote \\+ 1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").
+		WillReturnError(errors.New("database error"))
+	mock.ExpectRollback()
+
+	req, err := http.NewRequest("PUT", "/v1/cryptovote/1/downvote", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/downvote", cryptoService.DownVoteCryptoCurrency).Methods("PUT")
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxStoreOnly(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	outbox := NewOutbox(db, LogEventPublisher{})
+	outbox.StoreOnly(DomainEventCryptoCreated)
+
+	// Only the creation is stored, the vote is left out
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO outbox \\(event_type, aggregate_id, payload, occurred_at\\)").
+		WithArgs(DomainEventCryptoCreated, 5, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	err = outbox.Store(tx, []DomainEvent{
+		{Type: DomainEventCryptoCreated, AggregateID: 5, Data: []byte(`{}`)},
+		{Type: DomainEventVoteCast, AggregateID: 5, Data: []byte(`{}`)},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxRelay(t *testing.T) {
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	t.Run("PublishesInOrder", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		var published []int64
+		outbox := NewOutbox(db, eventPublisherFunc(func(event DomainEvent) error {
+			published = append(published, event.ID)
+			return nil
+		}))
+
+		// Set the expectations for locking, publishing and marking the events
+		mock.ExpectBegin()
+		mock.ExpectQuery("FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT \\? FOR UPDATE$").
+			WithArgs(100).
+			WillReturnRows(sqlmock.NewRows(outboxColumns).
+				AddRow(1, DomainEventCryptoCreated, 5, `{"id":5,"name":"Arbitrum"}`, now).
+				AddRow(2, DomainEventVoteCast, 5, `{"crypto_id":5,"direction":"up"}`, now))
+		mock.ExpectExec("UPDATE outbox SET published_at = \\? WHERE id IN \\(\\?, \\?\\)").
+			WithArgs(now, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		relayed, err := outbox.Relay(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, relayed)
+		assert.Equal(t, []int64{1, 2}, published)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("StopsAtFailure", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		// The broker is down for the second event, the third waits behind it
+		outbox := NewOutbox(db, eventPublisherFunc(func(event DomainEvent) error {
+			if event.ID == 2 {
+				return errors.New("broker unavailable")
+			}
+			return nil
+		}))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("FROM outbox WHERE published_at IS NULL").
+			WillReturnRows(sqlmock.NewRows(outboxColumns).
+				AddRow(1, DomainEventVoteCast, 5, `{}`, now).
+				AddRow(2, DomainEventVoteCast, 5, `{}`, now).
+				AddRow(3, DomainEventVoteCast, 5, `{}`, now))
+		mock.ExpectExec("UPDATE outbox SET published_at = \\? WHERE id IN \\(\\?\\)").
+			WithArgs(now, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		relayed, err := outbox.Relay(now)
+		assert.EqualError(t, err, "broker unavailable")
+		assert.Equal(t, 1, relayed)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
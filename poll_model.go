@@ -0,0 +1,114 @@
+package main
+
+import "time"
+
+const (
+	// Public polls are listed, unlisted polls are only reachable by ID and
+	// private polls are only visible to admins.
+	PollVisibilityPublic   = "public"
+	PollVisibilityUnlisted = "unlisted"
+	PollVisibilityPrivate  = "private"
+)
+
+const (
+	PollStatusScheduled = "scheduled"
+	PollStatusOpen      = "open"
+	PollStatusRevealing = "revealing"
+	PollStatusClosed    = "closed"
+)
+
+type Poll struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Visibility  string     `json:"visibility"`
+	OpensAt     *time.Time `json:"opens_at"`
+	ClosesAt    *time.Time `json:"closes_at"`
+
+	// CreditBudget is the number of credits every voter may spend on
+	// quadratic votes in the poll. Zero disables quadratic voting.
+	CreditBudget int `json:"credit_budget"`
+
+	// RevealClosesAt turns the poll into a commit-reveal poll. Voters commit
+	// to a hidden choice until ClosesAt and reveal it until RevealClosesAt.
+	RevealClosesAt *time.Time `json:"reveal_closes_at,omitempty"`
+
+	Status      string     `json:"status"`
+	FinalizedAt *time.Time `json:"finalized_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// StatusAt tells whether the poll accepts votes at the given time. A poll is
+// closed once its closing time has passed, even before the scheduler has
+// published its results. Commit-reveal polls accept reveals in between.
+func (p Poll) StatusAt(now time.Time) string {
+	switch {
+	case p.FinalizedAt != nil:
+		return PollStatusClosed
+	case p.ClosesAt != nil && !now.Before(*p.ClosesAt):
+		if p.RevealClosesAt != nil && now.Before(*p.RevealClosesAt) {
+			return PollStatusRevealing
+		}
+		return PollStatusClosed
+	case p.OpensAt != nil && now.Before(*p.OpensAt):
+		return PollStatusScheduled
+	default:
+		return PollStatusOpen
+	}
+}
+
+// PollCandidate is a cryptocurrency of the catalog taking part in a poll,
+// with the votes it received in that poll.
+type PollCandidate struct {
+	PollID     int    `json:"poll_id"`
+	CryptoID   int    `json:"crypto_id"`
+	Name       string `json:"name"`
+	UpVote     int    `json:"up_vote"`
+	DownVote   int    `json:"down_vote"`
+	TotalVotes int    `json:"total_votes"`
+
+	// WeightedVotes sums the quadratic votes cast on the candidate
+	WeightedVotes int `json:"weighted_votes"`
+}
+
+// PollResult is the final standing of a candidate, frozen when the poll
+// closed. Candidates are ranked by net votes (up minus down), then by up votes
+// and finally by cryptocurrency ID.
+type PollResult struct {
+	Rank       int    `json:"rank"`
+	CryptoID   int    `json:"crypto_id"`
+	Name       string `json:"name"`
+	UpVote     int    `json:"up_vote"`
+	DownVote   int    `json:"down_vote"`
+	TotalVotes int    `json:"total_votes"`
+
+	// WeightedVotes sums the quadratic votes cast on the candidate
+	WeightedVotes int `json:"weighted_votes"`
+
+	// TokenVoters and TokenWeight count the token-weighted votes cast on the
+	// candidate and sum their weight, in polls with a balance snapshot
+	TokenVoters *int    `json:"token_voters,omitempty"`
+	TokenWeight *string `json:"token_weight,omitempty"`
+}
+
+type PollResults struct {
+	Poll    Poll         `json:"poll"`
+	Results []PollResult `json:"results"`
+}
+
+// VoterCredits is the quadratic voting balance of a voter in a poll.
+type VoterCredits struct {
+	PollID    int    `json:"poll_id"`
+	VoterID   string `json:"voter_id"`
+	Budget    int    `json:"budget"`
+	Spent     int    `json:"spent"`
+	Remaining int    `json:"remaining"`
+}
+
+// QuadraticVote is the outcome of casting weighted votes on a candidate.
+type QuadraticVote struct {
+	Weight    int           `json:"weight"`
+	Cost      int           `json:"cost"`
+	Candidate PollCandidate `json:"candidate"`
+	Credits   VoterCredits  `json:"credits"`
+}
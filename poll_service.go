@@ -0,0 +1,738 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// PollService manages polls. Every poll has its own list of candidates drawn
+// from the cryptocurrency catalog and its own vote counts; the crypto_vote
+// counters remain the default poll served by CryptoCurrencyService.
+type PollService struct {
+	db         Database
+	challenges *ChallengeService
+	audit      *AuditService
+}
+
+func NewPollService(db *sql.DB) *PollService {
+	return &PollService{
+		db: db,
+	}
+}
+
+// RequireProofOfWork makes the poll vote endpoints accept only votes carrying
+// a solved challenge, like the default poll.
+func (s *PollService) RequireProofOfWork(challenges *ChallengeService) {
+	s.challenges = challenges
+}
+
+// EnableAuditLog records poll creations and candidate changes in the audit log.
+func (s *PollService) EnableAuditLog(audit *AuditService) {
+	s.audit = audit
+}
+
+// GetAllPolls lists the public polls. Admins see every poll.
+func (s *PollService) GetAllPolls(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	polls := []Poll{}
+	now := time.Now()
+
+	query := "SELECT id, title, description, visibility, opens_at, closes_at, credit_budget, reveal_closes_at, finalized_at, created_at FROM polls"
+	var args []interface{}
+	if !isAdmin(r) {
+		query += " WHERE visibility = ?"
+		args = append(args, PollVisibilityPublic)
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting polls", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var poll Poll
+		if err := rows.Scan(&poll.ID, &poll.Title, &poll.Description, &poll.Visibility, &poll.OpensAt, &poll.ClosesAt, &poll.CreditBudget, &poll.RevealClosesAt, &poll.FinalizedAt, &poll.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting polls", http.StatusInternalServerError)
+			return
+		}
+		poll.Status = poll.StatusAt(now)
+		polls = append(polls, poll)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting polls", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(polls)
+}
+
+func (s *PollService) GetPollByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(poll)
+}
+
+func (s *PollService) CreatePoll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var poll Poll
+
+	err := json.NewDecoder(r.Body).Decode(&poll)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	poll.Title = strings.TrimSpace(poll.Title)
+	if poll.Title == "" {
+		http.Error(w, "Title cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	switch poll.Visibility {
+	case "":
+		poll.Visibility = PollVisibilityPublic
+	case PollVisibilityPublic, PollVisibilityUnlisted, PollVisibilityPrivate:
+	default:
+		http.Error(w, "Visibility must be public, unlisted or private", http.StatusBadRequest)
+		return
+	}
+
+	if poll.OpensAt != nil && poll.ClosesAt != nil && !poll.ClosesAt.After(*poll.OpensAt) {
+		http.Error(w, "closes_at must be after opens_at", http.StatusBadRequest)
+		return
+	}
+
+	if poll.RevealClosesAt != nil && (poll.ClosesAt == nil || !poll.RevealClosesAt.After(*poll.ClosesAt)) {
+		http.Error(w, "reveal_closes_at must be after closes_at", http.StatusBadRequest)
+		return
+	}
+
+	if poll.CreditBudget < 0 {
+		http.Error(w, "credit_budget cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	poll.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	poll.FinalizedAt = nil
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error creating poll", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO polls (title, description, visibility, opens_at, closes_at, credit_budget, reveal_closes_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		poll.Title, poll.Description, poll.Visibility, poll.OpensAt, poll.ClosesAt, poll.CreditBudget, poll.RevealClosesAt, poll.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error creating poll", http.StatusInternalServerError)
+		return
+	}
+
+	lastInsertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error getting last insert ID:", err)
+		http.Error(w, "Error creating poll", http.StatusInternalServerError)
+		return
+	}
+
+	poll.ID = int(lastInsertID)
+	poll.Status = poll.StatusAt(poll.CreatedAt)
+
+	err = s.audit.Record(tx, r, AuditActionPollCreate, poll.ID, nil, poll)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error creating poll", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error creating poll", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(poll)
+}
+
+func (s *PollService) GetPollCandidates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	candidates := []PollCandidate{}
+
+	rows, err := s.db.Query(`SELECT pc.poll_id, pc.crypto_id, c.name, pc.up_vote, pc.down_vote, (pc.up_vote + pc.down_vote) as total_votes, pc.weighted_votes FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL ORDER BY pc.crypto_id`, poll.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting poll candidates", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var candidate PollCandidate
+		if err := rows.Scan(&candidate.PollID, &candidate.CryptoID, &candidate.Name, &candidate.UpVote, &candidate.DownVote, &candidate.TotalVotes, &candidate.WeightedVotes); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting poll candidates", http.StatusInternalServerError)
+			return
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting poll candidates", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(candidates)
+}
+
+func (s *PollService) GetPollCandidate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	cryptoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	candidate, err := getCandidate(s.db, poll.ID, cryptoID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Cryptocurrency is not a candidate of this poll", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(candidate)
+}
+
+// AddPollCandidate adds a cryptocurrency of the catalog to the poll with no
+// votes.
+func (s *PollService) AddPollCandidate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	// The candidates of a closed poll are frozen along with its results
+	if poll.Status == PollStatusClosed || poll.Status == PollStatusRevealing {
+		http.Error(w, "Poll is closed", http.StatusConflict)
+		return
+	}
+
+	var request struct {
+		CryptoID int `json:"crypto_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.CryptoID <= 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the cryptocurrency exists in the database
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", request.CryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error adding poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error adding poll candidate", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT IGNORE INTO poll_candidates (poll_id, crypto_id) VALUES (?, ?)", poll.ID, request.CryptoID)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error adding poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error adding poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Cryptocurrency is already a candidate of this poll", http.StatusConflict)
+		return
+	}
+
+	candidate, err := getCandidate(tx, poll.ID, request.CryptoID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionPollCandidateAdd, poll.ID, nil, candidate)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error adding poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error adding poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(candidate)
+}
+
+// RemovePollCandidate takes the cryptocurrency out of the poll along with the
+// votes it received there. The catalog entry is left untouched.
+func (s *PollService) RemovePollCandidate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	// The candidates of a closed poll are frozen along with its results
+	if poll.Status == PollStatusClosed || poll.Status == PollStatusRevealing {
+		http.Error(w, "Poll is closed", http.StatusConflict)
+		return
+	}
+
+	cryptoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error removing poll candidate", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Keep the removed votes for the audit log
+	var before PollCandidate
+	if s.audit != nil {
+		before, err = getCandidate(tx, poll.ID, cryptoID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error removing poll candidate", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM poll_candidates WHERE poll_id = ? AND crypto_id = ?", poll.ID, cryptoID)
+	if err != nil {
+		log.Println("Error deleting from database:", err)
+		http.Error(w, "Error removing poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error removing poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Cryptocurrency is not a candidate of this poll", http.StatusNotFound)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionPollCandidateRemove, poll.ID, before, nil)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error removing poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error removing poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *PollService) UpVotePollCandidate(w http.ResponseWriter, r *http.Request) {
+	s.votePollCandidate(w, r, "up_vote")
+}
+
+func (s *PollService) DownVotePollCandidate(w http.ResponseWriter, r *http.Request) {
+	s.votePollCandidate(w, r, "down_vote")
+}
+
+func (s *PollService) votePollCandidate(w http.ResponseWriter, r *http.Request, voteColumn string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	cryptoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	// Live counts would defeat the hidden choices of a commit-reveal poll
+	if poll.RevealClosesAt != nil {
+		http.Error(w, "Poll uses commit-reveal voting", http.StatusConflict)
+		return
+	}
+
+	// Votes are only accepted between the opening and closing times
+	if !checkVotingWindow(w, poll) {
+		return
+	}
+
+	// Anonymous votes must carry a solved proof-of-work challenge, which is
+	// handed back unless the vote is counted
+	challenge, ok := s.challenges.CheckRequest(w, r, cryptoID)
+	if !ok {
+		return
+	}
+	defer challenge.Release()
+
+	result, err := s.db.Exec("UPDATE poll_candidates SET "+voteColumn+" = "+voteColumn+" + 1 WHERE poll_id = ? AND crypto_id = ?", poll.ID, cryptoID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error voting for poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error voting for poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Cryptocurrency is not a candidate of this poll", http.StatusNotFound)
+		return
+	}
+	challenge.Keep()
+
+	candidate, err := getCandidate(s.db, poll.ID, cryptoID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(candidate)
+}
+
+// checkVotingWindow writes an error response and returns false when the poll
+// does not accept votes right now.
+func checkVotingWindow(w http.ResponseWriter, poll Poll) bool {
+	switch poll.Status {
+	case PollStatusScheduled:
+		http.Error(w, "Poll is not open yet, voting opens at "+poll.OpensAt.UTC().Format(time.RFC3339), http.StatusForbidden)
+		return false
+	case PollStatusClosed, PollStatusRevealing:
+		http.Error(w, "Poll is closed, voting is no longer accepted", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// lookupPoll loads the poll named by the pollId route variable. Private polls
+// are reported as missing to everyone but admins. When the poll cannot be
+// returned the error response is written and false is returned.
+func (s *PollService) lookupPoll(w http.ResponseWriter, r *http.Request) (Poll, bool) {
+	var poll Poll
+
+	pollID, err := strconv.Atoi(mux.Vars(r)["pollId"])
+	if err != nil {
+		http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+		return poll, false
+	}
+
+	err = s.db.QueryRow("SELECT id, title, description, visibility, opens_at, closes_at, credit_budget, reveal_closes_at, finalized_at, created_at FROM polls WHERE id = ?", pollID).
+		Scan(&poll.ID, &poll.Title, &poll.Description, &poll.Visibility, &poll.OpensAt, &poll.ClosesAt, &poll.CreditBudget, &poll.RevealClosesAt, &poll.FinalizedAt, &poll.CreatedAt)
+	if err == sql.ErrNoRows || (err == nil && poll.Visibility == PollVisibilityPrivate && !isAdmin(r)) {
+		http.Error(w, "Poll does not exist", http.StatusNotFound)
+		return poll, false
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting poll", http.StatusInternalServerError)
+		return poll, false
+	}
+	poll.Status = poll.StatusAt(time.Now())
+
+	return poll, true
+}
+
+// getCandidate reads the candidate on the database or in a transaction.
+func getCandidate(q rowQueryer, pollID, cryptoID int) (PollCandidate, error) {
+	var candidate PollCandidate
+
+	err := q.QueryRow(`SELECT pc.poll_id, pc.crypto_id, c.name, pc.up_vote, pc.down_vote, (pc.up_vote + pc.down_vote) as total_votes, pc.weighted_votes FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		WHERE pc.poll_id = ? AND pc.crypto_id = ? AND c.deleted_at IS NULL`, pollID, cryptoID).
+		Scan(&candidate.PollID, &candidate.CryptoID, &candidate.Name, &candidate.UpVote, &candidate.DownVote, &candidate.TotalVotes, &candidate.WeightedVotes)
+
+	return candidate, err
+}
+
+// GetPollResults returns the final standings published when the poll closed.
+func (s *PollService) GetPollResults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	if poll.FinalizedAt == nil {
+		http.Error(w, "Poll results are not published yet", http.StatusNotFound)
+		return
+	}
+
+	results := PollResults{Poll: poll, Results: []PollResult{}}
+
+	rows, err := s.db.Query("SELECT `rank`, crypto_id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes, weighted_votes, token_voters, token_weight FROM poll_results WHERE poll_id = ? ORDER BY `rank`", poll.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting poll results", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result PollResult
+		if err := rows.Scan(&result.Rank, &result.CryptoID, &result.Name, &result.UpVote, &result.DownVote, &result.TotalVotes, &result.WeightedVotes, &result.TokenVoters, &result.TokenWeight); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting poll results", http.StatusInternalServerError)
+			return
+		}
+		results.Results = append(results.Results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting poll results", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// StartScheduler closes the polls whose closing time has passed every
+// interval, freezing and publishing their results. Commit-reveal polls are
+// closed at the end of their reveal phase.
+func (s *PollService) StartScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			closed, err := s.ClosePolls(time.Now().UTC())
+			if err != nil {
+				log.Println("Error closing polls:", err)
+				continue
+			}
+			if closed > 0 {
+				log.Println("Closed polls:", closed)
+			}
+		}
+	}()
+}
+
+// ClosePolls finalizes every poll that closed before now and has no published
+// results yet. It returns the number of polls finalized. A poll that fails to
+// finalize is logged and retried on the next run without holding back the
+// others, and the errors are returned together.
+func (s *PollService) ClosePolls(now time.Time) (int, error) {
+	rows, err := s.db.Query("SELECT id FROM polls WHERE COALESCE(reveal_closes_at, closes_at) <= ? AND finalized_at IS NULL ORDER BY id", now)
+	if err != nil {
+		return 0, err
+	}
+
+	var pollIDs []int
+	for rows.Next() {
+		var pollID int
+		if err := rows.Scan(&pollID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pollIDs = append(pollIDs, pollID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	var errs []error
+	for _, pollID := range pollIDs {
+		finalized, err := s.finalizePoll(pollID, now)
+		if err != nil {
+			log.Printf("Error finalizing poll %d: %v", pollID, err)
+			errs = append(errs, fmt.Errorf("poll %d: %w", pollID, err))
+			continue
+		}
+		if finalized {
+			closed++
+		}
+	}
+
+	return closed, errors.Join(errs...)
+}
+
+// finalizePoll ranks the candidates of the poll and stores the standings in
+// poll_results. The poll row is locked so a poll is only finalized once, even
+// with several instances running the scheduler. Quadratic polls rank their
+// candidates by weighted votes. Commit-reveal polls have no up and down votes,
+// their candidates are ranked by revealed votes, stored as up votes. Polls
+// with a token snapshot rank them by the token weight of their voters, then
+// by headcount, and store both.
+func (s *PollService) finalizePoll(pollID int, now time.Time) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var finalizedAt, revealClosesAt *time.Time
+	var creditBudget int
+	err = tx.QueryRow("SELECT finalized_at, reveal_closes_at, credit_budget FROM polls WHERE id = ? FOR UPDATE", pollID).Scan(&finalizedAt, &revealClosesAt, &creditBudget)
+	if err != nil {
+		return false, err
+	}
+	if finalizedAt != nil {
+		return false, nil
+	}
+
+	var snapshots int
+	err = tx.QueryRow("SELECT COUNT(*) FROM poll_snapshots WHERE poll_id = ?", pollID).Scan(&snapshots)
+	if err != nil {
+		return false, err
+	}
+
+	query := `SELECT pc.crypto_id, c.name, pc.up_vote, pc.down_vote, pc.weighted_votes, NULL, NULL FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL
+		ORDER BY (pc.up_vote - pc.down_vote) DESC, pc.up_vote DESC, pc.crypto_id`
+	if creditBudget > 0 {
+		query = `SELECT pc.crypto_id, c.name, pc.up_vote, pc.down_vote, pc.weighted_votes, NULL, NULL FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL
+		ORDER BY pc.weighted_votes DESC, pc.crypto_id`
+	}
+	if revealClosesAt != nil {
+		query = `SELECT pc.crypto_id, c.name, COUNT(v.voter_id), 0, pc.weighted_votes, NULL, NULL FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		LEFT JOIN poll_commitments v ON v.poll_id = pc.poll_id AND v.crypto_id = pc.crypto_id AND v.revealed_at IS NOT NULL
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL
+		GROUP BY pc.crypto_id, c.name, pc.weighted_votes
+		ORDER BY COUNT(v.voter_id) DESC, pc.crypto_id`
+	}
+	if snapshots > 0 {
+		query = `SELECT pc.crypto_id, c.name, pc.up_vote, pc.down_vote, pc.weighted_votes, COUNT(v.voter_id), COALESCE(SUM(v.weight), 0) FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		LEFT JOIN poll_token_votes v ON v.poll_id = pc.poll_id AND v.crypto_id = pc.crypto_id
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL
+		GROUP BY pc.crypto_id, c.name, pc.up_vote, pc.down_vote, pc.weighted_votes
+		ORDER BY COALESCE(SUM(v.weight), 0) DESC, COUNT(v.voter_id) DESC, pc.crypto_id`
+	}
+
+	rows, err := tx.Query(query, pollID)
+	if err != nil {
+		return false, err
+	}
+
+	var results []PollResult
+	for rows.Next() {
+		result := PollResult{Rank: len(results) + 1}
+		if err := rows.Scan(&result.CryptoID, &result.Name, &result.UpVote, &result.DownVote, &result.WeightedVotes, &result.TokenVoters, &result.TokenWeight); err != nil {
+			rows.Close()
+			return false, err
+		}
+		results = append(results, result)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, result := range results {
+		_, err := tx.Exec("INSERT INTO poll_results (poll_id, `rank`, crypto_id, name, up_vote, down_vote, weighted_votes, token_voters, token_weight) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			pollID, result.Rank, result.CryptoID, result.Name, result.UpVote, result.DownVote, result.WeightedVotes, result.TokenVoters, result.TokenWeight)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE polls SET finalized_at = ? WHERE id = ?", now, pollID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
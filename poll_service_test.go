@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var pollColumns = []string{"id", "title", "description", "visibility", "opens_at", "closes_at", "credit_budget", "reveal_closes_at", "finalized_at", "created_at"}
+
+func TestGetAllPolls(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := sqlmock.NewRows(pollColumns).
+		AddRow(1, "Best L2 of 2026", "", "public", nil, nil, 0, nil, nil, createdAt)
+
+	// Anonymous clients only see the public polls
+	mock.ExpectQuery("FROM polls WHERE visibility = \\? ORDER BY id").
+		WithArgs(PollVisibilityPublic).
+		WillReturnRows(rows)
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/polls", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/polls", pollService.GetAllPolls).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var polls []Poll
+	err = json.Unmarshal(rr.Body.Bytes(), &polls)
+	assert.NoError(t, err)
+	assert.Equal(t, []Poll{{ID: 1, Title: "Best L2 of 2026", Visibility: "public", Status: PollStatusOpen, CreatedAt: createdAt}}, polls)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPrivatePoll(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		expectedCode  int
+	}{
+		{"Anonymous", "", http.StatusNotFound},
+		{"Admin", "Bearer secret", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			pollService := NewPollService(db)
+
+			mock.ExpectQuery("FROM polls WHERE id = ?").
+				WithArgs(2).
+				WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(2, "Staff pick", "", "private", nil, nil, 0, nil, nil, time.Now()))
+
+			req, err := http.NewRequest("GET", "/v1/polls/2", nil)
+			assert.NoError(t, err)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+
+			r := mux.NewRouter()
+			r.HandleFunc("/v1/polls/{pollId:[0-9]+}", pollService.GetPollByID).Methods("GET")
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedCode, rr.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAddPollCandidate(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+
+	// Set the expectations for the poll, the existence check and the insert
+	mock.ExpectQuery("FROM polls WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Best L2 of 2026", "", "public", nil, nil, 0, nil, nil, time.Now()))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT IGNORE INTO poll_candidates \\(poll_id, crypto_id\\) VALUES \\(\\?, \\?\\)").
+		WithArgs(1, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("FROM poll_candidates pc\\s+JOIN crypto_vote c ON c.id = pc.crypto_id\\s+WHERE pc.poll_id = \\? AND pc.crypto_id = \\?").
+		WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"poll_id", "crypto_id", "name", "up_vote", "down_vote", "total_votes", "weighted_votes"}).AddRow(1, 5, "Arbitrum", 0, 0, 0, 0))
+	mock.ExpectCommit()
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("POST", "/v1/polls/1/cryptovote", strings.NewReader(`{"crypto_id": 5}`))
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/polls/{pollId:[0-9]+}/cryptovote", pollService.AddPollCandidate).Methods("POST")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var candidate PollCandidate
+	err = json.Unmarshal(rr.Body.Bytes(), &candidate)
+	assert.NoError(t, err)
+	assert.Equal(t, PollCandidate{PollID: 1, CryptoID: 5, Name: "Arbitrum"}, candidate)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVotePollCandidate(t *testing.T) {
+	t.Run("UpVote", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		// The vote only counts in the poll, not in the crypto_vote counters
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Best L2 of 2026", "", "unlisted", nil, nil, 0, nil, nil, time.Now()))
+		mock.ExpectExec("UPDATE poll_candidates SET up_vote = up_vote \\+ 1 WHERE poll_id = \\? AND crypto_id = \\?").
+			WithArgs(1, 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("FROM poll_candidates pc").
+			WithArgs(1, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"poll_id", "crypto_id", "name", "up_vote", "down_vote", "total_votes", "weighted_votes"}).AddRow(1, 5, "Arbitrum", 1, 0, 1, 0))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("PUT", "/v1/polls/1/cryptovote/5/upvote", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/upvote", pollService.UpVotePollCandidate).Methods("PUT")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"poll_id":1,"crypto_id":5,"name":"Arbitrum","up_vote":1,"down_vote":0,"total_votes":1,"weighted_votes":0}`, rr.Body.String())
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("PollClosed", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		// No vote is counted once the closing time has passed
+		closesAt := time.Now().Add(-time.Minute)
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Best L2 of 2026", "", "public", nil, closesAt, 0, nil, nil, time.Now()))
+
+		req, err := http.NewRequest("PUT", "/v1/polls/1/cryptovote/5/upvote", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/upvote", pollService.UpVotePollCandidate).Methods("PUT")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Poll is closed")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NotACandidate", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Best L2 of 2026", "", "public", nil, nil, 0, nil, nil, time.Now()))
+		mock.ExpectExec("UPDATE poll_candidates SET down_vote = down_vote \\+ 1").
+			WithArgs(1, 7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		req, err := http.NewRequest("PUT", "/v1/polls/1/cryptovote/7/downvote", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/downvote", pollService.DownVotePollCandidate).Methods("PUT")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPollStatusAt(t *testing.T) {
+	opensAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	closesAt := time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)
+	poll := Poll{OpensAt: &opensAt, ClosesAt: &closesAt}
+
+	assert.Equal(t, PollStatusScheduled, poll.StatusAt(opensAt.Add(-time.Second)))
+	assert.Equal(t, PollStatusOpen, poll.StatusAt(opensAt))
+	assert.Equal(t, PollStatusClosed, poll.StatusAt(closesAt))
+
+	// A finalized poll stays closed whatever its times say
+	poll.FinalizedAt = &closesAt
+	poll.ClosesAt = nil
+	assert.Equal(t, PollStatusClosed, poll.StatusAt(opensAt))
+}
+
+func TestClosePolls(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+	now := time.Date(2026, 3, 8, 0, 0, 30, 0, time.UTC)
+
+	// Set the expectations for finding the due poll and freezing its results
+	mock.ExpectQuery("SELECT id FROM polls WHERE COALESCE\\(reveal_closes_at, closes_at\\) <= \\? AND finalized_at IS NULL").
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT finalized_at, reveal_closes_at, credit_budget FROM polls WHERE id = \\? FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"finalized_at", "reveal_closes_at", "credit_budget"}).AddRow(nil, nil, 0))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_snapshots WHERE poll_id = \\?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("ORDER BY \\(pc.up_vote - pc.down_vote\\) DESC, pc.up_vote DESC, pc.crypto_id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "up_vote", "down_vote", "weighted_votes", "token_voters", "token_weight"}).
+			AddRow(5, "Arbitrum", 30, 10, 0, nil, nil).
+			AddRow(6, "Optimism", 25, 10, 0, nil, nil))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(1, 1, 5, "Arbitrum", 30, 10, 0, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(1, 2, 6, "Optimism", 25, 10, 0, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE polls SET finalized_at = \\? WHERE id = \\?").
+		WithArgs(now, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	closed, err := pollService.ClosePolls(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, closed)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClosePollsAfterFailure(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+	now := time.Date(2026, 3, 8, 0, 0, 30, 0, time.UTC)
+
+	// The first poll fails to finalize, the second one is still finalized
+	mock.ExpectQuery("SELECT id FROM polls WHERE COALESCE\\(reveal_closes_at, closes_at\\) <= \\? AND finalized_at IS NULL").
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT finalized_at, reveal_closes_at, credit_budget FROM polls WHERE id = \\? FOR UPDATE").
+		WithArgs(1).
+		WillReturnError(errors.New("database error"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT finalized_at, reveal_closes_at, credit_budget FROM polls WHERE id = \\? FOR UPDATE").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"finalized_at", "reveal_closes_at", "credit_budget"}).AddRow(nil, nil, 0))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_snapshots WHERE poll_id = \\?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("ORDER BY \\(pc.up_vote - pc.down_vote\\) DESC, pc.up_vote DESC, pc.crypto_id").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "up_vote", "down_vote", "weighted_votes", "token_voters", "token_weight"}).
+			AddRow(5, "Arbitrum", 30, 10, 0, nil, nil))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(2, 1, 5, "Arbitrum", 30, 10, 0, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE polls SET finalized_at = \\? WHERE id = \\?").
+		WithArgs(now, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	closed, err := pollService.ClosePolls(now)
+	assert.EqualError(t, err, "poll 1: database error")
+	assert.Equal(t, 1, closed)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCloseQuadraticPoll(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+	now := time.Date(2026, 3, 8, 0, 0, 30, 0, time.UTC)
+
+	// The candidates are ranked by weighted votes, not by their net votes
+	mock.ExpectQuery("SELECT id FROM polls WHERE COALESCE\\(reveal_closes_at, closes_at\\) <= \\? AND finalized_at IS NULL").
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT finalized_at, reveal_closes_at, credit_budget FROM polls WHERE id = \\? FOR UPDATE").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"finalized_at", "reveal_closes_at", "credit_budget"}).AddRow(nil, nil, 100))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_snapshots WHERE poll_id = \\?").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("ORDER BY pc.weighted_votes DESC, pc.crypto_id").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "up_vote", "down_vote", "weighted_votes", "token_voters", "token_weight"}).
+			AddRow(6, "Optimism", 0, 0, 12, nil, nil).
+			AddRow(5, "Arbitrum", 0, 0, 7, nil, nil))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(3, 1, 6, "Optimism", 0, 0, 12, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(3, 2, 5, "Arbitrum", 0, 0, 7, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE polls SET finalized_at = \\? WHERE id = \\?").
+		WithArgs(now, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	closed, err := pollService.ClosePolls(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, closed)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCloseTokenWeightedPoll(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+	now := time.Date(2026, 3, 8, 0, 0, 30, 0, time.UTC)
+
+	// The heaviest candidate wins even with fewer voters
+	mock.ExpectQuery("SELECT id FROM polls WHERE COALESCE\\(reveal_closes_at, closes_at\\) <= \\? AND finalized_at IS NULL").
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT finalized_at, reveal_closes_at, credit_budget FROM polls WHERE id = \\? FOR UPDATE").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"finalized_at", "reveal_closes_at", "credit_budget"}).AddRow(nil, nil, 0))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_snapshots WHERE poll_id = \\?").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("LEFT JOIN poll_token_votes v ON (.|\\s)*ORDER BY COALESCE\\(SUM\\(v.weight\\), 0\\) DESC, COUNT\\(v.voter_id\\) DESC, pc.crypto_id").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "up_vote", "down_vote", "weighted_votes", "token_voters", "token_weight"}).
+			AddRow(6, "Optimism", 0, 0, 0, 1, "1500.5").
+			AddRow(5, "Arbitrum", 0, 0, 0, 3, "200"))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(4, 1, 6, "Optimism", 0, 0, 0, 1, "1500.5").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(4, 2, 5, "Arbitrum", 0, 0, 0, 3, "200").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE polls SET finalized_at = \\? WHERE id = \\?").
+		WithArgs(now, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	closed, err := pollService.ClosePolls(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, closed)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCloseCommitRevealPoll(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+	now := time.Date(2026, 3, 8, 0, 0, 30, 0, time.UTC)
+
+	// The revealed votes are frozen as the standings, not the unused counters
+	mock.ExpectQuery("SELECT id FROM polls WHERE COALESCE\\(reveal_closes_at, closes_at\\) <= \\? AND finalized_at IS NULL").
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT finalized_at, reveal_closes_at, credit_budget FROM polls WHERE id = \\? FOR UPDATE").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"finalized_at", "reveal_closes_at", "credit_budget"}).AddRow(nil, now.Add(-time.Minute), 0))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_snapshots WHERE poll_id = \\?").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("LEFT JOIN poll_commitments v ON .* AND v.revealed_at IS NOT NULL(.|\\s)*ORDER BY COUNT\\(v.voter_id\\) DESC, pc.crypto_id").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "revealed", "down_vote", "weighted_votes", "token_voters", "token_weight"}).
+			AddRow(6, "Optimism", 4, 0, 0, nil, nil).
+			AddRow(5, "Arbitrum", 1, 0, 0, nil, nil))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(2, 1, 6, "Optimism", 4, 0, 0, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO poll_results").
+		WithArgs(2, 2, 5, "Arbitrum", 1, 0, 0, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE polls SET finalized_at = \\? WHERE id = \\?").
+		WithArgs(now, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	closed, err := pollService.ClosePolls(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, closed)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Projector folds domain events into a read model. Reset empties the read
+// model before a rebuild replays the log into it from the start.
+type Projector interface {
+	Name() string
+	Reset(tx *sql.Tx) error
+	Apply(tx *sql.Tx, event DomainEvent) error
+}
+
+// voteCounterColumn returns the crypto_vote counter of the vote direction.
+func voteCounterColumn(direction string) (string, error) {
+	switch direction {
+	case "up", "down":
+		return direction + "_vote", nil
+	}
+	return "", fmt.Errorf("unknown vote direction %q", direction)
+}
+
+// TallyProjector projects the vote counters of crypto_vote. The vote
+// endpoints update the counters themselves in the transaction of the vote,
+// so the projector is only replayed to rebuild them.
+type TallyProjector struct{}
+
+func (TallyProjector) Name() string {
+	return "tally"
+}
+
+func (TallyProjector) Reset(tx *sql.Tx) error {
+	_, err := tx.Exec("UPDATE crypto_vote SET up_vote = 0, down_vote = 0, total_votes = 0")
+	return err
+}
+
+func (TallyProjector) Apply(tx *sql.Tx, event DomainEvent) error {
+	switch event.Type {
+	case DomainEventVoteCast:
+		var vote VoteCast
+		if err := json.Unmarshal(event.Data, &vote); err != nil {
+			return err
+		}
+		column, err := voteCounterColumn(vote.Direction)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE crypto_vote SET "+column+" = "+column+" + 1, total_votes = up_vote + down_vote WHERE id = ?", vote.CryptoID)
+		return err
+
+	case DomainEventTallyImported:
+		var tally TallyImported
+		if err := json.Unmarshal(event.Data, &tally); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE crypto_vote SET up_vote = up_vote + ?, down_vote = down_vote + ?, total_votes = up_vote + down_vote WHERE id = ?",
+			tally.UpVote, tally.DownVote, tally.CryptoID)
+		return err
+
+	case DomainEventCryptoMerged:
+		var merge CryptoCurrencyMerge
+		if err := json.Unmarshal(event.Data, &merge); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE crypto_vote SET up_vote = up_vote + ?, down_vote = down_vote + ?, total_votes = up_vote + down_vote WHERE id = ?",
+			merge.MovedUpVotes, merge.MovedDownVotes, merge.Survivor.ID)
+		return err
+	}
+	return nil
+}
+
+// LeaderboardProjector projects the current leaderboard into the leaderboard
+// table, keeping the score of every cryptocurrency indexed for ranking.
+// Cryptocurrencies in the trash keep their row, flagged as deleted, so they
+// rank again with their votes once restored.
+type LeaderboardProjector struct{}
+
+func (LeaderboardProjector) Name() string {
+	return "leaderboard"
+}
+
+func (LeaderboardProjector) Reset(tx *sql.Tx) error {
+	_, err := tx.Exec("DELETE FROM leaderboard")
+	return err
+}
+
+func (LeaderboardProjector) Apply(tx *sql.Tx, event DomainEvent) error {
+	switch event.Type {
+	case DomainEventCryptoCreated:
+		var crypto CryptoCurrency
+		if err := json.Unmarshal(event.Data, &crypto); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT INTO leaderboard (crypto_id, name, up_vote, down_vote, score, deleted) VALUES (?, ?, 0, 0, 0, FALSE)",
+			event.AggregateID, crypto.Name)
+		return err
+
+	case DomainEventTallyImported:
+		var tally TallyImported
+		if err := json.Unmarshal(event.Data, &tally); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT INTO leaderboard (crypto_id, name, up_vote, down_vote, score, deleted) VALUES (?, ?, ?, ?, ?, ?)",
+			tally.CryptoID, tally.Name, tally.UpVote, tally.DownVote, tally.UpVote-tally.DownVote, tally.Deleted)
+		return err
+
+	case DomainEventVoteCast:
+		var vote VoteCast
+		if err := json.Unmarshal(event.Data, &vote); err != nil {
+			return err
+		}
+		column, err := voteCounterColumn(vote.Direction)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE leaderboard SET "+column+" = "+column+" + 1, score = up_vote - down_vote WHERE crypto_id = ?", vote.CryptoID)
+		return err
+
+	case DomainEventCryptoDeleted:
+		_, err := tx.Exec("UPDATE leaderboard SET deleted = TRUE WHERE crypto_id = ?", event.AggregateID)
+		return err
+
+	case DomainEventCryptoRestored:
+		_, err := tx.Exec("UPDATE leaderboard SET deleted = FALSE WHERE crypto_id = ?", event.AggregateID)
+		return err
+
+	case DomainEventCryptoMerged:
+		var merge CryptoCurrencyMerge
+		if err := json.Unmarshal(event.Data, &merge); err != nil {
+			return err
+		}
+		_, err := tx.Exec("UPDATE leaderboard SET up_vote = up_vote + ?, down_vote = down_vote + ?, score = up_vote - down_vote WHERE crypto_id = ?",
+			merge.MovedUpVotes, merge.MovedDownVotes, merge.Survivor.ID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM leaderboard WHERE crypto_id = ?", merge.MergedID)
+		return err
+	}
+	return nil
+}
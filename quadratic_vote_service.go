@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// quadraticCost returns the credits needed to add weight votes on a candidate
+// the voter already cast current votes on. Casting n votes in total costs n²,
+// so the cost is (current + weight)² - current².
+func quadraticCost(current, weight int) int {
+	total := current + weight
+	return total*total - current*current
+}
+
+// GetVoterCredits returns the quadratic voting balance of the voter who
+// signed the request, see RequireVoter.
+func (s *PollService) GetVoterCredits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	voter, ok := authenticatedVoter(r)
+	if !ok {
+		http.Error(w, "Voter authentication is required", http.StatusUnauthorized)
+		return
+	}
+	credits := VoterCredits{PollID: poll.ID, VoterID: voter, Budget: poll.CreditBudget}
+
+	err := s.db.QueryRow("SELECT spent FROM poll_credits WHERE poll_id = ? AND voter_id = ?", poll.ID, credits.VoterID).Scan(&credits.Spent)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting credits", http.StatusInternalServerError)
+		return
+	}
+	credits.Remaining = credits.Budget - credits.Spent
+
+	json.NewEncoder(w).Encode(credits)
+}
+
+// CastQuadraticVote spends credits from the budget of the voter who signed
+// the request to cast weight votes on the candidate at quadratic cost.
+func (s *PollService) CastQuadraticVote(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	cryptoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	if poll.CreditBudget == 0 {
+		http.Error(w, "Poll does not use quadratic voting", http.StatusConflict)
+		return
+	}
+
+	// Votes are only accepted between the opening and closing times
+	if !checkVotingWindow(w, poll) {
+		return
+	}
+
+	voter, ok := authenticatedVoter(r)
+	if !ok {
+		http.Error(w, "Voter authentication is required to cast a quadratic vote", http.StatusUnauthorized)
+		return
+	}
+
+	var request struct {
+		Weight int `json:"weight"`
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if request.Weight < 1 {
+		http.Error(w, "Weight must be a positive number of votes", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error casting quadratic vote", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Check if the cryptocurrency is a candidate of the poll
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM poll_candidates WHERE poll_id = ? AND crypto_id = ?", poll.ID, cryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting quadratic vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency is not a candidate of this poll", http.StatusNotFound)
+		return
+	}
+
+	// Lock the voter's balance so concurrent votes can't overspend it
+	_, err = tx.Exec("INSERT IGNORE INTO poll_credits (poll_id, voter_id, spent) VALUES (?, ?, 0)", poll.ID, voter)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error casting quadratic vote", http.StatusInternalServerError)
+		return
+	}
+
+	credits := VoterCredits{PollID: poll.ID, VoterID: voter, Budget: poll.CreditBudget}
+	err = tx.QueryRow("SELECT spent FROM poll_credits WHERE poll_id = ? AND voter_id = ? FOR UPDATE", poll.ID, voter).Scan(&credits.Spent)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting quadratic vote", http.StatusInternalServerError)
+		return
+	}
+
+	var current int
+	err = tx.QueryRow("SELECT weight FROM poll_quadratic_votes WHERE poll_id = ? AND voter_id = ? AND crypto_id = ?", poll.ID, voter, cryptoID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting quadratic vote", http.StatusInternalServerError)
+		return
+	}
+
+	cost := quadraticCost(current, request.Weight)
+	if cost > credits.Budget-credits.Spent {
+		http.Error(w, "Not enough credits: the vote costs "+strconv.Itoa(cost)+" credits and "+strconv.Itoa(credits.Budget-credits.Spent)+" remain", http.StatusForbidden)
+		return
+	}
+
+	_, err = tx.Exec("INSERT INTO poll_quadratic_votes (poll_id, voter_id, crypto_id, weight) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE weight = weight + VALUES(weight)",
+		poll.ID, voter, cryptoID, request.Weight)
+	if err == nil {
+		_, err = tx.Exec("UPDATE poll_credits SET spent = spent + ? WHERE poll_id = ? AND voter_id = ?", cost, poll.ID, voter)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE poll_candidates SET weighted_votes = weighted_votes + ? WHERE poll_id = ? AND crypto_id = ?", request.Weight, poll.ID, cryptoID)
+	}
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error casting quadratic vote", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error casting quadratic vote", http.StatusInternalServerError)
+		return
+	}
+
+	credits.Spent += cost
+	credits.Remaining = credits.Budget - credits.Spent
+
+	candidate, err := getCandidate(s.db, poll.ID, cryptoID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting poll candidate", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(QuadraticVote{Weight: request.Weight, Cost: cost, Candidate: candidate, Credits: credits})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuadraticCost(t *testing.T) {
+	assert.Equal(t, 1, quadraticCost(0, 1))
+	assert.Equal(t, 9, quadraticCost(0, 3))
+
+	// Adding votes later costs the same as casting them all at once
+	assert.Equal(t, 5, quadraticCost(2, 1))
+	assert.Equal(t, quadraticCost(0, 3), quadraticCost(0, 2)+quadraticCost(2, 1))
+}
+
+func TestCastQuadraticVote(t *testing.T) {
+	t.Run("WithinBudget", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		// Set the expectations for the poll, the balance and the weighted vote
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Governance", "", "public", nil, nil, 100, nil, nil, time.Now()))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_candidates WHERE poll_id = \\? AND crypto_id = \\?").
+			WithArgs(1, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("INSERT IGNORE INTO poll_credits").
+			WithArgs(1, "7").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT spent FROM poll_credits WHERE poll_id = \\? AND voter_id = \\? FOR UPDATE").
+			WithArgs(1, "7").
+			WillReturnRows(sqlmock.NewRows([]string{"spent"}).AddRow(20))
+		mock.ExpectQuery("SELECT weight FROM poll_quadratic_votes").
+			WithArgs(1, "7", 5).
+			WillReturnRows(sqlmock.NewRows([]string{"weight"}).AddRow(2))
+		mock.ExpectExec("INSERT INTO poll_quadratic_votes").
+			WithArgs(1, "7", 5, 3).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("UPDATE poll_credits SET spent = spent \\+ \\?").
+			WithArgs(21, 1, "7").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE poll_candidates SET weighted_votes = weighted_votes \\+ \\?").
+			WithArgs(3, 1, 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("FROM poll_candidates pc").
+			WithArgs(1, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"poll_id", "crypto_id", "name", "up_vote", "down_vote", "total_votes", "weighted_votes"}).AddRow(1, 5, "Arbitrum", 4, 1, 5, 12))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("POST", "/v1/polls/1/cryptovote/5/quadratic-vote", strings.NewReader(`{"weight": 3}`))
+		assert.NoError(t, err)
+		req = withVoter(req, "7")
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/quadratic-vote", pollService.CastQuadraticVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content: going from 2 to 5 votes costs 25 - 4 credits
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var vote QuadraticVote
+		err = json.Unmarshal(rr.Body.Bytes(), &vote)
+		assert.NoError(t, err)
+		assert.Equal(t, 21, vote.Cost)
+		assert.Equal(t, VoterCredits{PollID: 1, VoterID: "7", Budget: 100, Spent: 41, Remaining: 59}, vote.Credits)
+		assert.Equal(t, 12, vote.Candidate.WeightedVotes)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NotEnoughCredits", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("FROM polls WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "Governance", "", "public", nil, nil, 100, nil, nil, time.Now()))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_candidates").
+			WithArgs(1, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("INSERT IGNORE INTO poll_credits").
+			WithArgs(1, "7").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT spent FROM poll_credits").
+			WithArgs(1, "7").
+			WillReturnRows(sqlmock.NewRows([]string{"spent"}).AddRow(90))
+		mock.ExpectQuery("SELECT weight FROM poll_quadratic_votes").
+			WithArgs(1, "7", 5).
+			WillReturnRows(sqlmock.NewRows([]string{"weight"}))
+		mock.ExpectRollback()
+
+		req, err := http.NewRequest("POST", "/v1/polls/1/cryptovote/5/quadratic-vote", strings.NewReader(`{"weight": 4}`))
+		assert.NoError(t, err)
+		req = withVoter(req, "7")
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/quadratic-vote", pollService.CastQuadraticVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "the vote costs 16 credits and 10 remain")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
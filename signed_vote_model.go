@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type Voter struct {
+	ID        int       `json:"id"`
+	PublicKey string    `json:"public_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SignedVote struct {
+	ID        int       `json:"id"`
+	VoterID   int       `json:"voter_id"`
+	PublicKey string    `json:"public_key"`
+	CryptoID  int       `json:"crypto_id"`
+	Direction string    `json:"direction"`
+	Nonce     string    `json:"nonce"`
+	Timestamp int64     `json:"timestamp"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Message returns the bytes the voter signs. Anyone can rebuild it from the
+// ledger to verify the signature.
+func (v SignedVote) Message() []byte {
+	return []byte(fmt.Sprintf("crypto-vote:%d:%s:%s:%d", v.CryptoID, v.Direction, v.Nonce, v.Timestamp))
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Signed votes older or newer than this are rejected, which bounds how long
+// the nonce of a vote has to be remembered.
+const signedVoteMaxSkew = 5 * time.Minute
+
+const maxLedgerPageSize = 1000
+
+// Bodies of the requests signed by voters are read whole to be hashed.
+const maxVoterRequestSize = 1 << 20
+
+type SignedVoteService struct {
+	db         Database
+	observers  voteObservers
+	events     eventSinks
+	challenges *ChallengeService
+	webhooks   *WebhookService
+
+	// Votes a voter may cast within voteRateWindow, unlimited when zero
+	maxVotesPerWindow int
+	voteRateWindow    time.Duration
+}
+
+func NewSignedVoteService(db *sql.DB) *SignedVoteService {
+	return &SignedVoteService{
+		db: db,
+	}
+}
+
+// AddEventSinks records every signed vote as a domain event in the sinks, in
+// the same transaction as the vote.
+func (s *SignedVoteService) AddEventSinks(sinks ...EventSink) {
+	s.events = append(s.events, sinks...)
+}
+
+// AddVoteObserver notifies the observer of every signed vote.
+func (s *SignedVoteService) AddVoteObserver(observer VoteObserver) {
+	s.observers = append(s.observers, observer)
+}
+
+// RequireProofOfWork makes registering a voter cost a solved challenge sent
+// in the X-PoW-Challenge and X-PoW-Nonce headers, so keys are not free.
+func (s *SignedVoteService) RequireProofOfWork(challenges *ChallengeService) {
+	s.challenges = challenges
+}
+
+// EnableWebhooks publishes the vote milestones reached by signed votes to the
+// webhook subscriptions.
+func (s *SignedVoteService) EnableWebhooks(webhooks *WebhookService) {
+	s.webhooks = webhooks
+}
+
+// LimitVoteRate lets every voter cast at most max signed votes per window.
+func (s *SignedVoteService) LimitVoteRate(max int, window time.Duration) {
+	s.maxVotesPerWindow = max
+	s.voteRateWindow = window
+}
+
+func (s *SignedVoteService) RegisterVoter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var voter Voter
+
+	err := json.NewDecoder(r.Body).Decode(&voter)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(voter.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		http.Error(w, "Public key must be a base64 encoded Ed25519 key", http.StatusBadRequest)
+		return
+	}
+
+	// Store the key in its canonical encoding so lookups match
+	voter.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+
+	// The challenge is handed back unless the voter is registered
+	challenge, ok := s.challenges.CheckVoterRegistration(w, r)
+	if !ok {
+		return
+	}
+	defer challenge.Release()
+
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM voters WHERE public_key = ?", voter.PublicKey).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error registering voter", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Public key is already registered", http.StatusConflict)
+		return
+	}
+
+	voter.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	result, err := s.db.Exec("INSERT INTO voters (public_key, created_at) VALUES (?, ?)", voter.PublicKey, voter.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error registering voter", http.StatusInternalServerError)
+		return
+	}
+
+	lastInsertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error getting last insert ID:", err)
+		http.Error(w, "Error registering voter", http.StatusInternalServerError)
+		return
+	}
+
+	voter.ID = int(lastInsertID)
+	challenge.Keep()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(voter)
+}
+
+func (s *SignedVoteService) CastSignedVote(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var vote SignedVote
+
+	err := json.NewDecoder(r.Body).Decode(&vote)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var voteColumn string
+	switch vote.Direction {
+	case "up":
+		voteColumn = "up_vote"
+	case "down":
+		voteColumn = "down_vote"
+	default:
+		http.Error(w, "Direction must be up or down", http.StatusBadRequest)
+		return
+	}
+
+	if vote.Nonce == "" || len(vote.Nonce) > 64 {
+		http.Error(w, "Nonce must be between 1 and 64 characters", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	signedAt := time.Unix(vote.Timestamp, 0)
+	if signedAt.Before(now.Add(-signedVoteMaxSkew)) || signedAt.After(now.Add(signedVoteMaxSkew)) {
+		http.Error(w, "Timestamp is too far from the server time", http.StatusBadRequest)
+		return
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(vote.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		http.Error(w, "Public key must be a base64 encoded Ed25519 key", http.StatusBadRequest)
+		return
+	}
+	vote.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+
+	// Look up the registered key of the voter
+	err = s.db.QueryRow("SELECT id FROM voters WHERE public_key = ?", vote.PublicKey).Scan(&vote.VoterID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Public key is not registered", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(vote.Signature)
+	if err != nil || !ed25519.Verify(publicKey, vote.Message(), signature) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	// A registered key cannot sign an unlimited number of votes
+	if s.maxVotesPerWindow > 0 {
+		var recent int
+		err = s.db.QueryRow("SELECT COUNT(*) FROM signed_votes WHERE voter_id = ? AND created_at >= ?", vote.VoterID, now.Add(-s.voteRateWindow)).Scan(&recent)
+		if err != nil {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+			return
+		}
+
+		if recent >= s.maxVotesPerWindow {
+			http.Error(w, "Voter cast too many votes, try again later", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// Check if the cryptocurrency exists in the database
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", vote.CryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+
+	// A nonce can only be used once per voter, which prevents replays
+	err = s.db.QueryRow("SELECT COUNT(*) FROM signed_votes WHERE voter_id = ? AND nonce = ?", vote.VoterID, vote.Nonce).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Nonce has already been used", http.StatusConflict)
+		return
+	}
+
+	vote.CreatedAt = now.Truncate(time.Second)
+
+	// The ledger vote and the tally update are stored together or not at all
+	tx, err := s.events.BeginTx(s.db)
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO signed_votes (voter_id, crypto_id, direction, nonce, timestamp, signature, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		vote.VoterID, vote.CryptoID, vote.Direction, vote.Nonce, vote.Timestamp, vote.Signature, vote.CreatedAt)
+	if isDuplicateKeyError(err) {
+		// A concurrent request used the nonce first
+		http.Error(w, "Nonce has already been used", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	lastInsertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error getting last insert ID:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	vote.ID = int(lastInsertID)
+
+	// Update the database with the new vote count
+	result, err = tx.Exec("UPDATE crypto_vote SET "+voteColumn+" = "+voteColumn+" + 1, total_votes = up_vote + down_vote WHERE id = ?", vote.CryptoID)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	// The cryptocurrency was purged since the check, the nonce is not used up
+	if rowsAffected == 0 {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+
+	tx.Append(DomainEventVoteCast, vote.CryptoID, VoteCast{CryptoID: vote.CryptoID, Direction: vote.Direction, Source: VoteSourceSigned, CastAt: vote.CreatedAt})
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error casting signed vote", http.StatusInternalServerError)
+		return
+	}
+
+	s.observers.notify(vote.CryptoID, vote.Direction, vote.CreatedAt)
+	s.webhooks.CheckMilestonesOf(vote.CryptoID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(vote)
+}
+
+// GetLedger returns the raw signed votes in insertion order. Pages are
+// requested with the id of the last vote seen in the after parameter.
+func (s *SignedVoteService) GetLedger(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	after := 0
+	if value := r.URL.Query().Get("after"); value != "" {
+		var err error
+		after, err = strconv.Atoi(value)
+		if err != nil || after < 0 {
+			http.Error(w, "Invalid after parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := maxLedgerPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxLedgerPageSize {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	votes := []SignedVote{}
+
+	rows, err := s.db.Query(`SELECT v.id, v.voter_id, k.public_key, v.crypto_id, v.direction, v.nonce, v.timestamp, v.signature, v.created_at
+		FROM signed_votes v JOIN voters k ON k.id = v.voter_id WHERE v.id > ? ORDER BY v.id LIMIT ?`, after, limit)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting ledger", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var vote SignedVote
+		if err := rows.Scan(&vote.ID, &vote.VoterID, &vote.PublicKey, &vote.CryptoID, &vote.Direction, &vote.Nonce,
+			&vote.Timestamp, &vote.Signature, &vote.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting ledger", http.StatusInternalServerError)
+			return
+		}
+		votes = append(votes, vote)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting ledger", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(votes)
+}
+
+// voterRequestMessage returns the bytes a voter signs to authenticate a
+// request: the method, path, timestamp and nonce of the request and the
+// sha256 of its body.
+func voterRequestMessage(r *http.Request, timestamp int64, nonce string, body []byte) []byte {
+	hash := sha256.Sum256(body)
+	return []byte(fmt.Sprintf("crypto-vote-request:%s:%s:%d:%s:%s", r.Method, r.URL.Path, timestamp, nonce, hex.EncodeToString(hash[:])))
+}
+
+// RequireVoter authenticates the request as sent by a registered voter. The
+// voter sends the base64 public key in X-Voter-Key, the unix time in
+// X-Voter-Timestamp, a nonce in X-Voter-Nonce and in X-Voter-Signature the
+// base64 Ed25519 signature of voterRequestMessage. The ID of the voter is
+// passed to the handler, see authenticatedVoter.
+func (s *SignedVoteService) RequireVoter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		publicKey, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Voter-Key"))
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			http.Error(w, "X-Voter-Key must be a base64 encoded Ed25519 key", http.StatusUnauthorized)
+			return
+		}
+
+		nonce := r.Header.Get("X-Voter-Nonce")
+		if nonce == "" || len(nonce) > 64 {
+			http.Error(w, "X-Voter-Nonce must be between 1 and 64 characters", http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now().UTC()
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-Voter-Timestamp"), 10, 64)
+		signedAt := time.Unix(timestamp, 0)
+		if err != nil || signedAt.Before(now.Add(-signedVoteMaxSkew)) || signedAt.After(now.Add(signedVoteMaxSkew)) {
+			http.Error(w, "X-Voter-Timestamp is too far from the server time", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxVoterRequestSize))
+		if err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		signature, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Voter-Signature"))
+		if err != nil || !ed25519.Verify(publicKey, voterRequestMessage(r, timestamp, nonce, body), signature) {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var voterID int
+		err = s.db.QueryRow("SELECT id FROM voters WHERE public_key = ?", base64.StdEncoding.EncodeToString(publicKey)).Scan(&voterID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Public key is not registered", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Println("Error querying database:", err)
+			http.Error(w, "Error authenticating voter", http.StatusInternalServerError)
+			return
+		}
+
+		// A signed request is accepted once, it can't be replayed while its
+		// timestamp is valid. The nonce is stored under a unique key so that
+		// no instance accepts it twice, and the voter's expired nonces are
+		// dropped since their requests are rejected by the timestamp check.
+		_, err = s.db.Exec("DELETE FROM voter_request_nonces WHERE voter_id = ? AND expires_at < ?", voterID, now)
+		if err == nil {
+			_, err = s.db.Exec("INSERT INTO voter_request_nonces (voter_id, nonce, expires_at) VALUES (?, ?, ?)", voterID, nonce, signedAt.Add(signedVoteMaxSkew))
+		}
+		if isDuplicateKeyError(err) {
+			http.Error(w, "Nonce has already been used", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Println("Error inserting into database:", err)
+			http.Error(w, "Error authenticating voter", http.StatusInternalServerError)
+			return
+		}
+
+		voter := strconv.Itoa(voterID)
+		ctx := context.WithValue(r.Context(), voterContextKey, voter)
+		ctx = context.WithValue(ctx, actorContextKey, "voter:"+voter)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
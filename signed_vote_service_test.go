@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSignedVoteRequest builds the JSON payload of a vote signed with the key
+func newSignedVoteRequest(t *testing.T, privateKey ed25519.PrivateKey, vote SignedVote) *http.Request {
+	vote.PublicKey = base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey))
+	vote.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, vote.Message()))
+
+	body, err := json.Marshal(vote)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/v1/votes", strings.NewReader(string(body)))
+	assert.NoError(t, err)
+	return req
+}
+
+func TestCastSignedVote(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+
+	t.Run("ValidSignature", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		signedVoteService := NewSignedVoteService(db)
+
+		// Set the expectations for the voter lookup, existence and nonce checks
+		mock.ExpectQuery("SELECT id FROM voters WHERE public_key = ?").
+			WithArgs(encodedKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM signed_votes WHERE voter_id = \\? AND nonce = \\?").
+			WithArgs(3, "abc").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		// Set the expectations for storing the vote and updating the tally
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO signed_votes").
+			WillReturnResult(sqlmock.NewResult(10, 1))
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ 1").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		// Create a new request and recorder for testing the handler
+		req := newSignedVoteRequest(t, privateKey, SignedVote{CryptoID: 1, Direction: "up", Nonce: "abc", Timestamp: time.Now().Unix()})
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/votes", signedVoteService.CastSignedVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var vote SignedVote
+		err = json.Unmarshal(rr.Body.Bytes(), &vote)
+		assert.NoError(t, err)
+		assert.Equal(t, 10, vote.ID)
+		assert.Equal(t, 3, vote.VoterID)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ConcurrentNonceReuse", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		signedVoteService := NewSignedVoteService(db)
+
+		mock.ExpectQuery("SELECT id FROM voters WHERE public_key = ?").
+			WithArgs(encodedKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM signed_votes WHERE voter_id = \\? AND nonce = \\?").
+			WithArgs(3, "abc").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		// Another request stored the nonce after the check
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO signed_votes").
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '3-abc' for key 'voter_nonce'"})
+		mock.ExpectRollback()
+
+		req := newSignedVoteRequest(t, privateKey, SignedVote{CryptoID: 1, Direction: "up", Nonce: "abc", Timestamp: time.Now().Unix()})
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/votes", signedVoteService.CastSignedVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RateLimited", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		signedVoteService := NewSignedVoteService(db)
+		signedVoteService.LimitVoteRate(5, time.Minute)
+
+		// The key already signed as many votes as allowed in the window
+		mock.ExpectQuery("SELECT id FROM voters WHERE public_key = ?").
+			WithArgs(encodedKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM signed_votes WHERE voter_id = \\? AND created_at >= \\?").
+			WithArgs(3, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+
+		req := newSignedVoteRequest(t, privateKey, SignedVote{CryptoID: 1, Direction: "up", Nonce: "abc", Timestamp: time.Now().Unix()})
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/votes", signedVoteService.CastSignedVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("TamperedVote", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		signedVoteService := NewSignedVoteService(db)
+
+		mock.ExpectQuery("SELECT id FROM voters WHERE public_key = ?").
+			WithArgs(encodedKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+		// Sign an up vote, then flip the direction in the payload
+		vote := SignedVote{CryptoID: 1, Direction: "up", Nonce: "abc", Timestamp: time.Now().Unix()}
+		vote.PublicKey = encodedKey
+		vote.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, vote.Message()))
+		vote.Direction = "down"
+
+		body, err := json.Marshal(vote)
+		assert.NoError(t, err)
+
+		req, err := http.NewRequest("POST", "/v1/votes", strings.NewReader(string(body)))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/votes", signedVoteService.CastSignedVote).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRegisterVoter(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	challengeService := NewChallengeService([]byte("secret"), ChallengeConfig{BaseDifficulty: 8, MaxDifficulty: 8, TTL: time.Minute})
+	signedVoteService := NewSignedVoteService(db)
+	signedVoteService.RequireProofOfWork(challengeService)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/voters", signedVoteService.RegisterVoter).Methods("POST")
+	register := func(challenge, nonce string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/v1/voters", strings.NewReader(`{"public_key": "`+encodedKey+`"}`))
+		assert.NoError(t, err)
+		if challenge != "" {
+			req.Header.Set("X-PoW-Challenge", challenge)
+			req.Header.Set("X-PoW-Nonce", nonce)
+		}
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Keys are not free, the registration needs a solved challenge
+	assert.Equal(t, http.StatusPreconditionRequired, register("", "").Code)
+
+	challenge, err := challengeService.Issue(voterChallengeScope, 0, time.Now())
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM voters WHERE public_key = ?").
+		WithArgs(encodedKey).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO voters").
+		WithArgs(encodedKey, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+
+	rr := register(challenge.Challenge, solveChallenge(challenge))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"id":4`)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// signVoterRequest signs the request with the voter's key the way
+// RequireVoter expects
+func signVoterRequest(t *testing.T, req *http.Request, privateKey ed25519.PrivateKey, nonce string, body string) {
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Voter-Key", base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)))
+	req.Header.Set("X-Voter-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Voter-Nonce", nonce)
+	req.Header.Set("X-Voter-Signature", base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, voterRequestMessage(req, timestamp, nonce, []byte(body)))))
+}
+
+// withVoter authenticates the request as the voter, as RequireVoter does
+func withVoter(req *http.Request, voter string) *http.Request {
+	ctx := context.WithValue(req.Context(), voterContextKey, voter)
+	return req.WithContext(context.WithValue(ctx, actorContextKey, "voter:"+voter))
+}
+
+func TestRequireVoter(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	signedVoteService := NewSignedVoteService(db)
+
+	// The handler echoes the authenticated voter and the body it received
+	r := mux.NewRouter()
+	r.Handle("/v1/polls/{pollId:[0-9]+}/ballots", signedVoteService.RequireVoter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		voter, _ := authenticatedVoter(r)
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(voter + " " + actor(r) + " " + string(body)))
+	}))).Methods("POST")
+
+	send := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	body := `{"ranking": [5, 3]}`
+
+	t.Run("SignedByRegisteredVoter", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id FROM voters WHERE public_key = ?").
+			WithArgs(encodedKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec("DELETE FROM voter_request_nonces WHERE voter_id = \\? AND expires_at < \\?").
+			WithArgs(7, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO voter_request_nonces \\(voter_id, nonce, expires_at\\) VALUES \\(\\?, \\?, \\?\\)").
+			WithArgs(7, "n-1", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		req, err := http.NewRequest("POST", "/v1/polls/1/ballots", strings.NewReader(body))
+		assert.NoError(t, err)
+		signVoterRequest(t, req, privateKey, "n-1", body)
+		req.Header.Set("X-Voter-ID", "alice")
+
+		rr := send(req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "7 voter:7 "+body, rr.Body.String())
+
+		// The same signed request can't be replayed, on this instance or
+		// another one sharing the database
+		mock.ExpectQuery("SELECT id FROM voters WHERE public_key = ?").
+			WithArgs(encodedKey).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec("DELETE FROM voter_request_nonces WHERE voter_id = \\? AND expires_at < \\?").
+			WithArgs(7, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO voter_request_nonces \\(voter_id, nonce, expires_at\\) VALUES \\(\\?, \\?, \\?\\)").
+			WithArgs(7, "n-1", sqlmock.AnyArg()).
+			WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '7-n-1' for key 'PRIMARY'"})
+
+		replay, err := http.NewRequest("POST", "/v1/polls/1/ballots", strings.NewReader(body))
+		assert.NoError(t, err)
+		replay.Header = req.Header.Clone()
+
+		rr = send(replay)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("VoterHeaderAlone", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/polls/1/ballots", strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("X-Voter-ID", "alice")
+
+		rr := send(req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("SignatureOverAnotherBody", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/v1/polls/1/ballots", strings.NewReader(`{"ranking": [3, 5]}`))
+		assert.NoError(t, err)
+		signVoterRequest(t, req, privateKey, "n-2", body)
+
+		rr := send(req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("UnregisteredKey", func(t *testing.T) {
+		mock.ExpectQuery("SELECT id FROM voters WHERE public_key = ?").
+			WithArgs(encodedKey).
+			WillReturnError(sql.ErrNoRows)
+
+		req, err := http.NewRequest("POST", "/v1/polls/1/ballots", strings.NewReader(body))
+		assert.NoError(t, err)
+		signVoterRequest(t, req, privateKey, "n-3", body)
+
+		rr := send(req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
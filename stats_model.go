@@ -0,0 +1,19 @@
+package main
+
+import "time"
+
+// CatalogStats summarizes the votes of every cryptocurrency in the catalog.
+// SentimentRatio is the share of up votes among all votes, between 0 and 1.
+type CatalogStats struct {
+	TotalCoins        int             `json:"total_coins"`
+	UpVotes           int             `json:"up_votes"`
+	DownVotes         int             `json:"down_votes"`
+	TotalVotes        int             `json:"total_votes"`
+	VotesLastHour     int             `json:"votes_last_hour"`
+	VotesLastDay      int             `json:"votes_last_day"`
+	SentimentRatio    float64         `json:"sentiment_ratio"`
+	MostUpvoted       *CryptoCurrency `json:"most_upvoted"`
+	MostDownvoted     *CryptoCurrency `json:"most_downvoted"`
+	MostControversial *CryptoCurrency `json:"most_controversial"`
+	GeneratedAt       time.Time       `json:"generated_at"`
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StatsService computes the catalog statistics with SQL aggregates. The
+// statistics are cached for a short time so busy dashboards don't run the
+// aggregates on every request.
+type StatsService struct {
+	db  Database
+	ttl time.Duration
+
+	mu        sync.Mutex
+	stats     *CatalogStats
+	expiresAt time.Time
+}
+
+func NewStatsService(db *sql.DB, ttl time.Duration) *StatsService {
+	return &StatsService{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// GetStats returns the catalog statistics, at most ttl old.
+func (s *StatsService) GetStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	stats, err := s.Stats(time.Now().UTC())
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting statistics", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+// Stats returns the cached statistics, computing them again once they are
+// older than the ttl.
+func (s *StatsService) Stats(now time.Time) (CatalogStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stats != nil && now.Before(s.expiresAt) {
+		return *s.stats, nil
+	}
+
+	stats, err := s.computeStats(now)
+	if err != nil {
+		return CatalogStats{}, err
+	}
+
+	s.stats = &stats
+	s.expiresAt = now.Add(s.ttl)
+	return stats, nil
+}
+
+func (s *StatsService) computeStats(now time.Time) (CatalogStats, error) {
+	stats := CatalogStats{GeneratedAt: now.Truncate(time.Second)}
+
+	err := s.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(up_vote), 0), COALESCE(SUM(down_vote), 0) FROM crypto_vote WHERE deleted_at IS NULL").
+		Scan(&stats.TotalCoins, &stats.UpVotes, &stats.DownVotes)
+	if err != nil {
+		return stats, err
+	}
+	stats.TotalVotes = stats.UpVotes + stats.DownVotes
+	if stats.TotalVotes > 0 {
+		stats.SentimentRatio = float64(stats.UpVotes) / float64(stats.TotalVotes)
+	}
+
+	// Recent votes are counted from the vote history
+	err = s.db.QueryRow(`SELECT COALESCE(SUM(CASE WHEN bucket_start >= ? THEN up_vote + down_vote ELSE 0 END), 0), COALESCE(SUM(up_vote + down_vote), 0)
+		FROM vote_buckets WHERE bucket_start >= ?`, now.Add(-time.Hour), now.Add(-24*time.Hour)).
+		Scan(&stats.VotesLastHour, &stats.VotesLastDay)
+	if err != nil {
+		return stats, err
+	}
+
+	stats.MostUpvoted, err = s.topCryptoCurrency("up_vote > 0", "up_vote DESC")
+	if err != nil {
+		return stats, err
+	}
+
+	stats.MostDownvoted, err = s.topCryptoCurrency("down_vote > 0", "down_vote DESC")
+	if err != nil {
+		return stats, err
+	}
+
+	// The most controversial cryptocurrency has many votes split evenly
+	// between up and down votes
+	stats.MostControversial, err = s.topCryptoCurrency("up_vote > 0 AND down_vote > 0",
+		"POW(up_vote + down_vote, LEAST(up_vote, down_vote) / GREATEST(up_vote, down_vote)) DESC")
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// topCryptoCurrency returns the first cryptocurrency matching the condition
+// in the order, or nil if none matches.
+func (s *StatsService) topCryptoCurrency(condition, order string) (*CryptoCurrency, error) {
+	var crypto CryptoCurrency
+	err := s.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE deleted_at IS NULL AND "+condition+" ORDER BY "+order+", id LIMIT 1").
+		Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &crypto, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var cryptoColumns = []string{"id", "name", "up_vote", "down_vote", "total_votes"}
+
+func TestGetStats(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	statsService := NewStatsService(db, time.Minute)
+
+	// Set the expectations for the aggregates, they are only run once
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COALESCE\\(SUM\\(up_vote\\), 0\\), COALESCE\\(SUM\\(down_vote\\), 0\\) FROM crypto_vote").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "up_vote", "down_vote"}).AddRow(3, 75, 25))
+	mock.ExpectQuery("FROM vote_buckets WHERE bucket_start >= ?").
+		WillReturnRows(sqlmock.NewRows([]string{"last_hour", "last_day"}).AddRow(4, 30))
+	mock.ExpectQuery("ORDER BY up_vote DESC, id LIMIT 1").
+		WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(1, "Bitcoin", 50, 2, 52))
+	mock.ExpectQuery("ORDER BY down_vote DESC, id LIMIT 1").
+		WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(3, "Terra", 5, 15, 20))
+	mock.ExpectQuery("ORDER BY POW\\(up_vote \\+ down_vote").
+		WillReturnRows(sqlmock.NewRows(cryptoColumns).AddRow(2, "Ethereum", 20, 8, 28))
+
+	// Set up the router
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/stats", statsService.GetStats).Methods("GET")
+
+	for i := 0; i < 2; i++ {
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("GET", "/v1/stats", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"total_coins":3,"up_votes":75,"down_votes":25,"total_votes":100,"votes_last_hour":4,"votes_last_day":30,"sentiment_ratio":0.75`)
+		assert.Contains(t, rr.Body.String(), `"most_upvoted":{"id":1,"name":"Bitcoin"`)
+		assert.Contains(t, rr.Body.String(), `"most_downvoted":{"id":3,"name":"Terra"`)
+		assert.Contains(t, rr.Body.String(), `"most_controversial":{"id":2,"name":"Ethereum"`)
+	}
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatsOfEmptyCatalog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	statsService := NewStatsService(db, time.Minute)
+
+	mock.ExpectQuery("FROM crypto_vote WHERE deleted_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "up_vote", "down_vote"}).AddRow(0, 0, 0))
+	mock.ExpectQuery("FROM vote_buckets").
+		WillReturnRows(sqlmock.NewRows([]string{"last_hour", "last_day"}).AddRow(0, 0))
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery("LIMIT 1").WillReturnRows(sqlmock.NewRows(cryptoColumns))
+	}
+
+	stats, err := statsService.Stats(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, stats.SentimentRatio)
+	assert.Nil(t, stats.MostUpvoted)
+	assert.Nil(t, stats.MostDownvoted)
+	assert.Nil(t, stats.MostControversial)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,6 @@
+package main
+
+type Tag struct {
+	Name        string `json:"name"`
+	CryptoCount int    `json:"crypto_count"`
+}
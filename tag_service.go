@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Tag names are lowercase slugs such as "layer-1" or "stablecoin".
+var tagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// TagService manages the categories cryptocurrencies are tagged with. Tags
+// are created the first time they are put on a cryptocurrency.
+type TagService struct {
+	db    Database
+	audit *AuditService
+}
+
+func NewTagService(db *sql.DB) *TagService {
+	return &TagService{
+		db: db,
+	}
+}
+
+// EnableAuditLog records tag changes in the audit log.
+func (s *TagService) EnableAuditLog(audit *AuditService) {
+	s.audit = audit
+}
+
+func (s *TagService) GetAllTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	tags := []Tag{}
+
+	rows, err := s.db.Query(`SELECT t.name, COUNT(c.id) FROM tags t
+		LEFT JOIN crypto_tags ct ON ct.tag_id = t.id
+		LEFT JOIN crypto_vote c ON c.id = ct.crypto_id AND c.deleted_at IS NULL
+		GROUP BY t.id, t.name ORDER BY t.name`)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting tags", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.CryptoCount); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting tags", http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting tags", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (s *TagService) GetCryptoCurrencyTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := s.getTags(cryptoID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting tags", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tags)
+}
+
+// AddTag puts the tag on the cryptocurrency. Adding a tag twice is a no-op.
+func (s *TagService) AddTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	tag := strings.ToLower(params["tag"])
+	if !tagNamePattern.MatchString(tag) {
+		http.Error(w, "Tag must be a lowercase slug of letters, digits and dashes", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the cryptocurrency exists in the database
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", cryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error adding tag", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error adding tag", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT IGNORE INTO tags (name) VALUES (?)", tag)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error adding tag", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec("INSERT IGNORE INTO crypto_tags (crypto_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", cryptoID, tag)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error adding tag", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error adding tag", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected > 0 {
+		err = s.audit.Record(tx, r, AuditActionTagAdd, cryptoID, nil, tag)
+		if err != nil {
+			log.Println("Error recording audit log:", err)
+			http.Error(w, "Error adding tag", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error adding tag", http.StatusInternalServerError)
+		return
+	}
+
+	tags, err := s.getTags(cryptoID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting tags", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (s *TagService) RemoveTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	tag := strings.ToLower(params["tag"])
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error removing tag", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE ct FROM crypto_tags ct JOIN tags t ON t.id = ct.tag_id WHERE ct.crypto_id = ? AND t.name = ?", cryptoID, tag)
+	if err != nil {
+		log.Println("Error deleting from database:", err)
+		http.Error(w, "Error removing tag", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error removing tag", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Cryptocurrency does not have this tag", http.StatusNotFound)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionTagRemove, cryptoID, tag, nil)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error removing tag", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error removing tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *TagService) getTags(cryptoID int) ([]string, error) {
+	tags := []string{}
+
+	rows, err := s.db.Query("SELECT t.name FROM crypto_tags ct JOIN tags t ON t.id = ct.tag_id WHERE ct.crypto_id = ? ORDER BY t.name", cryptoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAllCryptoCurrenciesByTag(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cryptoService := NewCryptoCurrencyService(db)
+
+	rows := sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).
+		AddRow(3, "Tether", 40, 30, 70)
+
+	mock.ExpectQuery("FROM crypto_vote c\\s+JOIN crypto_tags ct ON ct.crypto_id = c.id JOIN tags t ON t.id = ct.tag_id\\s+WHERE c.deleted_at IS NULL AND t.name = \\?\\s+ORDER BY \\(c.up_vote - c.down_vote\\) DESC, c.id").
+		WithArgs("stablecoin").
+		WillReturnRows(rows)
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/cryptovote?tag=Stablecoin", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote", cryptoService.GetAllCryptoCurrencies).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var cryptoCurrencies []CryptoCurrency
+	err = json.Unmarshal(rr.Body.Bytes(), &cryptoCurrencies)
+	assert.NoError(t, err)
+	assert.Equal(t, []CryptoCurrency{{ID: 3, Name: "Tether", UpVote: 40, DownVote: 30, TotalVotes: 70}}, cryptoCurrencies)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddTag(t *testing.T) {
+	t.Run("TagCryptoCurrency", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		tagService := NewTagService(db)
+
+		// Set the expectations for the existence check and creating the tag
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = ?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT IGNORE INTO tags \\(name\\) VALUES \\(\\?\\)").
+			WithArgs("layer-1").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT IGNORE INTO crypto_tags").
+			WithArgs(1, "layer-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT t.name FROM crypto_tags ct").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("layer-1"))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("PUT", "/v1/admin/cryptovote/1/tags/Layer-1", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/tags/{tag}", tagService.AddTag).Methods("PUT")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `["layer-1"]`, rr.Body.String())
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("InvalidTag", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		tagService := NewTagService(db)
+
+		req, err := http.NewRequest("PUT", "/v1/admin/cryptovote/1/tags/meme%20coins", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/cryptovote/{id:[0-9]+}/tags/{tag}", tagService.AddTag).Methods("PUT")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
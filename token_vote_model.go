@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+// TokenSnapshot holds the wallet balances of a poll at a block height. Votes
+// in the poll can be weighted by the balances of the voter's wallets.
+// Balances are decimal strings to keep the precision of token amounts.
+type TokenSnapshot struct {
+	PollID      int               `json:"poll_id"`
+	BlockHeight int64             `json:"block_height"`
+	Balances    map[string]string `json:"balances,omitempty"`
+	Addresses   int               `json:"addresses"`
+	ImportedAt  time.Time         `json:"imported_at"`
+}
+
+// VoterWallet is a wallet address verified as belonging to a voter.
+type VoterWallet struct {
+	VoterID    string    `json:"voter_id"`
+	Address    string    `json:"address"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+type TokenVote struct {
+	PollID    int       `json:"poll_id"`
+	VoterID   string    `json:"voter_id"`
+	CryptoID  int       `json:"crypto_id"`
+	Weight    string    `json:"weight"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenTallyEntry reports both the number of voters who chose the candidate
+// and the sum of their balances.
+type TokenTallyEntry struct {
+	CryptoID int    `json:"crypto_id"`
+	Name     string `json:"name"`
+	Voters   int    `json:"voters"`
+	Weight   string `json:"weight"`
+}
+
+type TokenTally struct {
+	PollID      int               `json:"poll_id"`
+	BlockHeight int64             `json:"block_height"`
+	Voters      int               `json:"voters"`
+	Weight      string            `json:"weight"`
+	Results     []TokenTallyEntry `json:"results"`
+}
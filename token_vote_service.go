@@ -0,0 +1,420 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Balances are non-negative decimal token amounts with up to 18 decimals.
+var tokenBalancePattern = regexp.MustCompile(`^[0-9]{1,47}(\.[0-9]{1,18})?$`)
+
+// Wallet addresses are compared case-insensitively, e.g. "0xAbC..." and
+// "0xabc..." are the same address.
+var walletAddressPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,128}$`)
+
+// parseTokenSnapshot reads a balance snapshot, either as JSON of the form
+// {"block_height": 19000000, "balances": {"0xabc": "12.5"}} or as CSV lines of
+// address,balance with an optional header. CSV snapshots take the block height
+// from the blockHeight argument.
+func parseTokenSnapshot(contentType string, body io.Reader, blockHeight string) (TokenSnapshot, error) {
+	var snapshot TokenSnapshot
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		height, err := strconv.ParseInt(blockHeight, 10, 64)
+		if err != nil {
+			return snapshot, fmt.Errorf("block_height query parameter is required for CSV snapshots")
+		}
+		snapshot.BlockHeight = height
+		snapshot.Balances = make(map[string]string)
+
+		reader := csv.NewReader(body)
+		reader.FieldsPerRecord = 2
+		reader.TrimLeadingSpace = true
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return snapshot, fmt.Errorf("invalid CSV: %v", err)
+			}
+			if line == 1 && strings.EqualFold(record[0], "address") {
+				continue
+			}
+			if _, ok := snapshot.Balances[record[0]]; ok {
+				return snapshot, fmt.Errorf("address %s is listed twice", record[0])
+			}
+			snapshot.Balances[record[0]] = record[1]
+		}
+	case "application/json", "":
+		if err := json.NewDecoder(body).Decode(&snapshot); err != nil {
+			return snapshot, fmt.Errorf("invalid JSON snapshot")
+		}
+	default:
+		return snapshot, fmt.Errorf("snapshots must be sent as application/json or text/csv")
+	}
+
+	if snapshot.BlockHeight <= 0 {
+		return snapshot, fmt.Errorf("block_height must be positive")
+	}
+	if len(snapshot.Balances) == 0 {
+		return snapshot, fmt.Errorf("snapshot has no balances")
+	}
+
+	balances := make(map[string]string, len(snapshot.Balances))
+	for address, balance := range snapshot.Balances {
+		if !walletAddressPattern.MatchString(address) {
+			return snapshot, fmt.Errorf("invalid address %q", address)
+		}
+		if !tokenBalancePattern.MatchString(balance) {
+			return snapshot, fmt.Errorf("invalid balance %q for address %s", balance, address)
+		}
+		address = strings.ToLower(address)
+		if _, ok := balances[address]; ok {
+			return snapshot, fmt.Errorf("address %s is listed twice", address)
+		}
+		balances[address] = balance
+	}
+	snapshot.Balances = balances
+	snapshot.Addresses = len(balances)
+
+	return snapshot, nil
+}
+
+// ImportTokenSnapshot replaces the balance snapshot of the poll. Snapshots
+// can't be replaced once token-weighted votes were cast.
+func (s *PollService) ImportTokenSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	snapshot, err := parseTokenSnapshot(r.Header.Get("Content-Type"), r.Body, r.URL.Query().Get("block_height"))
+	if err != nil {
+		http.Error(w, "Invalid snapshot: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	snapshot.PollID = poll.ID
+	snapshot.ImportedAt = time.Now().UTC().Truncate(time.Second)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error importing snapshot", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM poll_token_votes WHERE poll_id = ?", poll.ID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error importing snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Snapshot can't be replaced after token-weighted votes were cast", http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM poll_snapshot_balances WHERE poll_id = ?", poll.ID)
+	if err == nil {
+		_, err = tx.Exec("REPLACE INTO poll_snapshots (poll_id, block_height, imported_at) VALUES (?, ?, ?)",
+			poll.ID, snapshot.BlockHeight, snapshot.ImportedAt)
+	}
+	for address, balance := range snapshot.Balances {
+		if err != nil {
+			break
+		}
+		_, err = tx.Exec("INSERT INTO poll_snapshot_balances (poll_id, address, balance) VALUES (?, ?, ?)", poll.ID, address, balance)
+	}
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error importing snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	// The balances themselves are not echoed back nor audited
+	snapshot.Balances = nil
+
+	err = s.audit.Record(tx, r, AuditActionPollSnapshotImport, poll.ID, nil, snapshot)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error importing snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error importing snapshot", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// VerifyWallet records that an admin verified the wallet address as belonging
+// to the voter. An address belongs to a single voter.
+func (s *PollService) VerifyWallet(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	voter, err := strconv.Atoi(params["voterId"])
+	if err != nil || voter <= 0 {
+		http.Error(w, "Invalid voter ID", http.StatusBadRequest)
+		return
+	}
+	wallet := VoterWallet{VoterID: strconv.Itoa(voter), Address: params["address"]}
+	if !walletAddressPattern.MatchString(wallet.Address) {
+		http.Error(w, "Invalid wallet address", http.StatusBadRequest)
+		return
+	}
+	wallet.Address = strings.ToLower(wallet.Address)
+	wallet.VerifiedAt = time.Now().UTC().Truncate(time.Second)
+
+	// Wallets belong to registered voters, who sign their token-weighted votes
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM voters WHERE id = ?", voter).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error verifying wallet", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Voter does not exist", http.StatusNotFound)
+		return
+	}
+
+	// Check if the address was already verified for another voter
+	var owner string
+	err = s.db.QueryRow("SELECT voter_id FROM voter_wallets WHERE address = ?", wallet.Address).Scan(&owner)
+	if err == nil && owner != wallet.VoterID {
+		http.Error(w, "Wallet address belongs to another voter", http.StatusConflict)
+		return
+	}
+	if err == nil {
+		json.NewEncoder(w).Encode(wallet)
+		return
+	}
+	if err != sql.ErrNoRows {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error verifying wallet", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error verifying wallet", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO voter_wallets (address, voter_id, verified_at) VALUES (?, ?, ?)", wallet.Address, wallet.VoterID, wallet.VerifiedAt)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error verifying wallet", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionWalletVerify, 0, nil, wallet)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error verifying wallet", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error verifying wallet", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wallet)
+}
+
+// CastTokenVote records the voter's choice in the poll, weighted by the
+// snapshot balances of the voter's verified wallets. Voters sign the request
+// with their registered key, see RequireVoter, and vote once per poll.
+func (s *PollService) CastTokenVote(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	cryptoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	// Votes are only accepted between the opening and closing times
+	if !checkVotingWindow(w, poll) {
+		return
+	}
+
+	voter, ok := authenticatedVoter(r)
+	if !ok {
+		http.Error(w, "Voter authentication is required to cast a token-weighted vote", http.StatusUnauthorized)
+		return
+	}
+	vote := TokenVote{PollID: poll.ID, VoterID: voter, CryptoID: cryptoID}
+
+	// Check if the poll has a snapshot to weight the votes with
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM poll_snapshots WHERE poll_id = ?", poll.ID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting token-weighted vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Poll does not use token-weighted voting", http.StatusConflict)
+		return
+	}
+
+	// Check if the cryptocurrency is a candidate of the poll
+	err = s.db.QueryRow("SELECT COUNT(*) FROM poll_candidates WHERE poll_id = ? AND crypto_id = ?", poll.ID, cryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting token-weighted vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency is not a candidate of this poll", http.StatusNotFound)
+		return
+	}
+
+	// Check if the voter already voted in this poll
+	err = s.db.QueryRow("SELECT COUNT(*) FROM poll_token_votes WHERE poll_id = ? AND voter_id = ?", poll.ID, vote.VoterID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting token-weighted vote", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Voter already cast a token-weighted vote in this poll", http.StatusConflict)
+		return
+	}
+
+	var holders int
+	err = s.db.QueryRow(`SELECT COUNT(b.address), COALESCE(SUM(b.balance), 0) FROM voter_wallets vw
+		JOIN poll_snapshot_balances b ON b.address = vw.address AND b.poll_id = ?
+		WHERE vw.voter_id = ?`, poll.ID, vote.VoterID).Scan(&holders, &vote.Weight)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error casting token-weighted vote", http.StatusInternalServerError)
+		return
+	}
+
+	if holders == 0 {
+		http.Error(w, "None of the voter's verified wallets is in the poll's snapshot", http.StatusForbidden)
+		return
+	}
+
+	vote.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	_, err = s.db.Exec("INSERT INTO poll_token_votes (poll_id, voter_id, crypto_id, weight, created_at) VALUES (?, ?, ?, ?, ?)",
+		vote.PollID, vote.VoterID, vote.CryptoID, vote.Weight, vote.CreatedAt)
+	if isDuplicateKeyError(err) {
+		// A concurrent request cast the voter's vote first
+		http.Error(w, "Voter already cast a token-weighted vote in this poll", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error casting token-weighted vote", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(vote)
+}
+
+// GetTokenWeightedTally returns, for every candidate, the number of voters
+// who chose it and the sum of their weights.
+func (s *PollService) GetTokenWeightedTally(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	poll, ok := s.lookupPoll(w, r)
+	if !ok {
+		return
+	}
+
+	tally := TokenTally{PollID: poll.ID, Results: []TokenTallyEntry{}}
+
+	err := s.db.QueryRow("SELECT block_height FROM poll_snapshots WHERE poll_id = ?", poll.ID).Scan(&tally.BlockHeight)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Poll does not use token-weighted voting", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error tallying token-weighted votes", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(weight), 0) FROM poll_token_votes WHERE poll_id = ?", poll.ID).
+		Scan(&tally.Voters, &tally.Weight)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error tallying token-weighted votes", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := s.db.Query(`SELECT pc.crypto_id, c.name, COUNT(v.voter_id), COALESCE(SUM(v.weight), 0) FROM poll_candidates pc
+		JOIN crypto_vote c ON c.id = pc.crypto_id
+		LEFT JOIN poll_token_votes v ON v.poll_id = pc.poll_id AND v.crypto_id = pc.crypto_id
+		WHERE pc.poll_id = ? AND c.deleted_at IS NULL
+		GROUP BY pc.crypto_id, c.name
+		ORDER BY COALESCE(SUM(v.weight), 0) DESC, COUNT(v.voter_id) DESC, pc.crypto_id`, poll.ID)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error tallying token-weighted votes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry TokenTallyEntry
+		if err := rows.Scan(&entry.CryptoID, &entry.Name, &entry.Voters, &entry.Weight); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error tallying token-weighted votes", http.StatusInternalServerError)
+			return
+		}
+		tally.Results = append(tally.Results, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error tallying token-weighted votes", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tally)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTokenSnapshot(t *testing.T) {
+	t.Run("CSV", func(t *testing.T) {
+		body := "address,balance\n0xAbC,12.5\n0xdef, 3\n"
+		snapshot, err := parseTokenSnapshot("text/csv; charset=utf-8", strings.NewReader(body), "19000000")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(19000000), snapshot.BlockHeight)
+		assert.Equal(t, map[string]string{"0xabc": "12.5", "0xdef": "3"}, snapshot.Balances)
+		assert.Equal(t, 2, snapshot.Addresses)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		body := `{"block_height": 42, "balances": {"0xabc": "1000000000000000000000.000000000000000001"}}`
+		snapshot, err := parseTokenSnapshot("application/json", strings.NewReader(body), "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), snapshot.BlockHeight)
+		assert.Equal(t, "1000000000000000000000.000000000000000001", snapshot.Balances["0xabc"])
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			contentType string
+			body        string
+			blockHeight string
+		}{
+			"MissingBlockHeight": {"text/csv", "0xabc,1\n", ""},
+			"NegativeBalance":    {"text/csv", "0xabc,-1\n", "1"},
+			"DuplicateAddress":   {"text/csv", "0xABC,1\n0xabc,2\n", "1"},
+			"NoBalances":         {"application/json", `{"block_height": 1, "balances": {}}`, ""},
+			"UnsupportedType":    {"application/xml", "<balances/>", "1"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := parseTokenSnapshot(tc.contentType, strings.NewReader(tc.body), tc.blockHeight)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
+
+func TestCastTokenVote(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+
+	// Set the expectations for the checks and the weight of the voter's wallets
+	mock.ExpectQuery("FROM polls WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "DAO listing vote", "", "public", nil, nil, 0, nil, nil, time.Now()))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_snapshots WHERE poll_id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_candidates WHERE poll_id = \\? AND crypto_id = \\?").
+		WithArgs(1, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM poll_token_votes WHERE poll_id = \\? AND voter_id = \\?").
+		WithArgs(1, "7").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT\\(b.address\\), COALESCE\\(SUM\\(b.balance\\), 0\\) FROM voter_wallets vw").
+		WithArgs(1, "7").
+		WillReturnRows(sqlmock.NewRows([]string{"holders", "weight"}).AddRow(2, "15.5"))
+	mock.ExpectExec("INSERT INTO poll_token_votes").
+		WithArgs(1, "7", 5, "15.5", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("POST", "/v1/polls/1/cryptovote/5/token-vote", nil)
+	assert.NoError(t, err)
+	req = withVoter(req, "7")
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/polls/{pollId:[0-9]+}/cryptovote/{id:[0-9]+}/token-vote", pollService.CastTokenVote).Methods("POST")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"weight":"15.5"`)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTokenWeightedTally(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	pollService := NewPollService(db)
+
+	mock.ExpectQuery("FROM polls WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(pollColumns).AddRow(1, "DAO listing vote", "", "public", nil, nil, 0, nil, nil, time.Now()))
+	mock.ExpectQuery("SELECT block_height FROM poll_snapshots WHERE poll_id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"block_height"}).AddRow(19000000))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\), COALESCE\\(SUM\\(weight\\), 0\\) FROM poll_token_votes").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"voters", "weight"}).AddRow(3, "1015.5"))
+	mock.ExpectQuery("LEFT JOIN poll_token_votes v").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "name", "voters", "weight"}).
+			AddRow(6, "Optimism", 1, "1000").
+			AddRow(5, "Arbitrum", 2, "15.5"))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/polls/1/tally/token-weighted", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/polls/{pollId:[0-9]+}/tally/token-weighted", pollService.GetTokenWeightedTally).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content: the headcount and the weight can disagree
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"poll_id": 1,
+		"block_height": 19000000,
+		"voters": 3,
+		"weight": "1015.5",
+		"results": [
+			{"crypto_id": 6, "name": "Optimism", "voters": 1, "weight": "1000"},
+			{"crypto_id": 5, "name": "Arbitrum", "voters": 2, "weight": "15.5"}
+		]
+	}`, rr.Body.String())
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyWallet(t *testing.T) {
+	address := "0x00000000000000000000000000000000000000aB"
+
+	verify := func(t *testing.T, pollService *PollService, voterID string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("PUT", "/v1/admin/voters/"+voterID+"/wallets/"+address, nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/voters/{voterId:[0-9]+}/wallets/{address}", pollService.VerifyWallet).Methods("PUT")
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("RegisteredVoter", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM voters WHERE id = ?").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT voter_id FROM voter_wallets WHERE address = ?").
+			WithArgs(strings.ToLower(address)).
+			WillReturnRows(sqlmock.NewRows([]string{"voter_id"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO voter_wallets").
+			WithArgs(strings.ToLower(address), "7", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		rr := verify(t, pollService, "7")
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"voter_id":"7"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UnknownVoter", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		pollService := NewPollService(db)
+
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM voters WHERE id = ?").
+			WithArgs(8).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		rr := verify(t, pollService, "8")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,13 @@
+package main
+
+type TrendingEntry struct {
+	Rank     int     `json:"rank"`
+	CryptoID int     `json:"crypto_id"`
+	Name     string  `json:"name"`
+	Score    float64 `json:"score"`
+}
+
+type Trending struct {
+	Algorithm string          `json:"algorithm"`
+	Entries   []TrendingEntry `json:"entries"`
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Votes older than the trending window no longer count toward the score.
+const trendingWindow = 48 * time.Hour
+
+const (
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 100
+)
+
+// TrendingService ranks cryptocurrencies by their recent votes, weighed by a
+// decay algorithm. The net votes of every hour in the trending window are
+// kept in memory and updated as votes are counted, so ranking never scans
+// the votes themselves.
+type TrendingService struct {
+	db    Database
+	decay DecayAlgorithm
+
+	mu sync.Mutex
+	// Net votes by cryptocurrency ID and hour since the unix epoch
+	hours map[int]map[int64]int
+}
+
+func NewTrendingService(db *sql.DB, decay DecayAlgorithm) *TrendingService {
+	return &TrendingService{
+		db:    db,
+		decay: decay,
+		hours: make(map[int]map[int64]int),
+	}
+}
+
+// Load fills the trending window ending at now from the vote history. It is
+// meant to be called once at startup, before votes are observed.
+func (s *TrendingService) Load(now time.Time) error {
+	rows, err := s.db.Query(`SELECT crypto_id, TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', bucket_start) DIV 3600 AS hour, SUM(up_vote) - SUM(down_vote) FROM vote_buckets
+		WHERE bucket_start >= ? GROUP BY crypto_id, hour`, now.UTC().Add(-trendingWindow).Truncate(time.Hour))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for rows.Next() {
+		var cryptoID, net int
+		var hour int64
+		if err := rows.Scan(&cryptoID, &hour, &net); err != nil {
+			return err
+		}
+		s.add(cryptoID, hour, net)
+	}
+
+	return rows.Err()
+}
+
+// ObserveVote adds the vote to the net votes of the hour it was cast in.
+func (s *TrendingService) ObserveVote(cryptoID int, direction string, at time.Time) {
+	net := 0
+	switch direction {
+	case "up":
+		net = 1
+	case "down":
+		net = -1
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(cryptoID, at.Unix()/3600, net)
+}
+
+func (s *TrendingService) add(cryptoID int, hour int64, net int) {
+	hours, ok := s.hours[cryptoID]
+	if !ok {
+		hours = make(map[int64]int)
+		s.hours[cryptoID] = hours
+	}
+	hours[hour] += net
+}
+
+// Scores returns the trending score of every cryptocurrency with votes in the
+// window ending at now. Every hour of votes is weighed by the age of its
+// middle. Hours that left the window are dropped along the way.
+func (s *TrendingService) Scores(now time.Time, decay DecayAlgorithm) map[int]float64 {
+	oldest := now.Add(-trendingWindow).Unix() / 3600
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scores := make(map[int]float64, len(s.hours))
+	for cryptoID, hours := range s.hours {
+		score := 0.0
+		for hour, net := range hours {
+			if hour < oldest {
+				delete(hours, hour)
+				continue
+			}
+
+			age := now.Sub(time.Unix(hour*3600, 0).Add(30 * time.Minute))
+			if age < 0 {
+				age = 0
+			}
+			score += float64(net) * decay.Weight(age)
+		}
+
+		if len(hours) == 0 {
+			delete(s.hours, cryptoID)
+			continue
+		}
+		scores[cryptoID] = score
+	}
+
+	return scores
+}
+
+// GetTrending returns the highest scoring cryptocurrencies. The algorithm
+// parameter picks another decay algorithm than the configured one.
+func (s *TrendingService) GetTrending(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+
+	decay := s.decay
+	if value := query.Get("algorithm"); value != "" {
+		var err error
+		decay, err = parseDecayAlgorithm(value)
+		if err != nil {
+			http.Error(w, "Invalid algorithm parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit := defaultTrendingLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxTrendingLimit {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	trending := Trending{Algorithm: decay.Name(), Entries: []TrendingEntry{}}
+
+	scores := s.Scores(time.Now(), decay)
+	if len(scores) == 0 {
+		json.NewEncoder(w).Encode(trending)
+		return
+	}
+
+	// Deleted cryptocurrencies are left out by looking up the names
+	placeholders := make([]string, 0, len(scores))
+	args := make([]interface{}, 0, len(scores))
+	for cryptoID := range scores {
+		placeholders = append(placeholders, "?")
+		args = append(args, cryptoID)
+	}
+
+	rows, err := s.db.Query("SELECT id, name FROM crypto_vote WHERE id IN ("+strings.Join(placeholders, ", ")+") AND deleted_at IS NULL", args...)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting trending cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry TrendingEntry
+		if err := rows.Scan(&entry.CryptoID, &entry.Name); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting trending cryptocurrencies", http.StatusInternalServerError)
+			return
+		}
+		entry.Score = scores[entry.CryptoID]
+		trending.Entries = append(trending.Entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting trending cryptocurrencies", http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(trending.Entries, func(i, j int) bool {
+		if trending.Entries[i].Score != trending.Entries[j].Score {
+			return trending.Entries[i].Score > trending.Entries[j].Score
+		}
+		return trending.Entries[i].CryptoID < trending.Entries[j].CryptoID
+	})
+
+	if len(trending.Entries) > limit {
+		trending.Entries = trending.Entries[:limit]
+	}
+	for i := range trending.Entries {
+		trending.Entries[i].Rank = i + 1
+	}
+
+	json.NewEncoder(w).Encode(trending)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrendingScores(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	trendingService := NewTrendingService(db, HalfLifeDecay{HalfLife: time.Hour})
+	now := time.Date(2026, 3, 8, 12, 30, 0, 0, time.UTC)
+
+	// Two up votes an hour ago weigh as much as one up vote now
+	trendingService.ObserveVote(1, "up", now.Add(-time.Hour))
+	trendingService.ObserveVote(1, "up", now.Add(-time.Hour))
+	trendingService.ObserveVote(2, "up", now)
+	trendingService.ObserveVote(2, "up", now)
+	trendingService.ObserveVote(2, "down", now)
+
+	// Votes that left the window are dropped
+	trendingService.ObserveVote(3, "up", now.Add(-trendingWindow-time.Hour))
+
+	scores := trendingService.Scores(now, trendingService.decay)
+	assert.Len(t, scores, 2)
+	assert.InDelta(t, 1, scores[1], 1e-9)
+	assert.InDelta(t, 1, scores[2], 1e-9)
+	assert.NotContains(t, trendingService.hours, 3)
+}
+
+func TestGetTrending(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	trendingService := NewTrendingService(db, GravityDecay{Gravity: 1.8})
+
+	// Set the expectations for loading the recent votes and naming the trending cryptocurrencies
+	mock.ExpectQuery("FROM vote_buckets").
+		WillReturnRows(sqlmock.NewRows([]string{"crypto_id", "hour", "net"}).
+			AddRow(1, time.Now().Add(-40*time.Hour).Unix()/3600, 50).
+			AddRow(2, time.Now().Unix()/3600, 5).
+			AddRow(3, time.Now().Unix()/3600, 8))
+	mock.ExpectQuery("SELECT id, name FROM crypto_vote WHERE id IN \\(\\?, \\?, \\?\\) AND deleted_at IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(1, "Bitcoin").
+			AddRow(2, "Pepe"))
+
+	assert.NoError(t, trendingService.Load(time.Now()))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("GET", "/v1/cryptovote/trending?limit=5", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/trending", trendingService.GetTrending).Methods("GET")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and content
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The fresh votes of Pepe outweigh the older votes of Bitcoin, the deleted cryptocurrency is left out
+	var trending Trending
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &trending))
+	assert.Equal(t, "gravity", trending.Algorithm)
+	assert.Len(t, trending.Entries, 2)
+	assert.Equal(t, "Pepe", trending.Entries[0].Name)
+	assert.Equal(t, 1, trending.Entries[0].Rank)
+	assert.Equal(t, "Bitcoin", trending.Entries[1].Name)
+	assert.Equal(t, 2, trending.Entries[1].Rank)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
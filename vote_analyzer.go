@@ -0,0 +1,289 @@
+package main
+
+import (
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VoteAnalyzerConfig holds the thresholds used to flag suspicious votes.
+type VoteAnalyzerConfig struct {
+	// Velocity limits for a single IP or voter inside VelocityWindow.
+	VelocityWindow   time.Duration
+	MaxVotesPerIP    int
+	MaxVotesPerVoter int
+
+	// Voters first seen less than NewAccountAge ago are considered new. A coin
+	// receiving MaxNewAccountVotes from new voters inside BurstWindow is flagged.
+	NewAccountAge      time.Duration
+	BurstWindow        time.Duration
+	MaxNewAccountVotes int
+
+	// Number of distinct IPs from the same subnet voting on one coin inside
+	// BurstWindow before the subnet is considered a cluster.
+	MaxSubnetIPs int
+
+	// A coin whose up vote ratio inside BurstWindow differs from its all-time
+	// ratio by more than RatioFlipThreshold (with at least RatioFlipMinVotes
+	// recent votes) is flagged for votes pushing in the new direction.
+	RatioFlipThreshold float64
+	RatioFlipMinVotes  int
+
+	// Votes written behind in batches are only checked against the velocity
+	// limits, counted in memory, except one in SampleRate which goes through
+	// every check.
+	SampleRate int
+}
+
+func DefaultVoteAnalyzerConfig() VoteAnalyzerConfig {
+	return VoteAnalyzerConfig{
+		VelocityWindow:     time.Minute,
+		MaxVotesPerIP:      10,
+		MaxVotesPerVoter:   5,
+		NewAccountAge:      24 * time.Hour,
+		BurstWindow:        10 * time.Minute,
+		MaxNewAccountVotes: 20,
+		MaxSubnetIPs:       8,
+		RatioFlipThreshold: 0.5,
+		RatioFlipMinVotes:  30,
+		SampleRate:         10,
+	}
+}
+
+// VoteAnalyzer inspects incoming votes against the recorded vote events and
+// decides whether they should count right away or wait for a moderator.
+type VoteAnalyzer struct {
+	db     Database
+	config VoteAnalyzerConfig
+
+	// Recent votes by IP and voter, and the number of votes screened by
+	// AnalyzeSampled
+	mu      sync.Mutex
+	recent  map[string][]time.Time
+	sweptAt time.Time
+	sampled int
+}
+
+func NewVoteAnalyzer(db Database, config VoteAnalyzerConfig) *VoteAnalyzer {
+	return &VoteAnalyzer{
+		db:     db,
+		config: config,
+		recent: make(map[string][]time.Time),
+	}
+}
+
+// Analyze returns the reasons for quarantining the vote, or nil if the vote
+// looks legitimate.
+func (a *VoteAnalyzer) Analyze(event VoteEvent) ([]string, error) {
+	var reasons []string
+
+	checks := []func(VoteEvent) (string, error){
+		a.checkIPVelocity,
+		a.checkVoterVelocity,
+		a.checkNewAccountBurst,
+		a.checkSubnetCluster,
+		a.checkRatioFlip,
+	}
+	for _, check := range checks {
+		reason, err := check(event)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	return reasons, nil
+}
+
+// AnalyzeSampled screens a vote written behind in a batch. The velocity of its
+// IP and voter is counted in memory, since the vote events of the batched
+// votes are only recorded when they are flushed, and only one vote in
+// SampleRate is analyzed against the recorded vote events.
+func (a *VoteAnalyzer) AnalyzeSampled(event VoteEvent) ([]string, error) {
+	a.mu.Lock()
+	reasons := a.countVelocity(event)
+	a.sampled++
+	sampled := a.config.SampleRate <= 1 || a.sampled%a.config.SampleRate == 0
+	a.mu.Unlock()
+
+	if len(reasons) > 0 || !sampled {
+		return reasons, nil
+	}
+	return a.Analyze(event)
+}
+
+// countVelocity counts the vote for its IP and voter and returns the velocity
+// limits it exceeds. It must be called with the mutex held.
+func (a *VoteAnalyzer) countVelocity(event VoteEvent) []string {
+	since := event.CreatedAt.Add(-a.config.VelocityWindow)
+
+	// Forget the IPs and voters that stopped voting
+	if !event.CreatedAt.Before(a.sweptAt.Add(a.config.VelocityWindow)) {
+		for key, times := range a.recent {
+			if times[len(times)-1].Before(since) {
+				delete(a.recent, key)
+			}
+		}
+		a.sweptAt = event.CreatedAt
+	}
+
+	var reasons []string
+	if a.countRecent("ip:"+event.VoterIP, since, event.CreatedAt) >= a.config.MaxVotesPerIP {
+		reasons = append(reasons, "ip_velocity")
+	}
+	if event.VoterID != "" && a.countRecent("voter:"+event.VoterID, since, event.CreatedAt) >= a.config.MaxVotesPerVoter {
+		reasons = append(reasons, "voter_velocity")
+	}
+	return reasons
+}
+
+// countRecent returns the number of votes of the key since the given time,
+// then counts the vote cast at.
+func (a *VoteAnalyzer) countRecent(key string, since, at time.Time) int {
+	times := a.recent[key]
+	for len(times) > 0 && times[0].Before(since) {
+		times = times[1:]
+	}
+	count := len(times)
+	a.recent[key] = append(times, at)
+	return count
+}
+
+func (a *VoteAnalyzer) checkIPVelocity(event VoteEvent) (string, error) {
+	var count int
+	err := a.db.QueryRow("SELECT COUNT(*) FROM vote_events WHERE voter_ip = ? AND created_at >= ?",
+		event.VoterIP, event.CreatedAt.Add(-a.config.VelocityWindow)).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+
+	if count >= a.config.MaxVotesPerIP {
+		return "ip_velocity", nil
+	}
+	return "", nil
+}
+
+func (a *VoteAnalyzer) checkVoterVelocity(event VoteEvent) (string, error) {
+	if event.VoterID == "" {
+		return "", nil
+	}
+
+	var count int
+	err := a.db.QueryRow("SELECT COUNT(*) FROM vote_events WHERE voter_id = ? AND created_at >= ?",
+		event.VoterID, event.CreatedAt.Add(-a.config.VelocityWindow)).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+
+	if count >= a.config.MaxVotesPerVoter {
+		return "voter_velocity", nil
+	}
+	return "", nil
+}
+
+func (a *VoteAnalyzer) checkNewAccountBurst(event VoteEvent) (string, error) {
+	if event.VoterID == "" {
+		return "", nil
+	}
+
+	// A voter is new when their first recorded vote is recent (or when this is
+	// their first vote at all)
+	var firstSeen int
+	err := a.db.QueryRow("SELECT COUNT(*) FROM vote_events WHERE voter_id = ? AND created_at < ?",
+		event.VoterID, event.CreatedAt.Add(-a.config.NewAccountAge)).Scan(&firstSeen)
+	if err != nil {
+		return "", err
+	}
+	if firstSeen > 0 {
+		return "", nil
+	}
+
+	var count int
+	err = a.db.QueryRow(`SELECT COUNT(*) FROM vote_events e
+		WHERE e.crypto_id = ? AND e.created_at >= ? AND e.voter_id <> ''
+		AND NOT EXISTS (SELECT 1 FROM vote_events o WHERE o.voter_id = e.voter_id AND o.created_at < ?)`,
+		event.CryptoID, event.CreatedAt.Add(-a.config.BurstWindow), event.CreatedAt.Add(-a.config.NewAccountAge)).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+
+	if count >= a.config.MaxNewAccountVotes {
+		return "new_account_burst", nil
+	}
+	return "", nil
+}
+
+func (a *VoteAnalyzer) checkSubnetCluster(event VoteEvent) (string, error) {
+	var count int
+	err := a.db.QueryRow("SELECT COUNT(DISTINCT voter_ip) FROM vote_events WHERE crypto_id = ? AND voter_subnet = ? AND voter_ip <> ? AND created_at >= ?",
+		event.CryptoID, event.VoterSubnet, event.VoterIP, event.CreatedAt.Add(-a.config.BurstWindow)).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+
+	// Count the incoming IP as well
+	if count+1 >= a.config.MaxSubnetIPs {
+		return "subnet_cluster", nil
+	}
+	return "", nil
+}
+
+func (a *VoteAnalyzer) checkRatioFlip(event VoteEvent) (string, error) {
+	var recentUp, recentTotal int
+	err := a.db.QueryRow("SELECT COALESCE(SUM(direction = 'up'), 0), COUNT(*) FROM vote_events WHERE crypto_id = ? AND status = ? AND created_at >= ?",
+		event.CryptoID, VoteStatusAccepted, event.CreatedAt.Add(-a.config.BurstWindow)).Scan(&recentUp, &recentTotal)
+	if err != nil {
+		return "", err
+	}
+	if recentTotal < a.config.RatioFlipMinVotes {
+		return "", nil
+	}
+
+	var upVote, downVote int
+	err = a.db.QueryRow("SELECT up_vote, down_vote FROM crypto_vote WHERE id = ?", event.CryptoID).Scan(&upVote, &downVote)
+	if err != nil {
+		return "", err
+	}
+
+	// Compare against the tally before the recent window
+	olderUp := upVote - recentUp
+	olderTotal := upVote + downVote - recentTotal
+	if olderTotal < a.config.RatioFlipMinVotes {
+		return "", nil
+	}
+
+	historicalRatio := float64(olderUp) / float64(olderTotal)
+	recentRatio := float64(recentUp) / float64(recentTotal)
+	if math.Abs(recentRatio-historicalRatio) <= a.config.RatioFlipThreshold {
+		return "", nil
+	}
+
+	// Only votes pushing in the direction of the flip are suspicious
+	flippingUp := recentRatio > historicalRatio
+	if (flippingUp && event.Direction == "up") || (!flippingUp && event.Direction == "down") {
+		return "ratio_flip", nil
+	}
+	return "", nil
+}
+
+// subnetOf returns the /24 network for IPv4 addresses and the /48 network for
+// IPv6 addresses, which is the granularity used for clustering.
+func subnetOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+func joinReasons(reasons []string) string {
+	return strings.Join(reasons, ",")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeSampled(t *testing.T) {
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	t.Run("VelocityCountedInMemory", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		config := DefaultVoteAnalyzerConfig()
+		config.MaxVotesPerIP = 3
+		config.SampleRate = 100
+		analyzer := NewVoteAnalyzer(db, config)
+
+		event := VoteEvent{CryptoID: 1, Direction: "up", VoterIP: "192.0.2.1", VoterSubnet: "192.0.2.0/24", CreatedAt: now}
+		for i := 0; i < 3; i++ {
+			reasons, err := analyzer.AnalyzeSampled(event)
+			assert.NoError(t, err)
+			assert.Empty(t, reasons)
+		}
+
+		// The fourth vote of the IP inside the window is flagged without a query
+		reasons, err := analyzer.AnalyzeSampled(event)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ip_velocity"}, reasons)
+
+		// The votes older than the window are forgotten
+		event.CreatedAt = now.Add(config.VelocityWindow + time.Second)
+		reasons, err = analyzer.AnalyzeSampled(event)
+		assert.NoError(t, err)
+		assert.Empty(t, reasons)
+		assert.Len(t, analyzer.recent, 1)
+
+		// Check that no SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("AnalyzesOneVoteInSampleRate", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		config := DefaultVoteAnalyzerConfig()
+		config.SampleRate = 2
+		analyzer := NewVoteAnalyzer(db, config)
+
+		// Only the second vote is analyzed against the vote events
+		mock.ExpectQuery("FROM vote_events WHERE voter_ip = \\?").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("SELECT COUNT\\(DISTINCT voter_ip\\) FROM vote_events").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+		mock.ExpectQuery("FROM vote_events WHERE crypto_id = \\? AND status = \\?").
+			WillReturnRows(sqlmock.NewRows([]string{"up", "total"}).AddRow(0, 0))
+
+		event := VoteEvent{CryptoID: 1, Direction: "up", VoterIP: "192.0.2.1", VoterSubnet: "192.0.2.0/24", CreatedAt: now}
+		reasons, err := analyzer.AnalyzeSampled(event)
+		assert.NoError(t, err)
+		assert.Empty(t, reasons)
+
+		event.VoterIP = "192.0.2.2"
+		reasons, err = analyzer.AnalyzeSampled(event)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"subnet_cluster"}, reasons)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
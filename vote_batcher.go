@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchedCrypto is a cryptocurrency voted on since the last flush: its
+// counts as last read from the database and the votes not flushed yet.
+type batchedCrypto struct {
+	crypto   CryptoCurrency
+	upVote   int
+	downVote int
+	// Set when the cryptocurrency is deleted, its pending votes are still
+	// flushed but no new votes are counted
+	deleted bool
+}
+
+// VoteBatcher counts anonymous votes in memory and writes them behind, in a
+// single batched UPDATE every interval. Votes are answered with the projected
+// counts, the stored counts plus the votes waiting to be flushed. The counts
+// of other instances show up after their next flush.
+type VoteBatcher struct {
+	db        Database
+	events    eventSinks
+	observers voteObservers
+	webhooks  *WebhookService
+
+	mu      sync.Mutex
+	cryptos map[int]*batchedCrypto
+	votes   []VoteCast
+	// Accepted vote events of the screened votes, written with the counts
+	screened []VoteEvent
+
+	// Flushes run one at a time
+	flushMu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newVoteBatcher(db Database, events eventSinks, observers voteObservers, webhooks *WebhookService) *VoteBatcher {
+	return &VoteBatcher{
+		db:        db,
+		events:    events,
+		observers: observers,
+		webhooks:  webhooks,
+		cryptos:   make(map[int]*batchedCrypto),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// start flushes the votes every interval in the background, until Close.
+func (b *VoteBatcher) start(interval time.Duration) {
+	go func() {
+		defer close(b.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := b.Flush(); err != nil {
+					log.Println("Error flushing votes:", err)
+				}
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background flushes and flushes the remaining votes,
+// retrying with backoff until the context is done. The returned error counts
+// the votes that could not be flushed.
+func (b *VoteBatcher) Close(ctx context.Context) error {
+	close(b.stop)
+	<-b.done
+
+	backoff := 100 * time.Millisecond
+	for {
+		_, err := b.Flush()
+		if err == nil {
+			return nil
+		}
+		log.Println("Error flushing votes:", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			b.mu.Lock()
+			pending := len(b.votes)
+			b.mu.Unlock()
+			return fmt.Errorf("dropped %d votes: %w", pending, err)
+		}
+		if backoff < 2*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// Forget stops counting votes for a deleted or merged cryptocurrency. The
+// votes already counted are still flushed, then it is read again from the
+// database on the next vote.
+func (b *VoteBatcher) Forget(cryptoID int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if batched, ok := b.cryptos[cryptoID]; ok {
+		batched.deleted = true
+	}
+}
+
+// Exists reports whether the cryptocurrency exists and is not deleted,
+// reading it from the database unless it was voted on recently.
+func (b *VoteBatcher) Exists(cryptoID int) (bool, error) {
+	_, err := b.load(cryptoID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Vote counts the vote to be flushed, along with its vote event when it was
+// screened, and returns the projected counts of the cryptocurrency. It
+// returns sql.ErrNoRows when the cryptocurrency does not exist.
+func (b *VoteBatcher) Vote(cryptoID int, direction string, at time.Time, screened *VoteEvent) (CryptoCurrency, error) {
+	for {
+		if _, err := b.load(cryptoID); err != nil {
+			return CryptoCurrency{}, err
+		}
+
+		b.mu.Lock()
+		if batched, ok := b.cryptos[cryptoID]; ok {
+			// The cryptocurrency was deleted since it was loaded
+			if batched.deleted {
+				b.mu.Unlock()
+				return CryptoCurrency{}, sql.ErrNoRows
+			}
+			if direction == "up" {
+				batched.upVote++
+			} else {
+				batched.downVote++
+			}
+			b.votes = append(b.votes, VoteCast{CryptoID: cryptoID, Direction: direction, Source: VoteSourceAnonymous, CastAt: at})
+			if screened != nil {
+				b.screened = append(b.screened, *screened)
+			}
+
+			crypto := batched.projected()
+			b.mu.Unlock()
+			return crypto, nil
+		}
+
+		// A flush evicted the cryptocurrency since it was loaded
+		b.mu.Unlock()
+	}
+}
+
+// load returns the cryptocurrency, reading it from the database into the
+// batch when it is not there yet.
+func (b *VoteBatcher) load(cryptoID int) (CryptoCurrency, error) {
+	b.mu.Lock()
+	if batched, ok := b.cryptos[cryptoID]; ok {
+		defer b.mu.Unlock()
+		return batched.loaded()
+	}
+	b.mu.Unlock()
+
+	var crypto CryptoCurrency
+	err := b.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL", cryptoID).
+		Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes)
+	if err != nil {
+		return crypto, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if batched, ok := b.cryptos[cryptoID]; ok {
+		return batched.loaded()
+	}
+	b.cryptos[cryptoID] = &batchedCrypto{crypto: crypto}
+	return crypto, nil
+}
+
+// Flush writes the votes counted since the last flush in one transaction and
+// returns how many were written. When the write fails the votes are kept for
+// the next flush. Cryptocurrencies that were not voted on since the last
+// flush are evicted, so they are read again on their next vote.
+func (b *VoteBatcher) Flush() (int, error) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	// Take the pending votes, new votes are counted for the next flush
+	b.mu.Lock()
+	deltas := make(map[int][2]int)
+	for cryptoID, batched := range b.cryptos {
+		if batched.upVote == 0 && batched.downVote == 0 {
+			delete(b.cryptos, cryptoID)
+			continue
+		}
+		deltas[cryptoID] = [2]int{batched.upVote, batched.downVote}
+		batched.upVote, batched.downVote = 0, 0
+	}
+	votes, screened := b.votes, b.screened
+	b.votes, b.screened = nil, nil
+	b.mu.Unlock()
+
+	if len(deltas) == 0 {
+		return 0, nil
+	}
+
+	// Update the rows in ID order, so concurrent flushes of several
+	// instances lock them in the same order
+	ids := make([]int, 0, len(deltas))
+	for cryptoID := range deltas {
+		ids = append(ids, cryptoID)
+	}
+	sort.Ints(ids)
+
+	if err := b.write(ids, deltas, votes, screened); err != nil {
+		b.mu.Lock()
+		for cryptoID, delta := range deltas {
+			batched := b.cryptos[cryptoID]
+			batched.upVote += delta[0]
+			batched.downVote += delta[1]
+		}
+		b.votes = append(votes, b.votes...)
+		b.screened = append(screened, b.screened...)
+		b.mu.Unlock()
+		return 0, err
+	}
+
+	// The flushed votes are now part of the stored counts
+	b.mu.Lock()
+	for cryptoID, delta := range deltas {
+		batched := b.cryptos[cryptoID]
+		batched.crypto.UpVote += delta[0]
+		batched.crypto.DownVote += delta[1]
+		batched.crypto.TotalVotes = batched.crypto.UpVote + batched.crypto.DownVote
+	}
+	b.mu.Unlock()
+
+	// Pick up the votes flushed by other instances, and forget the
+	// cryptocurrencies deleted in the meantime
+	cryptos, err := b.refresh(ids)
+	if err != nil {
+		log.Println("Error refreshing batched cryptocurrencies:", err)
+	}
+
+	b.observers.notifyBatch(votes)
+	for _, crypto := range cryptos {
+		b.webhooks.CheckMilestones(crypto)
+	}
+
+	return len(votes), nil
+}
+
+// write adds the vote deltas to the counters and stores the screened vote
+// events, the votes of the recording observers and the domain events in a
+// single transaction.
+func (b *VoteBatcher) write(ids []int, deltas map[int][2]int, votes []VoteCast, screened []VoteEvent) error {
+	var upCases, downCases strings.Builder
+	upArgs := make([]interface{}, 0, 2*len(ids))
+	downArgs := make([]interface{}, 0, 2*len(ids))
+	idArgs := make([]interface{}, 0, len(ids))
+	for _, cryptoID := range ids {
+		upCases.WriteString(" WHEN ? THEN ?")
+		downCases.WriteString(" WHEN ? THEN ?")
+		upArgs = append(upArgs, cryptoID, deltas[cryptoID][0])
+		downArgs = append(downArgs, cryptoID, deltas[cryptoID][1])
+		idArgs = append(idArgs, cryptoID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	tx, err := b.events.BeginTx(b.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := append(append(upArgs, downArgs...), idArgs...)
+	_, err = tx.Exec("UPDATE crypto_vote SET up_vote = up_vote + CASE id"+upCases.String()+" ELSE 0 END, down_vote = down_vote + CASE id"+downCases.String()+" ELSE 0 END, total_votes = up_vote + down_vote WHERE id IN ("+placeholders+")", args...)
+	if err != nil {
+		return err
+	}
+
+	if len(screened) > 0 {
+		rows := make([]string, 0, len(screened))
+		eventArgs := make([]interface{}, 0, 8*len(screened))
+		for _, event := range screened {
+			rows = append(rows, "(?, ?, ?, ?, ?, ?, ?, ?)")
+			eventArgs = append(eventArgs, event.CryptoID, event.Direction, event.VoterIP, event.VoterSubnet, event.VoterID, event.Status, event.Reasons, event.CreatedAt)
+		}
+		_, err = tx.Exec("INSERT INTO vote_events (crypto_id, direction, voter_ip, voter_subnet, voter_id, status, reasons, created_at) VALUES "+strings.Join(rows, ", "), eventArgs...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := b.observers.record(tx, votes); err != nil {
+		return err
+	}
+
+	for _, vote := range votes {
+		tx.Append(DomainEventVoteCast, vote.CryptoID, vote)
+	}
+
+	return tx.Commit()
+}
+
+// refresh reads the stored counts of the flushed cryptocurrencies and
+// returns them.
+func (b *VoteBatcher) refresh(ids []int) ([]CryptoCurrency, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, 0, len(ids))
+	for _, cryptoID := range ids {
+		args = append(args, cryptoID)
+	}
+
+	rows, err := b.db.Query("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id IN ("+placeholders+") AND deleted_at IS NULL", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[int]CryptoCurrency, len(ids))
+	for rows.Next() {
+		var crypto CryptoCurrency
+		if err := rows.Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes); err != nil {
+			return nil, err
+		}
+		stored[crypto.ID] = crypto
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cryptos := make([]CryptoCurrency, 0, len(stored))
+	for _, cryptoID := range ids {
+		batched, ok := b.cryptos[cryptoID]
+		if !ok {
+			continue
+		}
+
+		// Votes counted since the flush are still written to a deleted
+		// cryptocurrency, like the votes that passed the check before it was
+		// deleted, but no new votes are counted. A forgotten cryptocurrency
+		// stays forgotten until its votes are flushed, a restored one is read
+		// again once evicted.
+		crypto, ok := stored[cryptoID]
+		if !ok || batched.deleted {
+			if batched.upVote == 0 && batched.downVote == 0 {
+				delete(b.cryptos, cryptoID)
+			}
+			batched.deleted = true
+			if ok {
+				cryptos = append(cryptos, crypto)
+			}
+			continue
+		}
+		batched.crypto = crypto
+		cryptos = append(cryptos, crypto)
+	}
+
+	return cryptos, nil
+}
+
+// loaded returns the cryptocurrency as read from the database, or
+// sql.ErrNoRows once it was deleted.
+func (c *batchedCrypto) loaded() (CryptoCurrency, error) {
+	if c.deleted {
+		return CryptoCurrency{}, sql.ErrNoRows
+	}
+	return c.crypto, nil
+}
+
+func (c *batchedCrypto) projected() CryptoCurrency {
+	crypto := c.crypto
+	crypto.UpVote += c.upVote
+	crypto.DownVote += c.downVote
+	crypto.TotalVotes = crypto.UpVote + crypto.DownVote
+	return crypto
+}
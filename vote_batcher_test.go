@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var batchedCryptoColumns = []string{"id", "name", "up_vote", "down_vote", "total_votes"}
+
+type voteObserverFunc func(cryptoID int, direction string, at time.Time)
+
+func (f voteObserverFunc) ObserveVote(cryptoID int, direction string, at time.Time) {
+	f(cryptoID, direction, at)
+}
+
+// batchObserver counts the votes it observes one by one and in batches.
+type batchObserver struct {
+	votes   int
+	batches [][]VoteCast
+}
+
+func (o *batchObserver) ObserveVote(cryptoID int, direction string, at time.Time) {
+	o.votes++
+}
+
+func (o *batchObserver) ObserveVotes(votes []VoteCast) {
+	o.batches = append(o.batches, votes)
+}
+
+func TestVoteBatcher(t *testing.T) {
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	t.Run("FlushesInOneUpdate", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		var observed []string
+		observers := voteObservers{voteObserverFunc(func(cryptoID int, direction string, at time.Time) {
+			observed = append(observed, direction)
+		})}
+		batcher := newVoteBatcher(db, nil, observers, nil)
+
+		// Every cryptocurrency is read once, its votes are projected on top
+		mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE id=?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 10, 2, 12))
+		mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE id=?").
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(2, "Ethereum", 5, 0, 5))
+
+		crypto, err := batcher.Vote(1, "up", now, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 11, DownVote: 2, TotalVotes: 13}, crypto)
+
+		crypto, err = batcher.Vote(1, "down", now, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 11, DownVote: 3, TotalVotes: 14}, crypto)
+
+		crypto, err = batcher.Vote(2, "up", now, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 6, crypto.UpVote)
+
+		// Set the expectations for writing the deltas and reading back the counts
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ CASE id WHEN \\? THEN \\? WHEN \\? THEN \\? ELSE 0 END, down_vote = down_vote \\+ CASE id WHEN \\? THEN \\? WHEN \\? THEN \\? ELSE 0 END, total_votes = up_vote \\+ down_vote WHERE id IN \\(\\?, \\?\\)").
+			WithArgs(1, 1, 2, 1, 1, 1, 2, 0, 1, 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+		mock.ExpectQuery("FROM crypto_vote WHERE id IN \\(\\?, \\?\\) AND deleted_at IS NULL").
+			WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).
+				AddRow(1, "Bitcoin", 15, 3, 18).
+				AddRow(2, "Ethereum", 6, 0, 6))
+
+		flushed, err := batcher.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, flushed)
+		assert.Equal(t, []string{"up", "down", "up"}, observed)
+
+		// The next vote is projected on the counts read back, which include
+		// the votes of other instances
+		crypto, err = batcher.Vote(1, "up", now, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, 16, crypto.UpVote)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RecordsVotesInTheFlush", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		observer := &batchObserver{}
+		observers := voteObservers{NewVoteHistoryService(db), observer}
+		batcher := newVoteBatcher(db, nil, observers, nil)
+
+		mock.ExpectQuery("FROM crypto_vote WHERE id=?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 10, 2, 12))
+
+		for i := 0; i < 3; i++ {
+			_, err = batcher.Vote(1, "up", now, nil)
+			assert.NoError(t, err)
+		}
+
+		// The history buckets are written with the counts, once per minute
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ CASE id").
+			WithArgs(1, 3, 1, 0, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO vote_buckets \\(crypto_id, bucket_start, up_vote, down_vote\\) VALUES \\(\\?, \\?, \\?, \\?\\) ON DUPLICATE KEY UPDATE").
+			WithArgs(1, now, 3, 0).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("FROM crypto_vote WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 13, 2, 15))
+
+		flushed, err := batcher.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, flushed)
+
+		// The batch observer is notified once of the whole flush
+		assert.Equal(t, 0, observer.votes)
+		assert.Len(t, observer.batches, 1)
+		assert.Len(t, observer.batches[0], 3)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RetriesFailedFlush", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		batcher := newVoteBatcher(db, nil, nil, nil)
+
+		mock.ExpectQuery("FROM crypto_vote WHERE id=?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 10, 2, 12))
+
+		_, err = batcher.Vote(1, "up", now, nil)
+		assert.NoError(t, err)
+
+		// The failed votes are written with the ones counted in the meantime
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ CASE id").
+			WithArgs(1, 1, 1, 0, 1).
+			WillReturnError(errors.New("database error"))
+		mock.ExpectRollback()
+
+		_, err = batcher.Flush()
+		assert.EqualError(t, err, "database error")
+
+		_, err = batcher.Vote(1, "up", now, nil)
+		assert.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ CASE id").
+			WithArgs(1, 2, 1, 0, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("FROM crypto_vote WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 12, 2, 14))
+
+		flushed, err := batcher.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, flushed)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("CloseReportsDroppedVotes", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		batcher := newVoteBatcher(db, nil, nil, nil)
+		batcher.start(time.Hour)
+
+		mock.ExpectQuery("FROM crypto_vote WHERE id=?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 10, 2, 12))
+
+		_, err = batcher.Vote(1, "up", now, nil)
+		assert.NoError(t, err)
+
+		// The flush is retried until the shutdown deadline
+		mock.ExpectBegin().WillReturnError(errors.New("database error"))
+		mock.ExpectBegin().WillReturnError(errors.New("database error"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+		defer cancel()
+		err = batcher.Close(ctx)
+		assert.EqualError(t, err, "dropped 1 votes: database error")
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ForgetsDeletedCryptoCurrency", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		batcher := newVoteBatcher(db, nil, nil, nil)
+
+		mock.ExpectQuery("FROM crypto_vote WHERE id=?").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 10, 2, 12))
+
+		_, err = batcher.Vote(1, "up", now, nil)
+		assert.NoError(t, err)
+
+		// No new votes are counted once deleted, the counted one is flushed
+		batcher.Forget(1)
+		_, err = batcher.Vote(1, "up", now, nil)
+		assert.Equal(t, sql.ErrNoRows, err)
+
+		exists, err := batcher.Exists(1)
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE crypto_vote SET up_vote = up_vote \\+ CASE id").
+			WithArgs(1, 1, 1, 0, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("FROM crypto_vote WHERE id IN \\(\\?\\) AND deleted_at IS NULL").
+			WillReturnRows(sqlmock.NewRows(batchedCryptoColumns))
+
+		flushed, err := batcher.Flush()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, flushed)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestBatchedVote(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	cryptoService := NewCryptoCurrencyService(db)
+	cryptoService.batcher = newVoteBatcher(db, nil, nil, nil)
+
+	// The vote is answered from the batch without writing it
+	mock.ExpectQuery("FROM crypto_vote WHERE id=?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(batchedCryptoColumns).AddRow(1, "Bitcoin", 10, 2, 12))
+
+	// Create a new request and recorder for testing the handler
+	req, err := http.NewRequest("PUT", "/v1/cryptovote/1/upvote", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// Set up the router and call the handler
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/upvote", cryptoService.UpVoteCryptoCurrency).Methods("PUT")
+	r.ServeHTTP(rr, req)
+
+	// Check the response status code and the projected counts
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id": 1, "name": "Bitcoin", "up_vote": 11, "down_vote": 2, "total_votes": 13}`, rr.Body.String())
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,25 @@
+package main
+
+import "time"
+
+const (
+	VoteStatusAccepted    = "accepted"
+	VoteStatusQuarantined = "quarantined"
+	VoteStatusRejected    = "rejected"
+
+	// Votes dropped as duplicates when their cryptocurrency was merged
+	VoteStatusMerged = "merged"
+)
+
+type VoteEvent struct {
+	ID          int        `json:"id"`
+	CryptoID    int        `json:"crypto_id"`
+	Direction   string     `json:"direction"`
+	VoterIP     string     `json:"voter_ip"`
+	VoterSubnet string     `json:"voter_subnet"`
+	VoterID     string     `json:"voter_id,omitempty"`
+	Status      string     `json:"status"`
+	Reasons     string     `json:"reasons,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+}
@@ -0,0 +1,20 @@
+package main
+
+import "time"
+
+// VoteHistoryPoint holds the votes counted during one interval starting at
+// Time. Score is the net sentiment of the interval, up minus down votes.
+type VoteHistoryPoint struct {
+	Time     time.Time `json:"time"`
+	UpVote   int       `json:"up_vote"`
+	DownVote int       `json:"down_vote"`
+	Score    int       `json:"score"`
+}
+
+type VoteHistory struct {
+	CryptoID int                `json:"crypto_id"`
+	Interval string             `json:"interval"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Points   []VoteHistoryPoint `json:"points"`
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Every series is limited to this many points to keep responses chartable.
+const maxVoteHistoryPoints = 1000
+
+var voteHistoryIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// VoteHistoryService aggregates counted votes into one-minute buckets per
+// cryptocurrency and serves them as time series, rolled up to the requested
+// interval.
+type VoteHistoryService struct {
+	db Database
+}
+
+func NewVoteHistoryService(db *sql.DB) *VoteHistoryService {
+	return &VoteHistoryService{
+		db: db,
+	}
+}
+
+// ObserveVote adds a counted vote to the bucket of the minute it was cast in.
+// Failing to record it is logged and does not fail the vote, which was
+// already counted.
+func (s *VoteHistoryService) ObserveVote(cryptoID int, direction string, at time.Time) {
+	up, down := 0, 0
+	switch direction {
+	case "up":
+		up = 1
+	case "down":
+		down = 1
+	default:
+		return
+	}
+
+	_, err := s.db.Exec("INSERT INTO vote_buckets (crypto_id, bucket_start, up_vote, down_vote) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE up_vote = up_vote + VALUES(up_vote), down_vote = down_vote + VALUES(down_vote)",
+		cryptoID, at.UTC().Truncate(time.Minute), up, down)
+	if err != nil {
+		log.Println("Error recording vote history:", err)
+	}
+}
+
+// RecordVotes adds the votes flushed in a batch to their buckets in the
+// flush transaction, in one statement updating each bucket once.
+func (s *VoteHistoryService) RecordVotes(tx executor, votes []VoteCast) error {
+	type bucket struct {
+		cryptoID int
+		start    time.Time
+	}
+	counts := make(map[bucket][2]int)
+	var buckets []bucket
+	for _, vote := range votes {
+		key := bucket{vote.CryptoID, vote.CastAt.UTC().Truncate(time.Minute)}
+		count, ok := counts[key]
+		switch vote.Direction {
+		case "up":
+			count[0]++
+		case "down":
+			count[1]++
+		default:
+			continue
+		}
+		if !ok {
+			buckets = append(buckets, key)
+		}
+		counts[key] = count
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	// Write the buckets in key order, so concurrent flushes lock them in the
+	// same order
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].cryptoID != buckets[j].cryptoID {
+			return buckets[i].cryptoID < buckets[j].cryptoID
+		}
+		return buckets[i].start.Before(buckets[j].start)
+	})
+
+	rows := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, 4*len(buckets))
+	for _, key := range buckets {
+		rows = append(rows, "(?, ?, ?, ?)")
+		args = append(args, key.cryptoID, key.start, counts[key][0], counts[key][1])
+	}
+	_, err := tx.Exec("INSERT INTO vote_buckets (crypto_id, bucket_start, up_vote, down_vote) VALUES "+strings.Join(rows, ", ")+" ON DUPLICATE KEY UPDATE up_vote = up_vote + VALUES(up_vote), down_vote = down_vote + VALUES(down_vote)", args...)
+	return err
+}
+
+// GetHistory returns the up, down and score series of the cryptocurrency
+// between the from and to RFC 3339 times. Intervals without votes are
+// included with zero counts.
+func (s *VoteHistoryService) GetHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	params := mux.Vars(r)
+	cryptoID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid cryptocurrency ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	history := VoteHistory{CryptoID: cryptoID, Interval: query.Get("interval")}
+	if history.Interval == "" {
+		history.Interval = "1h"
+	}
+
+	interval, ok := voteHistoryIntervals[history.Interval]
+	if !ok {
+		http.Error(w, "Interval must be 1m, 1h or 1d", http.StatusBadRequest)
+		return
+	}
+
+	history.To = time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		history.To, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid to time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Without a from time the series covers the last 24 intervals
+	history.From = history.To.Add(-24 * interval)
+	if value := query.Get("from"); value != "" {
+		history.From, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Align the series on whole intervals
+	history.From = history.From.UTC().Truncate(interval)
+	history.To = history.To.UTC().Truncate(interval).Add(interval)
+
+	if !history.From.Before(history.To) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	points := int(history.To.Sub(history.From) / interval)
+	if points > maxVoteHistoryPoints {
+		http.Error(w, "Time range covers more than "+strconv.Itoa(maxVoteHistoryPoints)+" intervals", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the cryptocurrency exists in the database
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM crypto_vote WHERE id = ? AND deleted_at IS NULL", cryptoID).Scan(&count)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting vote history", http.StatusInternalServerError)
+		return
+	}
+
+	if count == 0 {
+		http.Error(w, "Cryptocurrency does not exist", http.StatusNotFound)
+		return
+	}
+
+	history.Points = make([]VoteHistoryPoint, points)
+	for i := range history.Points {
+		history.Points[i].Time = history.From.Add(time.Duration(i) * interval)
+	}
+
+	seconds := int64(interval / time.Second)
+	rows, err := s.db.Query(`SELECT TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', bucket_start) DIV ? AS bucket, SUM(up_vote), SUM(down_vote) FROM vote_buckets
+		WHERE crypto_id = ? AND bucket_start >= ? AND bucket_start < ?
+		GROUP BY bucket ORDER BY bucket`, seconds, cryptoID, history.From, history.To)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting vote history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket int64
+		var up, down int
+		if err := rows.Scan(&bucket, &up, &down); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting vote history", http.StatusInternalServerError)
+			return
+		}
+
+		i := int((bucket*seconds - history.From.Unix()) / seconds)
+		if i < 0 || i >= len(history.Points) {
+			continue
+		}
+		history.Points[i].UpVote = up
+		history.Points[i].DownVote = down
+		history.Points[i].Score = up - down
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting vote history", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetVoteHistory(t *testing.T) {
+	t.Run("HourlySeries", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		historyService := NewVoteHistoryService(db)
+
+		from := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+		to := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+
+		// Votes were only counted in the first and third hours
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM crypto_vote WHERE id = \\? AND deleted_at IS NULL").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("FROM vote_buckets").
+			WithArgs(3600, 1, from, to).
+			WillReturnRows(sqlmock.NewRows([]string{"bucket", "up_vote", "down_vote"}).
+				AddRow(from.Unix()/3600, 5, 2).
+				AddRow(from.Unix()/3600+2, 1, 4))
+
+		// Create a new request and recorder for testing the handler
+		req, err := http.NewRequest("GET", "/v1/cryptovote/1/history?interval=1h&from=2026-03-01T10:30:00Z&to=2026-03-01T13:00:00Z", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/history", historyService.GetHistory).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var history VoteHistory
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+		assert.Equal(t, "1h", history.Interval)
+		assert.Equal(t, from, history.From)
+		assert.Equal(t, to, history.To)
+		assert.Equal(t, []VoteHistoryPoint{
+			{Time: from, UpVote: 5, DownVote: 2, Score: 3},
+			{Time: from.Add(time.Hour)},
+			{Time: from.Add(2 * time.Hour), UpVote: 1, DownVote: 4, Score: -3},
+			{Time: from.Add(3 * time.Hour)},
+		}, history.Points)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("InvalidInterval", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		historyService := NewVoteHistoryService(db)
+
+		req, err := http.NewRequest("GET", "/v1/cryptovote/1/history?interval=5m", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/history", historyService.GetHistory).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("TooManyPoints", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		historyService := NewVoteHistoryService(db)
+
+		req, err := http.NewRequest("GET", "/v1/cryptovote/1/history?interval=1m&from=2026-03-01T00:00:00Z&to=2026-03-02T00:00:00Z", nil)
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/cryptovote/{id:[0-9]+}/history", historyService.GetHistory).Methods("GET")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRecordVotes(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	historyService := NewVoteHistoryService(db)
+
+	minute := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	votes := []VoteCast{
+		{CryptoID: 2, Direction: "up", CastAt: minute.Add(10 * time.Second)},
+		{CryptoID: 1, Direction: "up", CastAt: minute.Add(20 * time.Second)},
+		{CryptoID: 2, Direction: "down", CastAt: minute.Add(30 * time.Second)},
+		{CryptoID: 1, Direction: "up", CastAt: minute.Add(70 * time.Second)},
+		{CryptoID: 2, Direction: "up", CastAt: minute.Add(50 * time.Second)},
+	}
+
+	// Every bucket is written once, in key order
+	mock.ExpectExec("INSERT INTO vote_buckets \\(crypto_id, bucket_start, up_vote, down_vote\\) VALUES \\(\\?, \\?, \\?, \\?\\), \\(\\?, \\?, \\?, \\?\\), \\(\\?, \\?, \\?, \\?\\) ON DUPLICATE KEY UPDATE").
+		WithArgs(1, minute, 1, 0, 1, minute.Add(time.Minute), 1, 0, 2, minute, 2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	err = historyService.RecordVotes(db, votes)
+	assert.NoError(t, err)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,63 @@
+package main
+
+import "time"
+
+// VoteObserver is notified of every vote counted in the public tally, whether
+// it was cast anonymously, signed or approved by a moderator. Direction is
+// "up" or "down" and at is the time the vote was cast.
+type VoteObserver interface {
+	ObserveVote(cryptoID int, direction string, at time.Time)
+}
+
+type voteObservers []VoteObserver
+
+// notify passes the counted vote to every observer in the order they were
+// added.
+func (observers voteObservers) notify(cryptoID int, direction string, at time.Time) {
+	for _, observer := range observers {
+		observer.ObserveVote(cryptoID, direction, at)
+	}
+}
+
+// VoteRecorder is an observer that records the votes written behind in
+// batches in the transaction that counts them, instead of observing them one
+// by one after the flush.
+type VoteRecorder interface {
+	VoteObserver
+	RecordVotes(tx executor, votes []VoteCast) error
+}
+
+// VoteBatchObserver is an observer notified once of all the votes of a flush
+// instead of every vote.
+type VoteBatchObserver interface {
+	VoteObserver
+	ObserveVotes(votes []VoteCast)
+}
+
+// record lets the recorders record the flushed votes in the transaction.
+func (observers voteObservers) record(tx executor, votes []VoteCast) error {
+	for _, observer := range observers {
+		if recorder, ok := observer.(VoteRecorder); ok {
+			if err := recorder.RecordVotes(tx, votes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// notifyBatch passes the flushed votes to the observers which did not record
+// them, at once to those observing batches.
+func (observers voteObservers) notifyBatch(votes []VoteCast) {
+	for _, observer := range observers {
+		switch observer := observer.(type) {
+		case VoteRecorder:
+		case VoteBatchObserver:
+			observer.ObserveVotes(votes)
+		default:
+			for _, vote := range votes {
+				observer.ObserveVote(vote.CryptoID, vote.Direction, vote.CastAt)
+			}
+		}
+	}
+}
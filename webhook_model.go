@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	WebhookEventCryptoCreated = "crypto.created"
+	WebhookEventCryptoDeleted = "crypto.deleted"
+	WebhookEventVoteMilestone = "vote.milestone"
+)
+
+var webhookEventTypes = map[string]bool{
+	WebhookEventCryptoCreated: true,
+	WebhookEventCryptoDeleted: true,
+	WebhookEventVoteMilestone: true,
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// WebhookSubscription receives the events of its event types at its URL.
+// The secret signs the deliveries and is never returned.
+type WebhookSubscription struct {
+	ID         int       `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookEvent is the body of every delivery.
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// VoteMilestone is the data of a vote.milestone event, sent once the total
+// votes of a cryptocurrency reach the milestone.
+type VoteMilestone struct {
+	Milestone int            `json:"milestone"`
+	Crypto    CryptoCurrency `json:"crypto"`
+}
+
+// WebhookDelivery is one event queued for one subscription, along with the
+// outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int       `json:"last_status_code,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
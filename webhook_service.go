@@ -0,0 +1,729 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const maxWebhookDeliveryPageSize = 500
+
+// WebhookConfig holds the delivery and retry settings of the webhooks.
+type WebhookConfig struct {
+	// A failed delivery is retried after BaseBackoff, doubling after every
+	// failure up to MaxBackoff. It is moved to the dead letters once
+	// MaxAttempts attempts failed.
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Timeout of a single delivery request, and the number of deliveries
+	// sent every dispatch.
+	Timeout   time.Duration
+	BatchSize int
+
+	// Total votes announced by vote.milestone events
+	Milestones []int
+}
+
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		MaxAttempts: 8,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  time.Hour,
+		Timeout:     10 * time.Second,
+		BatchSize:   100,
+		Milestones:  []int{100, 1000, 10000, 100000, 1000000},
+	}
+}
+
+// WebhookService manages webhook subscriptions and delivers the catalog and
+// vote events to them. Published events are queued in webhook_deliveries,
+// one delivery per subscription, and sent by the dispatcher, so deliveries
+// survive restarts and failing receivers are retried with exponential
+// backoff.
+type WebhookService struct {
+	db     Database
+	config WebhookConfig
+	client *http.Client
+	audit  *AuditService
+	// now returns the current time, read again for every claim and attempt
+	// since sending a batch can take many request timeouts
+	now func() time.Time
+
+	mu sync.Mutex
+	// Highest milestone announced by cryptocurrency ID
+	milestones map[int]int
+}
+
+func NewWebhookService(db *sql.DB, config WebhookConfig) *WebhookService {
+	return &WebhookService{
+		db:         db,
+		config:     config,
+		client:     &http.Client{Timeout: config.Timeout},
+		now:        func() time.Time { return time.Now().UTC() },
+		milestones: make(map[int]int),
+	}
+}
+
+// EnableAuditLog records subscription changes in the audit log.
+func (s *WebhookService) EnableAuditLog(audit *AuditService) {
+	s.audit = audit
+}
+
+// Publish queues the event for every subscription to its type. Failing to
+// queue it is logged and does not fail the request that caused it. A nil
+// WebhookService publishes nothing.
+func (s *WebhookService) Publish(eventType string, data interface{}) {
+	if s == nil {
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Println("Error publishing webhook event:", err)
+		return
+	}
+
+	if err := s.publish(hex.EncodeToString(id), eventType, data, time.Now().UTC()); err != nil {
+		log.Println("Error publishing webhook event:", err)
+	}
+}
+
+func (s *WebhookService) publish(id string, eventType string, data interface{}, now time.Time) error {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := WebhookEvent{
+		ID:        id,
+		Type:      eventType,
+		CreatedAt: now.Truncate(time.Second),
+		Data:      dataJSON,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+		SELECT id, ?, ?, ?, ?, 0, ?, ? FROM webhook_subscriptions WHERE FIND_IN_SET(?, event_types)`,
+		event.ID, event.Type, string(payload), WebhookDeliveryPending, event.CreatedAt, event.CreatedAt, event.Type)
+	return err
+}
+
+// WebhookEventPublisher queues the catalog domain events relayed from the
+// outbox as webhook deliveries, so every committed creation or deletion is
+// announced, even when the instance stops right after the commit. The event
+// ID is derived from the outbox ID, so an event relayed twice keeps its ID.
+type WebhookEventPublisher struct {
+	webhooks *WebhookService
+}
+
+// Domain events announced to the webhook subscriptions, by their webhook
+// event type
+var webhookDomainEvents = map[string]string{
+	DomainEventCryptoCreated: WebhookEventCryptoCreated,
+	DomainEventCryptoDeleted: WebhookEventCryptoDeleted,
+}
+
+func NewWebhookEventPublisher(webhooks *WebhookService) WebhookEventPublisher {
+	return WebhookEventPublisher{webhooks: webhooks}
+}
+
+// DomainEventTypes returns the types of the domain events it publishes.
+func (p WebhookEventPublisher) DomainEventTypes() []string {
+	eventTypes := make([]string, 0, len(webhookDomainEvents))
+	for eventType := range webhookDomainEvents {
+		eventTypes = append(eventTypes, eventType)
+	}
+	return eventTypes
+}
+
+func (p WebhookEventPublisher) Publish(event DomainEvent) error {
+	eventType, ok := webhookDomainEvents[event.Type]
+	if !ok {
+		return nil
+	}
+	return p.webhooks.publish(fmt.Sprintf("%032x", event.ID), eventType, event.Data, event.OccurredAt.UTC())
+}
+
+// CheckMilestones publishes a vote.milestone event once the total votes of
+// the cryptocurrency reach a milestone. Every milestone is only announced
+// once per cryptocurrency, even with several instances counting votes.
+func (s *WebhookService) CheckMilestones(crypto CryptoCurrency) {
+	if s == nil {
+		return
+	}
+
+	milestone := 0
+	for _, m := range s.config.Milestones {
+		if crypto.TotalVotes >= m {
+			milestone = m
+		}
+	}
+
+	s.mu.Lock()
+	announced := milestone <= s.milestones[crypto.ID]
+	s.mu.Unlock()
+
+	if announced {
+		return
+	}
+
+	// The milestone is only remembered once recorded, a failed insert is
+	// retried on the next vote. Concurrent votes may both insert it, the
+	// unique key lets only one of them announce it.
+	result, err := s.db.Exec("INSERT IGNORE INTO webhook_milestones (crypto_id, milestone, reached_at) VALUES (?, ?, ?)",
+		crypto.ID, milestone, time.Now().UTC())
+	if err != nil {
+		log.Println("Error recording vote milestone:", err)
+		return
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error recording vote milestone:", err)
+		return
+	}
+
+	s.mu.Lock()
+	if milestone > s.milestones[crypto.ID] {
+		s.milestones[crypto.ID] = milestone
+	}
+	s.mu.Unlock()
+
+	if inserted == 0 {
+		return
+	}
+
+	s.Publish(WebhookEventVoteMilestone, VoteMilestone{Milestone: milestone, Crypto: crypto})
+}
+
+// CheckMilestonesOf reads the counts of the cryptocurrency and checks them
+// for milestones, for votes counted without reading them back.
+func (s *WebhookService) CheckMilestonesOf(cryptoID int) {
+	if s == nil {
+		return
+	}
+
+	var crypto CryptoCurrency
+	err := s.db.QueryRow("SELECT id, name, up_vote, down_vote, (up_vote + down_vote) as total_votes FROM crypto_vote WHERE id=? AND deleted_at IS NULL", cryptoID).
+		Scan(&crypto.ID, &crypto.Name, &crypto.UpVote, &crypto.DownVote, &crypto.TotalVotes)
+	if err != nil {
+		log.Println("Error checking vote milestones:", err)
+		return
+	}
+
+	s.CheckMilestones(crypto)
+}
+
+// StartDispatcher sends the deliveries that are due every interval in the
+// background.
+func (s *WebhookService) StartDispatcher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			_, err := s.DeliverDue(time.Now().UTC())
+			if err != nil {
+				log.Println("Error delivering webhooks:", err)
+			}
+		}
+	}()
+}
+
+type dueWebhookDelivery struct {
+	id        int
+	eventID   string
+	eventType string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    string
+}
+
+// DeliverDue sends the pending deliveries whose next attempt is due at now
+// and returns the number of deliveries that succeeded.
+func (s *WebhookService) DeliverDue(now time.Time) (int, error) {
+	rows, err := s.db.Query(`SELECT d.id, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? ORDER BY d.id LIMIT ?`, WebhookDeliveryPending, now, s.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []dueWebhookDelivery
+	for rows.Next() {
+		var delivery dueWebhookDelivery
+		if err := rows.Scan(&delivery.id, &delivery.eventID, &delivery.eventType, &delivery.payload, &delivery.attempts, &delivery.url, &delivery.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, delivery)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, delivery := range due {
+		// Claim the delivery by pushing its next attempt past the request
+		// timeout, so other instances leave it alone while it is sent
+		claimedAt := s.now()
+		result, err := s.db.Exec("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at <= ?",
+			claimedAt.Add(2*s.config.Timeout), delivery.id, WebhookDeliveryPending, claimedAt)
+		if err != nil {
+			return delivered, err
+		}
+		if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+			continue
+		}
+
+		ok, err := s.deliver(delivery)
+		if err != nil {
+			return delivered, err
+		}
+		if ok {
+			delivered++
+		}
+	}
+
+	return delivered, nil
+}
+
+// deliver sends the delivery once and records the outcome of the attempt.
+func (s *WebhookService) deliver(delivery dueWebhookDelivery) (bool, error) {
+	delivery.attempts++
+
+	statusCode, err := s.send(delivery)
+	now := s.now()
+	if err == nil {
+		_, err = s.db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = NULL, last_status_code = ?, last_error = NULL, delivered_at = ? WHERE id = ?",
+			WebhookDeliveryDelivered, delivery.attempts, statusCode, now, delivery.id)
+		return err == nil, err
+	}
+
+	var lastStatusCode *int
+	if statusCode != 0 {
+		lastStatusCode = &statusCode
+	}
+
+	status := WebhookDeliveryPending
+	nextAttemptAt := now.Add(webhookBackoff(s.config, delivery.attempts))
+	next := &nextAttemptAt
+	if delivery.attempts >= s.config.MaxAttempts {
+		status = WebhookDeliveryDead
+		next = nil
+	}
+
+	_, err = s.db.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ? WHERE id = ?",
+		status, delivery.attempts, next, lastStatusCode, err.Error(), delivery.id)
+	return false, err
+}
+
+// send posts the payload to the subscription URL. It returns the status code
+// of the response, if any, and an error unless the receiver answered with a
+// 2xx status.
+func (s *WebhookService) send(delivery dueWebhookDelivery) (int, error) {
+	req, err := http.NewRequest("POST", delivery.url, bytes.NewReader(delivery.payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := s.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", delivery.eventID)
+	req.Header.Set("X-Webhook-Event", delivery.eventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhookPayload(delivery.secret, timestamp, delivery.payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of
+// "{timestamp}.{payload}" keyed with the subscription secret.
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before retrying a delivery that failed
+// the given number of attempts.
+func webhookBackoff(config WebhookConfig, attempts int) time.Duration {
+	backoff := config.BaseBackoff
+	for i := 1; i < attempts && backoff < config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > config.MaxBackoff {
+		backoff = config.MaxBackoff
+	}
+	return backoff
+}
+
+// CreateWebhook subscribes a URL to the given event types.
+func (s *WebhookService) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var subscription WebhookSubscription
+
+	err := json.NewDecoder(r.Body).Decode(&subscription)
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(subscription.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		http.Error(w, "URL must be an absolute http or https URL", http.StatusBadRequest)
+		return
+	}
+
+	if len(subscription.EventTypes) == 0 {
+		http.Error(w, "At least one event type is required", http.StatusBadRequest)
+		return
+	}
+
+	seen := make(map[string]bool)
+	var eventTypes []string
+	for _, eventType := range subscription.EventTypes {
+		if !webhookEventTypes[eventType] {
+			http.Error(w, "Unknown event type "+eventType, http.StatusBadRequest)
+			return
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	subscription.EventTypes = eventTypes
+
+	if len(subscription.Secret) < 16 {
+		http.Error(w, "Secret must be at least 16 characters long", http.StatusBadRequest)
+		return
+	}
+
+	subscription.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO webhook_subscriptions (url, event_types, secret, created_at) VALUES (?, ?, ?, ?)",
+		subscription.URL, strings.Join(subscription.EventTypes, ","), subscription.Secret, subscription.CreatedAt)
+	if err != nil {
+		log.Println("Error inserting into database:", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	lastInsertID, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error getting last insert ID:", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	subscription.ID = int(lastInsertID)
+	subscription.Secret = ""
+
+	err = s.audit.Record(tx, r, AuditActionWebhookCreate, subscription.ID, nil, subscription)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+func (s *WebhookService) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rows, err := s.db.Query("SELECT id, url, event_types, created_at FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting webhooks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	subscriptions := []WebhookSubscription{}
+	for rows.Next() {
+		var subscription WebhookSubscription
+		var eventTypes string
+		if err := rows.Scan(&subscription.ID, &subscription.URL, &eventTypes, &subscription.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting webhooks", http.StatusInternalServerError)
+			return
+		}
+		subscription.EventTypes = strings.Split(eventTypes, ",")
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+func (s *WebhookService) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	subscription, ok := s.lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DeleteWebhook unsubscribes the webhook. Its queued deliveries and its
+// delivery log are removed along with it.
+func (s *WebhookService) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	subscription, ok := s.lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM webhook_subscriptions WHERE id = ?", subscription.ID)
+	if err != nil {
+		log.Println("Error deleting from database:", err)
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionWebhookDelete, subscription.ID, subscription, nil)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns the delivery log of the webhook, most recent
+// first, optionally only the deliveries with the given status.
+func (s *WebhookService) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	subscription, ok := s.lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeDeliveries(w, r, "subscription_id = ?", subscription.ID)
+}
+
+// GetDeadLetters returns the deliveries of every webhook that exhausted
+// their attempts, most recent first.
+func (s *WebhookService) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s.writeDeliveries(w, r, "status = ?", WebhookDeliveryDead)
+}
+
+// RetryDelivery sends a dead delivery again, starting over with its
+// attempts.
+func (s *WebhookService) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["deliveryId"])
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Println("Error starting transaction:", err)
+		http.Error(w, "Error retrying delivery", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	result, err := tx.Exec("UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND status = ?",
+		WebhookDeliveryPending, now, deliveryID, WebhookDeliveryDead)
+	if err != nil {
+		log.Println("Error updating database:", err)
+		http.Error(w, "Error retrying delivery", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Println("Error getting rows affected:", err)
+		http.Error(w, "Error retrying delivery", http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Delivery is not a dead letter", http.StatusConflict)
+		return
+	}
+
+	err = s.audit.Record(tx, r, AuditActionWebhookRetry, deliveryID, nil, nil)
+	if err != nil {
+		log.Println("Error recording audit log:", err)
+		http.Error(w, "Error retrying delivery", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error committing transaction:", err)
+		http.Error(w, "Error retrying delivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *WebhookService) writeDeliveries(w http.ResponseWriter, r *http.Request, condition string, arg interface{}) {
+	query := r.URL.Query()
+
+	sqlQuery := `SELECT id, subscription_id, event_id, event_type, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at
+		FROM webhook_deliveries WHERE ` + condition
+	args := []interface{}{arg}
+
+	if status := query.Get("status"); status != "" {
+		if status != WebhookDeliveryPending && status != WebhookDeliveryDelivered && status != WebhookDeliveryDead {
+			http.Error(w, "Status must be pending, delivered or dead", http.StatusBadRequest)
+			return
+		}
+		sqlQuery += " AND status = ?"
+		args = append(args, status)
+	}
+
+	limit := maxWebhookDeliveryPageSize
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxWebhookDeliveryPageSize {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	sqlQuery += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting deliveries", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &delivery.Status, &delivery.Attempts,
+			&delivery.NextAttemptAt, &delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt)
+		if err != nil {
+			log.Println("Error scanning row:", err)
+			http.Error(w, "Error getting deliveries", http.StatusInternalServerError)
+			return
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		http.Error(w, "Error getting deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// lookupWebhook loads the subscription named by the id route variable,
+// answering 404 if there is none.
+func (s *WebhookService) lookupWebhook(w http.ResponseWriter, r *http.Request) (WebhookSubscription, bool) {
+	var subscription WebhookSubscription
+
+	subscriptionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return subscription, false
+	}
+
+	var eventTypes string
+	err = s.db.QueryRow("SELECT id, url, event_types, created_at FROM webhook_subscriptions WHERE id = ?", subscriptionID).
+		Scan(&subscription.ID, &subscription.URL, &eventTypes, &subscription.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Webhook does not exist", http.StatusNotFound)
+		return subscription, false
+	}
+	if err != nil {
+		log.Println("Error querying database:", err)
+		http.Error(w, "Error getting webhook", http.StatusInternalServerError)
+		return subscription, false
+	}
+
+	subscription.EventTypes = strings.Split(eventTypes, ",")
+	return subscription, true
+}
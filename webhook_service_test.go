@@ -0,0 +1,300 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var dueDeliveryColumns = []string{"id", "event_id", "event_type", "payload", "attempts", "url", "secret"}
+
+func TestWebhookBackoff(t *testing.T) {
+	config := DefaultWebhookConfig()
+
+	assert.Equal(t, 30*time.Second, webhookBackoff(config, 1))
+	assert.Equal(t, time.Minute, webhookBackoff(config, 2))
+	assert.Equal(t, 4*time.Minute, webhookBackoff(config, 4))
+	assert.Equal(t, time.Hour, webhookBackoff(config, 12))
+}
+
+// steppingClock returns a clock that advances by a second every time it is
+// read, starting at start.
+func steppingClock(start time.Time) func() time.Time {
+	next := start
+	return func() time.Time {
+		now := next
+		next = next.Add(time.Second)
+		return now
+	}
+}
+
+func TestDeliverDueWebhooks(t *testing.T) {
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+	payload := `{"id":"abc","type":"crypto.created","created_at":"2026-03-08T12:00:00Z","data":{"id":1,"name":"Bitcoin"}}`
+	secret := "0123456789abcdef"
+
+	t.Run("Delivered", func(t *testing.T) {
+		// The receiver checks the signature of the delivery
+		var received string
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+
+			timestamp, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+			assert.NoError(t, err)
+			assert.Equal(t, now.Add(time.Second).Unix(), timestamp)
+			assert.Equal(t, "sha256="+signWebhookPayload(secret, timestamp, body), r.Header.Get("X-Webhook-Signature"))
+			assert.Equal(t, "crypto.created", r.Header.Get("X-Webhook-Event"))
+			assert.Equal(t, "abc", r.Header.Get("X-Webhook-ID"))
+		}))
+		defer receiver.Close()
+
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		webhookService := NewWebhookService(db, DefaultWebhookConfig())
+		webhookService.now = steppingClock(now)
+
+		// Set the expectations for claiming the delivery and marking it
+		// delivered, the claim, the signature and the delivery time each read
+		// the clock
+		mock.ExpectQuery("FROM webhook_deliveries d").
+			WithArgs(WebhookDeliveryPending, now, 100).
+			WillReturnRows(sqlmock.NewRows(dueDeliveryColumns).AddRow(1, "abc", "crypto.created", payload, 0, receiver.URL, secret))
+		mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at = \\?").
+			WithArgs(now.Add(20*time.Second), 1, WebhookDeliveryPending, now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE webhook_deliveries SET status = \\?, attempts = \\?, next_attempt_at = NULL").
+			WithArgs(WebhookDeliveryDelivered, 1, 200, now.Add(2*time.Second), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		delivered, err := webhookService.DeliverDue(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, payload, received)
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Retried", func(t *testing.T) {
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer receiver.Close()
+
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		webhookService := NewWebhookService(db, DefaultWebhookConfig())
+		webhookService.now = steppingClock(now)
+
+		// The third failed attempt is retried four backoffs after it failed
+		mock.ExpectQuery("FROM webhook_deliveries d").
+			WillReturnRows(sqlmock.NewRows(dueDeliveryColumns).AddRow(1, "abc", "crypto.created", payload, 2, receiver.URL, secret))
+		mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at = \\?").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE webhook_deliveries SET status = \\?, attempts = \\?, next_attempt_at = \\?, last_status_code = \\?, last_error = \\?").
+			WithArgs(WebhookDeliveryPending, 3, now.Add(2*time.Second+2*time.Minute), 500, "receiver answered with status 500", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		delivered, err := webhookService.DeliverDue(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DeadLetter", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		webhookService := NewWebhookService(db, DefaultWebhookConfig())
+
+		// The last attempt fails to reach the receiver at all
+		mock.ExpectQuery("FROM webhook_deliveries d").
+			WillReturnRows(sqlmock.NewRows(dueDeliveryColumns).AddRow(1, "abc", "crypto.created", payload, 7, "http://127.0.0.1:1", secret))
+		mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at = \\?").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE webhook_deliveries SET status = \\?, attempts = \\?, next_attempt_at = \\?, last_status_code = \\?, last_error = \\?").
+			WithArgs(WebhookDeliveryDead, 8, nil, nil, sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		delivered, err := webhookService.DeliverDue(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ClaimedElsewhere", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		webhookService := NewWebhookService(db, DefaultWebhookConfig())
+
+		// Another instance claimed the delivery first, it is not sent twice
+		mock.ExpectQuery("FROM webhook_deliveries d").
+			WillReturnRows(sqlmock.NewRows(dueDeliveryColumns).AddRow(1, "abc", "crypto.created", payload, 0, "http://127.0.0.1:1", secret))
+		mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at = \\?").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		delivered, err := webhookService.DeliverDue(now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCheckMilestones(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	webhookService := NewWebhookService(db, DefaultWebhookConfig())
+
+	// Set the expectations for announcing the milestone once, retrying after
+	// it failed to be recorded
+	mock.ExpectExec("INSERT IGNORE INTO webhook_milestones").
+		WithArgs(1, 100, sqlmock.AnyArg()).
+		WillReturnError(errors.New("database error"))
+	mock.ExpectExec("INSERT IGNORE INTO webhook_milestones").
+		WithArgs(1, 100, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs(sqlmock.AnyArg(), WebhookEventVoteMilestone, sqlmock.AnyArg(), WebhookDeliveryPending, sqlmock.AnyArg(), sqlmock.AnyArg(), WebhookEventVoteMilestone).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	webhookService.CheckMilestones(CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 99, TotalVotes: 99})
+	webhookService.CheckMilestones(CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 100, TotalVotes: 100})
+	webhookService.CheckMilestones(CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 100, TotalVotes: 100})
+	webhookService.CheckMilestones(CryptoCurrency{ID: 1, Name: "Bitcoin", UpVote: 101, TotalVotes: 101})
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckMilestonesOf(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	webhookService := NewWebhookService(db, DefaultWebhookConfig())
+
+	// A signed or approved vote is read back to check its milestone
+	mock.ExpectQuery("SELECT id, name, up_vote, down_vote, \\(up_vote \\+ down_vote\\) as total_votes FROM crypto_vote WHERE id=\\? AND deleted_at IS NULL").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "up_vote", "down_vote", "total_votes"}).AddRow(1, "Bitcoin", 90, 10, 100))
+	mock.ExpectExec("INSERT IGNORE INTO webhook_milestones").
+		WithArgs(1, 100, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs(sqlmock.AnyArg(), WebhookEventVoteMilestone, sqlmock.AnyArg(), WebhookDeliveryPending, sqlmock.AnyArg(), sqlmock.AnyArg(), WebhookEventVoteMilestone).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	webhookService.CheckMilestonesOf(1)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookEventPublisher(t *testing.T) {
+	// Create a new mock database and expected result
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	publisher := NewWebhookEventPublisher(NewWebhookService(db, DefaultWebhookConfig()))
+	occurredAt := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	// A relayed creation is queued under an ID derived from the outbox ID
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs("0000000000000000000000000000002a", WebhookEventCryptoCreated, sqlmock.AnyArg(), WebhookDeliveryPending, occurredAt, occurredAt, WebhookEventCryptoCreated).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = publisher.Publish(DomainEvent{ID: 42, Type: DomainEventCryptoCreated, AggregateID: 5, Data: []byte(`{"id":5,"name":"Arbitrum"}`), OccurredAt: occurredAt})
+	assert.NoError(t, err)
+
+	// Votes are not announced to the subscriptions
+	err = publisher.Publish(DomainEvent{ID: 43, Type: DomainEventVoteCast, AggregateID: 5, Data: []byte(`{}`), OccurredAt: occurredAt})
+	assert.NoError(t, err)
+
+	// Check that all the expected SQL queries were executed
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateWebhook(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		// Create a new mock database and expected result
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		webhookService := NewWebhookService(db, DefaultWebhookConfig())
+
+		// Set the expectations for storing the subscription
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO webhook_subscriptions").
+			WithArgs("https://partner.example/hooks", "crypto.created,vote.milestone", "0123456789abcdef", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(4, 1))
+		mock.ExpectCommit()
+
+		// Create a new request and recorder for testing the handler
+		body := `{"url": "https://partner.example/hooks", "event_types": ["crypto.created", "vote.milestone", "crypto.created"], "secret": "0123456789abcdef"}`
+		req, err := http.NewRequest("POST", "/v1/admin/webhooks", strings.NewReader(body))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		// Set up the router and call the handler
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/webhooks", webhookService.CreateWebhook).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		// Check the response status code and content, the secret is never returned
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"id":4,"url":"https://partner.example/hooks","event_types":["crypto.created","vote.milestone"]`)
+		assert.NotContains(t, rr.Body.String(), "secret")
+
+		// Check that all the expected SQL queries were executed
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UnknownEventType", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		webhookService := NewWebhookService(db, DefaultWebhookConfig())
+
+		body := `{"url": "https://partner.example/hooks", "event_types": ["crypto.renamed"], "secret": "0123456789abcdef"}`
+		req, err := http.NewRequest("POST", "/v1/admin/webhooks", strings.NewReader(body))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		r := mux.NewRouter()
+		r.HandleFunc("/v1/admin/webhooks", webhookService.CreateWebhook).Methods("POST")
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}